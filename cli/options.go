@@ -18,6 +18,7 @@ package cli
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"os"
 	"path/filepath"
@@ -45,7 +46,8 @@ type ProjectOptions struct {
 	// WorkingDir is a file path to use as the project directory or empty.
 	//
 	// If empty, the project loader will automatically infer a reasonable
-	// working directory if possible.
+	// working directory if possible: the directory of the primary Compose
+	// file, or the current directory when it is read from stdin (`-`).
 	WorkingDir string
 
 	// ConfigPaths are file paths to one or more Compose files.
@@ -77,6 +79,8 @@ type ProjectOptions struct {
 	EnvFiles []string
 
 	loadOptions []func(*loader.Options)
+
+	resourceLoaders []loader.ResourceLoader
 }
 
 type ProjectOptionsFn func(*ProjectOptions) error
@@ -126,7 +130,9 @@ func WithWorkingDirectory(wd string) ProjectOptionsFn {
 	}
 }
 
-// WithConfigFileEnv allow to set compose config file paths by COMPOSE_FILE environment variable
+// WithConfigFileEnv allow to set compose config file paths by COMPOSE_FILE environment variable, unless config
+// paths are explicitly set. Paths are separated by COMPOSE_PATH_SEPARATOR, or the OS path list separator, `:` on
+// Unix and `;` on Windows, and are merged in order. Relative paths are resolved from the working directory if set
 func WithConfigFileEnv(o *ProjectOptions) error {
 	if len(o.ConfigPaths) > 0 {
 		return nil
@@ -136,12 +142,22 @@ func WithConfigFileEnv(o *ProjectOptions) error {
 		sep = string(os.PathListSeparator)
 	}
 	f, ok := o.Environment[consts.ComposeFilePath]
-	if ok {
-		paths, err := absolutePaths(strings.Split(f, sep))
-		o.ConfigPaths = paths
-		return err
+	if !ok {
+		return nil
 	}
-	return nil
+	var files []string
+	for _, file := range strings.Split(f, sep) {
+		if file == "" {
+			continue
+		}
+		if o.WorkingDir != "" && file != "-" && !filepath.IsAbs(file) && o.remoteResourceLoader(file) == nil {
+			file = filepath.Join(o.WorkingDir, file)
+		}
+		files = append(files, file)
+	}
+	paths, err := o.absolutePaths(files)
+	o.ConfigPaths = paths
+	return err
 }
 
 // WithDefaultConfigPath searches for default config files from working directory
@@ -207,6 +223,27 @@ func WithLoadOptions(loadOptions ...func(*loader.Options)) ProjectOptionsFn {
 	}
 }
 
+// WithResourceLoader registers loaders for Compose files which are not on the local filesystem, like
+// `ssh://host/path/compose.yaml`. They are used to read config paths they accept, as well as files referenced
+// by `extends` and `include`. This option must be set before WithConfigFileEnv to apply to COMPOSE_FILE
+func WithResourceLoader(loaders ...loader.ResourceLoader) ProjectOptionsFn {
+	return func(o *ProjectOptions) error {
+		o.resourceLoaders = append(o.resourceLoaders, loaders...)
+		o.loadOptions = append(o.loadOptions, loader.WithRemoteResourceLoaders(loaders...))
+		return nil
+	}
+}
+
+// remoteResourceLoader returns the first registered loader accepting path, or nil if it's a local path
+func (o ProjectOptions) remoteResourceLoader(path string) loader.ResourceLoader {
+	for _, l := range o.resourceLoaders {
+		if l.Accept(path) {
+			return l
+		}
+	}
+	return nil
+}
+
 // WithProfiles sets profiles to be activated
 func WithProfiles(profiles []string) ProjectOptionsFn {
 	return func(o *ProjectOptions) error {
@@ -236,7 +273,9 @@ func WithEnvFile(file string) ProjectOptionsFn {
 	return WithEnvFiles(files...)
 }
 
-// WithEnvFiles set alternate env files
+// WithEnvFiles set alternate env files, used by WithDotEnv instead of the `.env` file of the working directory.
+// Files are loaded in order, a variable set by a file overriding the one set by previous files, and can reference
+// the variables they set. Missing files are ignored
 func WithEnvFiles(file ...string) ProjectOptionsFn {
 	return func(options *ProjectOptions) error {
 		options.EnvFiles = file
@@ -244,7 +283,8 @@ func WithEnvFiles(file ...string) ProjectOptionsFn {
 	}
 }
 
-// WithDotEnv imports environment variables from .env file
+// WithDotEnv imports environment variables from the env files set by WithEnvFiles, or the `.env` file of the working
+// directory. Variables set by the process environment take precedence over the ones set by env files
 func WithDotEnv(o *ProjectOptions) error {
 	wd, err := o.GetWorkingDir()
 	if err != nil {
@@ -263,6 +303,9 @@ func WithDotEnv(o *ProjectOptions) error {
 	return nil
 }
 
+// GetEnvFromFile loads the variables set by env files, or the `.env` file of workingDir if none is set. Files are
+// loaded in order, later files overriding the variables set by earlier ones. Missing files and directories are
+// ignored. Variables referenced by a file are resolved from the previous files, then from currentEnv
 func GetEnvFromFile(currentEnv map[string]string, workingDir string, filenames []string) (map[string]string, error) {
 	envMap := make(map[string]string)
 
@@ -279,19 +322,16 @@ func GetEnvFromFile(currentEnv map[string]string, workingDir string, filenames [
 
 		s, err := os.Stat(dotEnvFile)
 		if os.IsNotExist(err) {
-			return envMap, nil
+			continue
+		}
+		if err != nil {
+			return envMap, err
 		}
 		if s.IsDir() {
-			return envMap, nil
+			continue
 		}
 
 		b, err := os.ReadFile(dotEnvFile)
-		if os.IsNotExist(err) {
-			if len(filenames) > 0 {
-				return nil, errors.Errorf("Couldn't read env file: %s", dotEnvFile)
-			}
-			return envMap, nil
-		}
 		if err != nil {
 			return envMap, err
 		}
@@ -364,18 +404,19 @@ var DefaultFileNames = []string{"compose.yaml", "compose.yml", "docker-compose.y
 // DefaultOverrideFileNames defines the Compose override file names for auto-discovery (in order of preference)
 var DefaultOverrideFileNames = []string{"compose.override.yml", "compose.override.yaml", "docker-compose.override.yml", "docker-compose.override.yaml"}
 
+// GetWorkingDir returns the project directory, relative paths in the Compose files, like `include` paths, are resolved against.
+// Unless set by WithWorkingDirectory, this is the directory of the primary Compose file, or the current
+// directory when the primary Compose file is read from stdin or by a remote resource loader
 func (o ProjectOptions) GetWorkingDir() (string, error) {
 	if o.WorkingDir != "" {
 		return o.WorkingDir, nil
 	}
-	for _, path := range o.ConfigPaths {
-		if path != "-" {
-			absPath, err := filepath.Abs(path)
-			if err != nil {
-				return "", err
-			}
-			return filepath.Dir(absPath), nil
+	if len(o.ConfigPaths) > 0 && o.ConfigPaths[0] != "-" && o.remoteResourceLoader(o.ConfigPaths[0]) == nil {
+		absPath, err := filepath.Abs(o.ConfigPaths[0])
+		if err != nil {
+			return "", err
 		}
+		return filepath.Dir(absPath), nil
 	}
 	return os.Getwd()
 }
@@ -395,6 +436,11 @@ func ProjectFromOptions(options *ProjectOptions) (*types.Project, error) {
 			if err != nil {
 				return nil, err
 			}
+		} else if remote := options.remoteResourceLoader(f); remote != nil {
+			b, err = remote.Load(context.Background(), f)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to load %s", f)
+			}
 		} else {
 			f, err := filepath.Abs(f)
 			if err != nil {
@@ -462,7 +508,7 @@ func withConvertWindowsPaths(options *ProjectOptions) func(*loader.Options) {
 // getConfigPathsFromOptions retrieves the config files for project based on project options
 func getConfigPathsFromOptions(options *ProjectOptions) ([]string, error) {
 	if len(options.ConfigPaths) != 0 {
-		return absolutePaths(options.ConfigPaths)
+		return options.absolutePaths(options.ConfigPaths)
 	}
 	return nil, errors.Wrap(errdefs.ErrNotFound, "no configuration file provided")
 }
@@ -478,10 +524,12 @@ func findFiles(names []string, pwd string) []string {
 	return candidates
 }
 
-func absolutePaths(p []string) ([]string, error) {
+// absolutePaths makes local config paths absolute, and checks they exist. Stdin and paths accepted by a remote
+// resource loader are left unchanged
+func (o ProjectOptions) absolutePaths(p []string) ([]string, error) {
 	var paths []string
 	for _, f := range p {
-		if f == "-" {
+		if f == "-" || o.remoteResourceLoader(f) != nil {
 			paths = append(paths, f)
 			continue
 		}
@@ -17,9 +17,11 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"gotest.tools/v3/assert"
@@ -212,6 +214,52 @@ func TestProjectFromSetOfFiles(t *testing.T) {
 	assert.Equal(t, service.Image, "haproxy")
 }
 
+func TestProjectFromComposeFileEnv(t *testing.T) {
+	simple, err := filepath.Abs(filepath.Join("testdata", "simple"))
+	assert.NilError(t, err)
+
+	t.Run("custom separator", func(t *testing.T) {
+		opts, err := NewProjectOptions(nil, WithEnv([]string{
+			"COMPOSE_FILE=testdata/simple/compose.yaml,testdata/simple/compose-with-overrides.yaml,",
+			"COMPOSE_PATH_SEPARATOR=,",
+		}), WithName("my_project"), WithConfigFileEnv)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, opts.ConfigPaths, []string{
+			filepath.Join(simple, "compose.yaml"),
+			filepath.Join(simple, "compose-with-overrides.yaml"),
+		})
+		p, err := ProjectFromOptions(opts)
+		assert.NilError(t, err)
+		service, err := p.GetService("simple")
+		assert.NilError(t, err)
+		assert.Equal(t, service.Image, "haproxy")
+	})
+
+	t.Run("mixed absolute and relative paths", func(t *testing.T) {
+		opts, err := NewProjectOptions(nil, WithEnv([]string{
+			"COMPOSE_FILE=compose-with-overrides.yaml" + string(os.PathListSeparator) + filepath.Join(simple, "compose.yaml"),
+		}), WithWorkingDirectory("testdata/simple"), WithName("my_project"), WithConfigFileEnv)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, opts.ConfigPaths, []string{
+			filepath.Join(simple, "compose-with-overrides.yaml"),
+			filepath.Join(simple, "compose.yaml"),
+		})
+		p, err := ProjectFromOptions(opts)
+		assert.NilError(t, err)
+		service, err := p.GetService("simple")
+		assert.NilError(t, err)
+		assert.Equal(t, service.Image, "nginx")
+	})
+
+	t.Run("explicit config paths", func(t *testing.T) {
+		opts, err := NewProjectOptions([]string{"testdata/simple/compose.yaml"}, WithEnv([]string{
+			"COMPOSE_FILE=testdata/simple/compose-with-overrides.yaml",
+		}), WithConfigFileEnv)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, opts.ConfigPaths, []string{"testdata/simple/compose.yaml"})
+	})
+}
+
 func TestProjectComposefilesFromSetOfFiles(t *testing.T) {
 	opts, err := NewProjectOptions([]string{},
 		WithWorkingDirectory("testdata/simple/"),
@@ -290,6 +338,30 @@ func TestProjectWithMultipleEnvFile(t *testing.T) {
 	assert.Equal(t, service.Ports[0].Published, "9000")
 }
 
+func TestEnvFilesPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, ".env")
+	assert.NilError(t, os.WriteFile(root, []byte("ROOT=root\nSHARED=root\nPROCESS=root\n"), 0o600))
+	service := filepath.Join(dir, "service", ".env")
+	assert.NilError(t, os.MkdirAll(filepath.Dir(service), 0o700))
+	assert.NilError(t, os.WriteFile(service, []byte("SHARED=service\nDERIVED=${ROOT}-${SHARED}\n"), 0o600))
+	t.Setenv("PROCESS", "process")
+
+	opts, err := NewProjectOptions(nil,
+		WithWorkingDirectory(dir),
+		// a missing file is ignored, and doesn't prevent the next ones from being loaded
+		WithEnvFiles(root, filepath.Join(dir, "missing.env"), service),
+		WithDotEnv)
+	assert.NilError(t, err)
+	assert.Equal(t, opts.Environment["ROOT"], "root")
+	// later files override earlier ones
+	assert.Equal(t, opts.Environment["SHARED"], "service")
+	// and can reference the variables set by earlier ones
+	assert.Equal(t, opts.Environment["DERIVED"], "root-service")
+	// the process environment takes precedence over env files
+	assert.Equal(t, opts.Environment["PROCESS"], "process")
+}
+
 func TestProjectNameFromWorkingDir(t *testing.T) {
 	opts, err := NewProjectOptions([]string{
 		"testdata/env-file/compose-with-env-file.yaml",
@@ -300,6 +372,133 @@ func TestProjectNameFromWorkingDir(t *testing.T) {
 	assert.Equal(t, p.Name, "env-file")
 }
 
+func TestProjectFromStdin(t *testing.T) {
+	stdin, err := os.Open("testdata/simple/compose-with-paths.yaml")
+	assert.NilError(t, err)
+	defer stdin.Close() //nolint:errcheck
+	defer func(f *os.File) { os.Stdin = f }(os.Stdin)
+	os.Stdin = stdin
+
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+
+	opts, err := NewProjectOptions([]string{"-", "testdata/simple/compose-with-overrides.yaml"},
+		WithName("my_project"), WithResolvedPaths(true))
+	assert.NilError(t, err)
+	p, err := ProjectFromOptions(opts)
+	assert.NilError(t, err)
+	assert.Equal(t, p.WorkingDir, wd)
+	service, err := p.GetService("test")
+	assert.NilError(t, err)
+	assert.Equal(t, service.Volumes[1].Source, filepath.Join(wd, "relative"))
+}
+
+type sshResourceLoader map[string]string
+
+func (l sshResourceLoader) Accept(path string) bool {
+	return strings.HasPrefix(path, "ssh://")
+}
+
+func (l sshResourceLoader) Load(_ context.Context, path string) ([]byte, error) {
+	content, ok := l[path]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", path)
+	}
+	return []byte(content), nil
+}
+
+func TestProjectFromRemoteFile(t *testing.T) {
+	remote := sshResourceLoader{
+		"ssh://host/app/compose.yaml": `
+name: remote
+include:
+  - ssh://host/app/db.yaml
+services:
+  web:
+    image: nginx
+    depends_on:
+      - db
+`,
+		"ssh://host/app/db.yaml": `
+services:
+  db:
+    image: postgres
+`,
+	}
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+
+	opts, err := NewProjectOptions(nil,
+		WithResourceLoader(remote),
+		// `:` is part of the URL, so COMPOSE_FILE needs another separator
+		WithEnv([]string{"COMPOSE_FILE=ssh://host/app/compose.yaml", "COMPOSE_PATH_SEPARATOR=;"}),
+		WithConfigFileEnv)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, opts.ConfigPaths, []string{"ssh://host/app/compose.yaml"})
+	p, err := ProjectFromOptions(opts)
+	assert.NilError(t, err)
+	assert.Equal(t, p.Name, "remote")
+	assert.Equal(t, p.WorkingDir, wd)
+	assert.DeepEqual(t, p.ServiceNames(), []string{"db", "web"})
+	assert.DeepEqual(t, p.ComposeFiles, []string{"ssh://host/app/compose.yaml"})
+
+	opts, err = NewProjectOptions([]string{"ssh://host/app/missing.yaml"}, WithResourceLoader(remote))
+	assert.NilError(t, err)
+	_, err = ProjectFromOptions(opts)
+	assert.ErrorContains(t, err, "failed to load ssh://host/app/missing.yaml")
+}
+
+func TestProjectFromStdinWithInclude(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stdin")
+	assert.NilError(t, os.WriteFile(path, []byte(`
+name: stdin-include
+include:
+  - testdata/include/compose.yaml
+services:
+  web:
+    image: nginx
+    depends_on:
+      - db
+`), 0o600))
+	stdin, err := os.Open(path)
+	assert.NilError(t, err)
+	defer stdin.Close() //nolint:errcheck
+	defer func(f *os.File) { os.Stdin = f }(os.Stdin)
+	os.Stdin = stdin
+
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+
+	opts, err := NewProjectOptions([]string{"-"}, WithResolvedPaths(true))
+	assert.NilError(t, err)
+	p, err := ProjectFromOptions(opts)
+	assert.NilError(t, err)
+	assert.Equal(t, p.WorkingDir, wd)
+	assert.DeepEqual(t, p.ServiceNames(), []string{"db", "web"})
+	db, err := p.GetService("db")
+	assert.NilError(t, err)
+	assert.Equal(t, db.Volumes[0].Source, filepath.Join(wd, "testdata", "include", "data"))
+}
+
+func TestProjectFromStdinWithWorkingDirectory(t *testing.T) {
+	stdin, err := os.Open("testdata/simple/compose-with-paths.yaml")
+	assert.NilError(t, err)
+	defer stdin.Close() //nolint:errcheck
+	defer func(f *os.File) { os.Stdin = f }(os.Stdin)
+	os.Stdin = stdin
+
+	opts, err := NewProjectOptions([]string{"-"},
+		WithName("my_project"), WithWorkingDirectory("testdata/simple"), WithResolvedPaths(true))
+	assert.NilError(t, err)
+	p, err := ProjectFromOptions(opts)
+	assert.NilError(t, err)
+	abs, err := filepath.Abs("testdata/simple")
+	assert.NilError(t, err)
+	service, err := p.GetService("test")
+	assert.NilError(t, err)
+	assert.Equal(t, service.Volumes[1].Source, filepath.Join(abs, "relative"))
+}
+
 func TestEnvMap(t *testing.T) {
 	m := map[string]string{}
 	m["foo"] = "bar"
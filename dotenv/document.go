@@ -0,0 +1,204 @@
+package dotenv
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// QuoteStyle is the quoting of a value in a dotenv file
+type QuoteStyle byte
+
+const (
+	// Unquoted values are read until the end of line or an inline comment
+	Unquoted QuoteStyle = 0
+	// SingleQuoted values are taken literally
+	SingleQuoted QuoteStyle = prefixSingleQuote
+	// DoubleQuoted values support escape sequences and variable expansion
+	DoubleQuoted QuoteStyle = prefixDoubleQuote
+)
+
+// Entry is a variable declaration, a comment line or a blank line of a dotenv file
+type Entry struct {
+	// Key is the variable name, or empty for comment and blank lines
+	Key string
+	// Value is the raw value, without quotes, and with escape sequences and variables left unexpanded
+	Value string
+	// Quote is the quoting of Value
+	Quote QuoteStyle
+	// Export is set when the declaration is prefixed with `export`
+	Export bool
+	// Comment is the text following `#`, as a trailing comment of a declaration or for a comment line
+	Comment string
+
+	// raw is the source text of the entry, reproduced by Marshal as long as the entry isn't modified
+	raw string
+	// parsed holds the values initially parsed, to detect modifications
+	parsed *Entry
+}
+
+// Document is the content of a dotenv file as an ordered list of entries, to rewrite it with
+// declarations order and comments preserved. Values are neither unescaped nor expanded, use
+// Parse to get the actual environment declared by the file.
+type Document struct {
+	Entries []*Entry
+}
+
+// ParseDocument reads a dotenv file as a Document
+func ParseDocument(r io.Reader) (*Document, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	src := string(b)
+	doc := &Document{}
+	line := 1
+	for src != "" {
+		entry, rest, lines, err := parseEntry(src, line)
+		if err != nil {
+			return nil, err
+		}
+		parsed := *entry
+		entry.parsed = &parsed
+		entry.raw = src[:len(src)-len(rest)]
+		doc.Entries = append(doc.Entries, entry)
+		src = rest
+		line += lines
+	}
+	return doc, nil
+}
+
+// Lookup returns the last entry declaring key, or nil if there's none
+func (d *Document) Lookup(key string) *Entry {
+	for i := len(d.Entries) - 1; i >= 0; i-- {
+		if d.Entries[i].Key == key {
+			return d.Entries[i]
+		}
+	}
+	return nil
+}
+
+// Marshal serializes the document. Unmodified entries are reproduced as they were read
+func (d *Document) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	for _, entry := range d.Entries {
+		if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteString("\n")
+		}
+		if !entry.modified() {
+			buf.WriteString(entry.raw)
+			continue
+		}
+		s, err := entry.format()
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(s)
+		buf.WriteString("\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// modified reports whether the entry changed since it was parsed, or was added to the document
+func (e *Entry) modified() bool {
+	p := e.parsed
+	return p == nil || e.Key != p.Key || e.Value != p.Value || e.Quote != p.Quote || e.Export != p.Export || e.Comment != p.Comment
+}
+
+func (e *Entry) format() (string, error) {
+	var b strings.Builder
+	if e.Key != "" {
+		if strings.ContainsAny(e.Key, "=:# \t\n") {
+			return "", fmt.Errorf("invalid variable name %q", e.Key)
+		}
+		if e.Export {
+			b.WriteString("export ")
+		}
+		b.WriteString(e.Key)
+		b.WriteString("=")
+		switch e.Quote {
+		case SingleQuoted, DoubleQuoted:
+			b.WriteByte(byte(e.Quote))
+			b.WriteString(e.Value)
+			b.WriteByte(byte(e.Quote))
+		default:
+			b.WriteString(e.Value)
+		}
+		if e.Comment != "" {
+			b.WriteString(" ")
+		}
+	}
+	if e.Comment != "" {
+		b.WriteString("#")
+		b.WriteString(e.Comment)
+	}
+	return b.String(), nil
+}
+
+// parseEntry parses the entry at the beginning of src, and returns the rest of src along with the
+// number of lines the entry spans
+func parseEntry(src string, line int) (*Entry, string, int, error) {
+	text, rest, found := strings.Cut(src, "\n")
+	lines := 0
+	if found {
+		lines = 1
+	}
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return &Entry{}, rest, lines, nil
+	}
+	if trimmed[0] == charComment {
+		return &Entry{Comment: trimmed[1:]}, rest, lines, nil
+	}
+
+	entry := &Entry{}
+	decl := strings.TrimLeftFunc(src, isSpace)
+	if loc := exportRegex.FindStringIndex(decl); loc != nil {
+		entry.Export = true
+		decl = decl[loc[1]:]
+	}
+	end := strings.IndexAny(decl, "=:\n")
+	if end < 0 || decl[end] == '\n' {
+		// variable inherited from the environment
+		key, _, _ := strings.Cut(decl, "\n")
+		entry.Key = strings.TrimSpace(key)
+		return entry, rest, lines, nil
+	}
+	entry.Key = strings.TrimRightFunc(decl[:end], unicode.IsSpace)
+	value := strings.TrimLeftFunc(decl[end+1:], isSpace)
+
+	quote, isQuoted := hasQuotePrefix(value)
+	if !isQuoted {
+		text, rest, _ := strings.Cut(value, "\n")
+		text = strings.TrimSuffix(text, "\r")
+		if i := strings.Index(text, " #"); i >= 0 {
+			entry.Comment = text[i+2:]
+			text = text[:i]
+		}
+		entry.Value = strings.TrimRightFunc(text, unicode.IsSpace)
+		return entry, rest, lines, nil
+	}
+
+	entry.Quote = QuoteStyle(quote)
+	lines = 0
+	for i := 1; i < len(value); i++ {
+		if value[i] == '\n' {
+			lines++
+		}
+		if value[i] != quote || value[i-1] == '\\' {
+			continue
+		}
+		entry.Value = value[1:i]
+		text, rest, found := strings.Cut(value[i+1:], "\n")
+		if found {
+			lines++
+		}
+		if _, comment, ok := strings.Cut(text, "#"); ok {
+			entry.Comment = strings.TrimSuffix(comment, "\r")
+		}
+		return entry, rest, lines, nil
+	}
+	return nil, "", 0, fmt.Errorf("line %d: unterminated quoted value %s", line, strings.TrimSuffix(text, "\r"))
+}
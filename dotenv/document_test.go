@@ -0,0 +1,82 @@
+package dotenv
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+)
+
+const testDocument = `# database settings
+export DB_HOST=localhost # local only
+DB_PASSWORD='s3cr3t#not-a-comment'
+
+GREETING="hello
+world" # multi-line
+INHERITED
+EMPTY=
+URL=http://${DB_HOST}:5432`
+
+func TestParseDocument(t *testing.T) {
+	doc, err := ParseDocument(strings.NewReader(testDocument))
+	assert.NilError(t, err)
+
+	type entry struct {
+		Key     string
+		Value   string
+		Quote   QuoteStyle
+		Export  bool
+		Comment string
+	}
+	var entries []entry
+	for _, e := range doc.Entries {
+		entries = append(entries, entry{e.Key, e.Value, e.Quote, e.Export, e.Comment})
+	}
+	assert.Check(t, is.DeepEqual([]entry{
+		{Comment: " database settings"},
+		{Key: "DB_HOST", Value: "localhost", Export: true, Comment: " local only"},
+		{Key: "DB_PASSWORD", Value: "s3cr3t#not-a-comment", Quote: SingleQuoted},
+		{},
+		{Key: "GREETING", Value: "hello\nworld", Quote: DoubleQuoted, Comment: " multi-line"},
+		{Key: "INHERITED"},
+		{Key: "EMPTY"},
+		{Key: "URL", Value: "http://${DB_HOST}:5432"},
+	}, entries))
+
+	b, err := doc.Marshal()
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), testDocument)
+}
+
+func TestDocumentMarshalModified(t *testing.T) {
+	doc, err := ParseDocument(strings.NewReader(testDocument))
+	assert.NilError(t, err)
+
+	doc.Lookup("DB_PASSWORD").Value = "changed"
+	doc.Lookup("DB_HOST").Comment = " updated"
+	doc.Entries = append(doc.Entries, &Entry{Key: "ADDED", Value: "a b", Quote: DoubleQuoted})
+
+	b, err := doc.Marshal()
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), `# database settings
+export DB_HOST=localhost # updated
+DB_PASSWORD='changed'
+
+GREETING="hello
+world" # multi-line
+INHERITED
+EMPTY=
+URL=http://${DB_HOST}:5432
+ADDED="a b"
+`)
+
+	doc.Entries = append(doc.Entries, &Entry{Key: "NOT VALID"})
+	_, err = doc.Marshal()
+	assert.Error(t, err, `invalid variable name "NOT VALID"`)
+}
+
+func TestParseDocumentUnterminatedQuote(t *testing.T) {
+	_, err := ParseDocument(strings.NewReader("A=1\nB=\"unterminated\nC=3\n"))
+	assert.Error(t, err, `line 2: unterminated quoted value B="unterminated`)
+}
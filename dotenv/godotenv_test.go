@@ -250,6 +250,16 @@ func TestExpanding(t *testing.T) {
 			"FOO=test\nBAR=\"foo\\${FOO} ${FOO}\"",
 			map[string]string{"FOO": "test", "BAR": "foo${FOO} test"},
 		},
+		{
+			"does not expand escaped variables in unquoted values",
+			"FOO=test\nBAR=foo\\$FOO-\\${FOO}-${FOO}",
+			map[string]string{"FOO": "test", "BAR": "foo$FOO-${FOO}-test"},
+		},
+		{
+			"does not expand forward references",
+			"BAR=${FOO}bar\nFOO=test",
+			map[string]string{"FOO": "test", "BAR": "bar"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -149,6 +149,8 @@ func (p *parser) extractVarValue(src string, envMap map[string]string, lookupFn
 		// Remove inline comments on unquoted lines
 		value, _, _ = strings.Cut(value, " #")
 		value = strings.TrimRightFunc(value, unicode.IsSpace)
+		// `\$` is the only escape sequence supported in unquoted values, for a literal `$`
+		value = strings.ReplaceAll(value, `\$`, "$$")
 		retVal, err := expandVariables(string(value), envMap, lookupFn)
 		return retVal, rest, err
 	}
@@ -18,6 +18,7 @@ package interpolation
 
 import (
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/compose-spec/compose-go/template"
@@ -32,6 +33,20 @@ type Options struct {
 	TypeCastMapping map[Path]Cast
 	// Substitution function to use
 	Substitute func(string, template.Mapping) (string, error)
+	// CollectErrors makes Interpolate continue past values which fail to interpolate, and report all
+	// the failures at once as a MultiError
+	CollectErrors bool
+	// Resolvers maps a prefix, like `secret:`, to the resolver for `${secret:reference}` expressions.
+	// Only used by the default Substitute function
+	Resolvers map[string]template.Resolver
+	// KeepUnresolved lists variables which are not interpolated: expressions referencing them, like `${VAR:-default}`,
+	// are kept verbatim, including the variables nested in them, so they can be interpolated later. As the result is
+	// meant to be interpolated again, `$` is kept escaped as `$$`, in escaped values like `$${VAR}` and in the
+	// values of the other variables
+	KeepUnresolved []string
+
+	// collected accumulates errors when CollectErrors is set
+	collected *[]error
 }
 
 // LookupValue is a function which maps from variable names to values.
@@ -53,9 +68,35 @@ func Interpolate(config map[string]interface{}, opts Options) (map[string]interf
 	}
 	if opts.Substitute == nil {
 		opts.Substitute = template.Substitute
+		if len(opts.Resolvers) > 0 {
+			resolvers := opts.Resolvers
+			opts.Substitute = func(value string, mapping template.Mapping) (string, error) {
+				return template.SubstituteWithResolvers(value, mapping, resolvers)
+			}
+		}
+	}
+
+	if len(opts.KeepUnresolved) > 0 {
+		substitute := opts.Substitute
+		keep := map[string]bool{}
+		for _, name := range opts.KeepUnresolved {
+			keep[name] = true
+		}
+		opts.Substitute = func(value string, mapping template.Mapping) (string, error) {
+			// substituted values are escaped too, so the result is only interpolated once more
+			escaped := func(name string) (string, bool) {
+				v, ok := mapping(name)
+				return strings.ReplaceAll(v, "$", "$$"), ok
+			}
+			return substitute(escapeVariables(value, keep), escaped)
+		}
 	}
 
 	out := map[string]interface{}{}
+	var collected []error
+	if opts.CollectErrors {
+		opts.collected = &collected
+	}
 
 	for key, value := range config {
 		interpolatedValue, err := recursiveInterpolate(value, NewPath(key), opts)
@@ -65,13 +106,89 @@ func Interpolate(config map[string]interface{}, opts Options) (map[string]interf
 		out[key] = interpolatedValue
 	}
 
+	if len(collected) > 0 {
+		sort.Slice(collected, func(i, j int) bool {
+			return collected[i].Error() < collected[j].Error()
+		})
+		return out, &MultiError{errs: collected}
+	}
 	return out, nil
 }
 
+// escapeVariables escapes the expressions referencing the kept variables, with the variables nested in them, so
+// substitution leaves them verbatim. Escaped `$$` are escaped once more, so they are kept escaped
+func escapeVariables(value string, keep map[string]bool) string {
+	kept := map[int]string{}
+	for _, v := range template.ExtractVariablesFromString(value, nil) {
+		if keep[v.Name] {
+			kept[v.Offset] = v.Name
+		}
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case strings.HasPrefix(value[i:], "$$"):
+			b.WriteString("$$$$")
+			i++
+		case kept[i] != "":
+			end := expressionEnd(value[i:], kept[i])
+			b.WriteString(strings.ReplaceAll(value[i:i+end], "$", "$$"))
+			i += end - 1
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String()
+}
+
+// expressionEnd returns the length of the expression referencing name at the start of s, either `$NAME` or
+// `${NAME...}`, including nested expressions
+func expressionEnd(s string, name string) int {
+	if !strings.HasPrefix(s, "${") {
+		return len("$" + name)
+	}
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "${"):
+			depth++
+			i++
+		case s[i] == '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(s)
+}
+
+// MultiError is returned by Interpolate when Options.CollectErrors is set, to report all the values which failed to interpolate
+type MultiError struct {
+	errs []error
+}
+
+// Errors returns the interpolation errors, each one including the path of the value which failed to interpolate
+func (e *MultiError) Errors() []error {
+	return e.errs
+}
+
+func (e *MultiError) Error() string {
+	messages := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
 func recursiveInterpolate(value interface{}, path Path, opts Options) (interface{}, error) {
 	switch value := value.(type) {
 	case string:
 		newValue, err := opts.Substitute(value, template.Mapping(opts.LookupValue))
+		if err != nil && opts.collected != nil {
+			*opts.collected = append(*opts.collected, newPathError(path, err))
+			return value, nil
+		}
 		if err != nil || newValue == value {
 			return value, newPathError(path, err)
 		}
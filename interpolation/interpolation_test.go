@@ -17,10 +17,12 @@
 package interpolation
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"testing"
 
+	"github.com/compose-spec/compose-go/template"
 	"gotest.tools/v3/assert"
 	is "gotest.tools/v3/assert/cmp"
 )
@@ -66,6 +68,41 @@ func TestInterpolate(t *testing.T) {
 	assert.Check(t, is.DeepEqual(expected, result))
 }
 
+func TestInterpolateWithResolvers(t *testing.T) {
+	services := map[string]interface{}{
+		"servicea": map[string]interface{}{
+			"image": "${REGISTRY:-${config:registry}}/app:${FOO}",
+			"environment": map[string]interface{}{
+				"PASSWORD": "${secret:${USER}/password}",
+			},
+		},
+	}
+	expected := map[string]interface{}{
+		"servicea": map[string]interface{}{
+			"image": "registry.example.com/app:bar",
+			"environment": map[string]interface{}{
+				"PASSWORD": "s3cr3t",
+			},
+		},
+	}
+	result, err := Interpolate(services, Options{
+		LookupValue: defaultMapping,
+		Resolvers: map[string]template.Resolver{
+			"secret:": func(reference string) (string, error) {
+				if reference != "jenny/password" {
+					return "", fmt.Errorf("unknown secret %s", reference)
+				}
+				return "s3cr3t", nil
+			},
+			"config:": func(reference string) (string, error) {
+				return reference + ".example.com", nil
+			},
+		},
+	})
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(expected, result))
+}
+
 func TestInvalidInterpolation(t *testing.T) {
 	services := map[string]interface{}{
 		"servicea": map[string]interface{}{
@@ -78,6 +115,85 @@ You may need to escape any $ with another $.
 ${`)
 }
 
+func TestInterpolateCollectErrors(t *testing.T) {
+	services := map[string]interface{}{
+		"servicea": map[string]interface{}{
+			"image": "${IMAGE:?image is required}",
+			"environment": map[string]interface{}{
+				"USER":     "${USER}",
+				"PASSWORD": "${PASSWORD?}",
+			},
+		},
+	}
+	result, err := Interpolate(services, Options{LookupValue: defaultMapping, CollectErrors: true})
+	assert.Check(t, is.Equal(result["servicea"].(map[string]interface{})["environment"].(map[string]interface{})["USER"], "jenny"))
+
+	var multiErr interface{ Errors() []error }
+	assert.Assert(t, errors.As(err, &multiErr))
+	errs := multiErr.Errors()
+	assert.Equal(t, len(errs), 2)
+	assert.Check(t, is.ErrorContains(errs[0], "servicea.environment.PASSWORD"))
+	assert.Check(t, is.ErrorContains(errs[0], "required variable PASSWORD is missing a value"))
+	assert.Check(t, is.ErrorContains(errs[1], "servicea.image"))
+	assert.Check(t, is.ErrorContains(errs[1], "required variable IMAGE is missing a value: image is required"))
+
+	_, err = Interpolate(services, Options{LookupValue: defaultMapping})
+	assert.Check(t, !errors.As(err, &multiErr))
+}
+
+func TestInterpolateKeepUnresolved(t *testing.T) {
+	services := map[string]interface{}{
+		"servicea": map[string]interface{}{
+			"image": "${KEEP:-x}",
+			"environment": map[string]interface{}{
+				"USER":    "${USER} $KEEP",
+				"MIXED":   "${UNSET:-${KEEP}} ${USER}",
+				"ESCAPED": "$${USER}",
+				"REQUIRE": "${KEEP:?must be set at deploy time}",
+				"NESTED":  "${KEEP:-${USER}}",
+				"DEFAULT": "${UNSET:-$${USER}} ${KEEP:-$$x}",
+			},
+		},
+	}
+	result, err := Interpolate(services, Options{LookupValue: defaultMapping, KeepUnresolved: []string{"KEEP"}})
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(map[string]interface{}{
+		"servicea": map[string]interface{}{
+			"image": "${KEEP:-x}",
+			"environment": map[string]interface{}{
+				"USER":    "jenny $KEEP",
+				"MIXED":   "${KEEP} jenny",
+				"ESCAPED": "$${USER}",
+				"REQUIRE": "${KEEP:?must be set at deploy time}",
+				"NESTED":  "${KEEP:-${USER}}",
+				"DEFAULT": "$${USER} ${KEEP:-$$x}",
+			},
+		},
+	}, result))
+
+	// once all variables are set, interpolating the result gives the same values as a single interpolation
+	lookup := func(name string) (string, bool) {
+		if name == "KEEP" {
+			return "kept", true
+		}
+		return defaultMapping(name)
+	}
+	once, err := Interpolate(services, Options{LookupValue: lookup})
+	assert.NilError(t, err)
+	twice, err := Interpolate(result, Options{LookupValue: lookup})
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(once, twice))
+
+	result, err = Interpolate(map[string]interface{}{"price": "${PRICE} ${KEEP}"}, Options{
+		LookupValue: func(name string) (string, bool) {
+			return "$5", name == "PRICE"
+		},
+		KeepUnresolved: []string{"KEEP"},
+	})
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(map[string]interface{}{"price": "$$5 ${KEEP}"}, result))
+}
+
 func TestInterpolateWithDefaults(t *testing.T) {
 	t.Setenv("FOO", "BARZ")
 
@@ -0,0 +1,81 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"fmt"
+	"sort"
+)
+
+// deprecatedServiceAttributes maps deprecated service attributes to the suggested replacement
+var deprecatedServiceAttributes = map[string]string{
+	"dockerfile": "use `build.dockerfile`",
+	"log_driver": "use `logging.driver`",
+	"log_opt":    "use `logging.options`",
+	"scale":      "use `deploy.replicas`",
+}
+
+// deprecationWarnings lists the deprecated attributes used by a compose file, with their path in the file
+// and a suggested replacement
+func deprecationWarnings(filename string, dict map[string]interface{}) []string {
+	var warnings []string
+	if _, ok := dict["version"]; ok {
+		warnings = append(warnings, fmt.Sprintf("%s: `version` is obsolete, it is ignored and can be removed", filename))
+	}
+
+	attributes := make([]string, 0, len(deprecatedServiceAttributes))
+	for attribute := range deprecatedServiceAttributes {
+		attributes = append(attributes, attribute)
+	}
+	sort.Strings(attributes)
+
+	services, _ := dict["services"].(map[string]interface{})
+	for _, name := range sortedKeys(services) {
+		service, ok := services[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, attribute := range attributes {
+			if _, ok := service[attribute]; ok {
+				warnings = append(warnings, fmt.Sprintf("%s: services.%s.%s is deprecated, %s",
+					filename, name, attribute, deprecatedServiceAttributes[attribute]))
+			}
+		}
+	}
+
+	for _, section := range []string{"networks", "volumes", "secrets", "configs"} {
+		resources, _ := dict[section].(map[string]interface{})
+		for _, name := range sortedKeys(resources) {
+			resource, _ := resources[name].(map[string]interface{})
+			external, _ := resource["external"].(map[string]interface{})
+			if _, ok := external["name"]; ok {
+				warnings = append(warnings, fmt.Sprintf("%s: %s.%s.external.name is deprecated, use `name` along with `external: true`",
+					filename, section, name))
+			}
+		}
+	}
+	return warnings
+}
+
+func sortedKeys(dict map[string]interface{}) []string {
+	keys := make([]string, 0, len(dict))
+	for key := range dict {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,131 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/compose-spec/compose-go/errdefs"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Document is the YAML node tree of a compose file, to apply edits and write it
+// back with comments and key order preserved.
+// A Document is neither interpolated nor validated.
+type Document struct {
+	root   yaml.Node
+	indent int
+}
+
+// LoadDocument parses a compose file as a Document
+func LoadDocument(source []byte) (*Document, error) {
+	d := &Document{
+		indent: detectIndent(source),
+	}
+	if err := yaml.Unmarshal(source, &d.root); err != nil {
+		return nil, err
+	}
+	if d.root.Kind == 0 {
+		// empty file
+		d.root = yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}},
+		}
+	}
+	if d.root.Kind != yaml.DocumentNode || len(d.root.Content) != 1 || d.root.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.Wrap(errdefs.ErrInvalid, "Top-level object must be a mapping")
+	}
+	return d, nil
+}
+
+// Root returns the top-level mapping node, for edits not covered by Document accessors
+func (d *Document) Root() *yaml.Node {
+	return d.root.Content[0]
+}
+
+// Lookup returns the node at path, or nil if there's none
+func (d *Document) Lookup(path ...string) *yaml.Node {
+	node := d.Root()
+	for _, key := range path {
+		node = mappingValue(node, key)
+		if node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+// SetServiceImage sets the image of a service, adding the `image` attribute if it's missing
+func (d *Document) SetServiceImage(service, image string) error {
+	s := d.Lookup("services", service)
+	if s == nil || s.Kind != yaml.MappingNode {
+		return errors.Wrapf(errdefs.ErrNotFound, "no such service: %s", service)
+	}
+	value := mappingValue(s, "image")
+	if value == nil {
+		s.Content = append(s.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "image"},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: image},
+		)
+		return nil
+	}
+	value.Kind = yaml.ScalarNode
+	value.Tag = "!!str"
+	value.Value = image
+	value.Content = nil
+	return nil
+}
+
+// Bytes serializes the document, preserving comments and key order
+func (d *Document) Bytes() ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{})
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(d.indent)
+	if err := encoder.Encode(&d.root); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// detectIndent returns the indentation of the first nested line in source, so Bytes uses the same
+func detectIndent(source []byte) int {
+	for _, line := range strings.Split(string(source), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || trimmed == line || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		return len(line) - len(trimmed)
+	}
+	return 2
+}
@@ -0,0 +1,64 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"testing"
+
+	"github.com/compose-spec/compose-go/errdefs"
+	"gotest.tools/v3/assert"
+)
+
+func TestDocumentSetServiceImage(t *testing.T) {
+	doc, err := LoadDocument([]byte(`# my application
+name: app
+services:
+  # the frontend
+  web:
+    image: nginx:1.24 # pinned
+    ports:
+      - "8080:80"
+  worker:
+    build: ./worker
+`))
+	assert.NilError(t, err)
+
+	assert.NilError(t, doc.SetServiceImage("web", "nginx:1.25"))
+	assert.NilError(t, doc.SetServiceImage("worker", "acme/worker:${TAG}"))
+	err = doc.SetServiceImage("db", "postgres")
+	assert.Check(t, errdefs.IsNotFoundError(err))
+
+	b, err := doc.Bytes()
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), `# my application
+name: app
+services:
+  # the frontend
+  web:
+    image: nginx:1.25 # pinned
+    ports:
+      - "8080:80"
+  worker:
+    build: ./worker
+    image: acme/worker:${TAG}
+`)
+}
+
+func TestLoadDocumentInvalid(t *testing.T) {
+	_, err := LoadDocument([]byte(`- not a mapping`))
+	assert.Check(t, errdefs.IsInvalidError(err))
+}
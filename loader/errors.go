@@ -0,0 +1,163 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadError is returned by Load when a compose file is invalid, with the position of the offending
+// attribute when it is known
+type LoadError struct {
+	// File is the name of the compose file
+	File string
+	// Line and Column locate the offending attribute in the file, starting at 1, or are 0 when unknown
+	Line   int
+	Column int
+	// Path is the YAML path of the offending attribute, like `services.web.ports[2]`, or empty when unknown
+	Path string
+	// Err is the underlying error
+	Err error
+}
+
+func (e *LoadError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+):`)
+
+// yamlLoadError locates a YAML syntax error in the compose file
+func yamlLoadError(filename string, err error) error {
+	if loadErr, ok := err.(*LoadError); ok {
+		loadErr.File = filename
+		return loadErr
+	}
+	matches := yamlErrorLine.FindStringSubmatch(err.Error())
+	if matches == nil {
+		return err
+	}
+	line, _ := strconv.Atoi(matches[1])
+	return &LoadError{
+		File: filename,
+		Line: line,
+		Err:  err,
+	}
+}
+
+// schemaLoadError locates the attribute reported by a schema validation error in the compose file content
+func schemaLoadError(filename string, content []byte, err error) error {
+	field, ok := err.(interface{ Field() string })
+	if !ok || field.Field() == "(root)" {
+		return &LoadError{File: filename, Err: err}
+	}
+	loadErr := &LoadError{
+		File: filename,
+		Path: field.Field(),
+		Err:  err,
+	}
+
+	var root yaml.Node
+	if len(content) == 0 || yaml.Unmarshal(content, &root) != nil || len(root.Content) == 0 {
+		return loadErr
+	}
+	node, path := locateNode(root.Content[0], strings.Split(field.Field(), "."))
+	loadErr.Path = path
+	if node != nil {
+		loadErr.Line = node.Line
+		loadErr.Column = node.Column
+	}
+	return loadErr
+}
+
+// locateNode walks down the YAML node tree along the parts of a dotted path, and returns the node at path
+// along with the path rendered with list indexes, like `services.web.ports[2]`. A key may contain dots, so
+// consecutive parts are joined until they match one. If the path can't be followed, the returned node is nil
+func locateNode(node *yaml.Node, parts []string) (*yaml.Node, string) {
+	var path strings.Builder
+	for len(parts) > 0 {
+		if node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+		switch node.Kind {
+		case yaml.SequenceNode:
+			index, err := strconv.Atoi(parts[0])
+			if err != nil || index < 0 || index >= len(node.Content) {
+				return nil, path.String() + "." + strings.Join(parts, ".")
+			}
+			fmt.Fprintf(&path, "[%d]", index)
+			node = node.Content[index]
+			parts = parts[1:]
+		case yaml.MappingNode:
+			found := false
+			for n := len(parts); n > 0 && !found; n-- {
+				key := strings.Join(parts[:n], ".")
+				if value := mappingValueOrMerged(node, key); value != nil {
+					if path.Len() > 0 {
+						path.WriteString(".")
+					}
+					path.WriteString(key)
+					node = value
+					parts = parts[n:]
+					found = true
+				}
+			}
+			if !found {
+				return nil, strings.TrimPrefix(path.String()+"."+strings.Join(parts, "."), ".")
+			}
+		default:
+			return nil, strings.TrimPrefix(path.String()+"."+strings.Join(parts, "."), ".")
+		}
+	}
+	return node, path.String()
+}
+
+// mappingValueOrMerged looks up key in a mapping node, including the mappings merged with `<<`
+func mappingValueOrMerged(node *yaml.Node, key string) *yaml.Node {
+	if value := mappingValue(node, key); value != nil {
+		return value
+	}
+	merged := mappingValue(node, "<<")
+	if merged == nil {
+		return nil
+	}
+	if merged.Kind == yaml.AliasNode {
+		merged = merged.Alias
+	}
+	switch merged.Kind {
+	case yaml.MappingNode:
+		return mappingValueOrMerged(merged, key)
+	case yaml.SequenceNode:
+		for _, m := range merged.Content {
+			if m.Kind == yaml.AliasNode {
+				m = m.Alias
+			}
+			if value := mappingValueOrMerged(m, key); value != nil {
+				return value
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/compose-spec/compose-go/errdefs"
+	"github.com/compose-spec/compose-go/types"
+	"gotest.tools/v3/assert"
+)
+
+func loadWithError(t *testing.T, content string) *LoadError {
+	t.Helper()
+	_, err := Load(types.ConfigDetails{
+		ConfigFiles: []types.ConfigFile{{Filename: "compose.yaml", Content: []byte(content)}},
+		Environment: map[string]string{},
+	}, func(options *Options) {
+		options.SetProjectName("test", true)
+	})
+	assert.Assert(t, err != nil)
+	var loadErr *LoadError
+	assert.Assert(t, errors.As(err, &loadErr), err.Error())
+	return loadErr
+}
+
+func TestLoadErrorSchemaPosition(t *testing.T) {
+	loadErr := loadWithError(t, `
+services:
+  web:
+    image: nginx
+    ports:
+      - 80
+      - 443
+      - target: 8080
+        published: true
+`)
+	assert.Equal(t, loadErr.File, "compose.yaml")
+	assert.Equal(t, loadErr.Path, "services.web.ports[2].published")
+	assert.Equal(t, loadErr.Line, 9)
+	assert.Equal(t, loadErr.Column, 20)
+	assert.Error(t, loadErr, "services.web.ports.2.published must be a string or integer")
+}
+
+func TestLoadErrorSchemaPositionDottedKey(t *testing.T) {
+	loadErr := loadWithError(t, `
+x-defaults: &defaults
+  restart: 42
+services:
+  web:
+    <<: *defaults
+    image: nginx
+    sysctls:
+      net.core.somaxconn: [1024]
+`)
+	assert.Equal(t, loadErr.Path, "services.web.sysctls.net.core.somaxconn")
+	assert.Equal(t, loadErr.Line, 9)
+}
+
+func TestLoadErrorYAMLSyntax(t *testing.T) {
+	loadErr := loadWithError(t, `
+services:
+  web:
+    image: nginx: latest
+`)
+	assert.Equal(t, loadErr.File, "compose.yaml")
+	assert.Equal(t, loadErr.Line, 4)
+	assert.Equal(t, loadErr.Path, "")
+}
+
+func TestLoadErrorDuplicateKeys(t *testing.T) {
+	loadErr := loadWithError(t, `
+services:
+  web:
+    image: nginx
+  db:
+    image: postgres
+  web:
+    image: httpd
+`)
+	assert.Equal(t, loadErr.File, "compose.yaml")
+	assert.Equal(t, loadErr.Path, "services.web")
+	assert.Equal(t, loadErr.Line, 7)
+	assert.Check(t, errdefs.IsInvalidError(loadErr))
+	assert.Error(t, loadErr, "services.web is defined more than once, at lines 3 and 7: invalid compose project")
+
+	for _, section := range []string{"networks", "volumes", "secrets", "configs"} {
+		loadErr = loadWithError(t, `
+services:
+  web:
+    image: nginx
+`+section+`:
+  data:
+    external: true
+  data:
+    external: true
+`)
+		assert.Equal(t, loadErr.Path, section+".data")
+		assert.Error(t, loadErr, section+".data is defined more than once, at lines 6 and 8: invalid compose project")
+	}
+
+	loadErr = loadWithError(t, `
+services:
+  web:
+    image: nginx
+services:
+  db:
+    image: postgres
+`)
+	assert.Error(t, loadErr, "services is defined more than once, at lines 2 and 5: invalid compose project")
+}
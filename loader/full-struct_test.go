@@ -78,6 +78,7 @@ func services(workingDir, homeDir string) []types.ServiceConfig {
 			CapDrop:      []string{"NET_ADMIN", "SYS_ADMIN"},
 			CgroupParent: "m-executor-abcd",
 			Command:      []string{"bundle", "exec", "thin", "-p", "3000"},
+			CommandForm:  types.CommandFormShell,
 			Configs: []types.ServiceConfigObjConfig{
 				{
 					Source: "config1",
@@ -160,11 +161,12 @@ func services(workingDir, homeDir string) []types.ServiceConfig {
 				"c 1:3 mr",
 				"a 7:* rmw",
 			},
-			Devices:    []string{"/dev/ttyUSB0:/dev/ttyUSB0"},
-			DNS:        []string{"8.8.8.8", "9.9.9.9"},
-			DNSSearch:  []string{"dc1.example.com", "dc2.example.com"},
-			DomainName: "foo.com",
-			Entrypoint: []string{"/code/entrypoint.sh", "-p", "3000"},
+			Devices:        []string{"/dev/ttyUSB0:/dev/ttyUSB0"},
+			DNS:            []string{"8.8.8.8", "9.9.9.9"},
+			DNSSearch:      []string{"dc1.example.com", "dc2.example.com"},
+			DomainName:     "foo.com",
+			Entrypoint:     []string{"/code/entrypoint.sh", "-p", "3000"},
+			EntrypointForm: types.CommandFormExec,
 			Environment: map[string]*string{
 				"FOO":                 strPtr("foo_from_env_file"),
 				"BAR":                 strPtr("bar_from_env_file_2"),
@@ -173,9 +175,9 @@ func services(workingDir, homeDir string) []types.ServiceConfig {
 				"ENV.WITH.DOT":        strPtr("ok"),
 				"ENV_WITH_UNDERSCORE": strPtr("ok"),
 			},
-			EnvFile: []string{
-				"./example1.env",
-				"./example2.env",
+			EnvFile: []types.EnvFile{
+				{Path: "./example1.env", Required: true},
+				{Path: "./example2.env", Required: true},
 			},
 			Expose: []string{"3000", "8000"},
 			ExternalLinks: []string{
@@ -184,8 +186,8 @@ func services(workingDir, homeDir string) []types.ServiceConfig {
 				"project_db_1:postgresql",
 			},
 			ExtraHosts: types.HostsList{
-				"somehost":  "162.242.195.82",
-				"otherhost": "50.31.209.229",
+				"somehost":  []string{"162.242.195.82"},
+				"otherhost": []string{"50.31.209.229"},
 			},
 			Extensions: map[string]interface{}{
 				"x-bar": "baz",
@@ -571,6 +573,7 @@ func secrets(workingDir string) map[string]types.SecretConfig {
 		"secret4": {
 			Name:        "bar",
 			Environment: "BAR",
+			Content:     "this is a secret",
 			Extensions: map[string]interface{}{
 				"x-bar": "baz",
 				"x-foo": "bar",
@@ -650,14 +653,14 @@ services:
         parallelism: 3
         delay: 10s
         failure_action: continue
-        monitor: 1m0s
+        monitor: 1m
         max_failure_ratio: 0.3
         order: start-first
       rollback_config:
         parallelism: 3
         delay: 10s
         failure_action: continue
-        monitor: 1m0s
+        monitor: 1m
         max_failure_ratio: 0.3
         order: start-first
       resources:
@@ -678,7 +681,7 @@ services:
         condition: on-failure
         delay: 5s
         max_attempts: 3
-        window: 2m0s
+        window: 2m
       placement:
         constraints:
           - node=foo
@@ -1028,101 +1031,7 @@ x-nested:
 
 func fullExampleJSON(workingDir, homeDir string) string {
 	return fmt.Sprintf(`{
-  "configs": {
-    "config1": {
-      "file": "%s",
-      "external": false,
-      "labels": {
-        "foo": "bar"
-      }
-    },
-    "config2": {
-      "name": "my_config",
-      "external": true
-    },
-    "config3": {
-      "name": "config3",
-      "external": true
-    },
-    "config4": {
-      "name": "foo",
-      "file": "%s",
-      "external": false
-    }
-  },
   "name": "full_example_project_name",
-  "networks": {
-    "external-network": {
-      "name": "external-network",
-      "ipam": {},
-      "external": true
-    },
-    "other-external-network": {
-      "name": "my-cool-network",
-      "ipam": {},
-      "external": true
-    },
-    "other-network": {
-      "driver": "overlay",
-      "driver_opts": {
-        "baz": "1",
-        "foo": "bar"
-      },
-      "ipam": {
-        "driver": "overlay",
-        "config": [
-          {
-            "subnet": "172.28.0.0/16",
-            "gateway": "172.28.5.254",
-            "ip_range": "172.28.5.0/24",
-            "aux_addresses": {
-              "host1": "172.28.1.5",
-              "host2": "172.28.1.6",
-              "host3": "172.28.1.7"
-            }
-          },
-          {
-            "subnet": "2001:3984:3989::/64",
-            "gateway": "2001:3984:3989::1"
-          }
-        ]
-      },
-      "external": false,
-      "labels": {
-        "foo": "bar"
-      }
-    },
-    "some-network": {
-      "ipam": {},
-      "external": false
-    }
-  },
-  "secrets": {
-    "secret1": {
-      "file": "%s",
-      "external": false,
-      "labels": {
-        "foo": "bar"
-      }
-    },
-    "secret2": {
-      "name": "my_secret",
-      "external": true
-    },
-    "secret3": {
-      "name": "secret3",
-      "external": true
-    },
-    "secret4": {
-      "name": "bar",
-      "environment": "BAR",
-      "external": false
-    },
-    "secret5": {
-      "file": "/abs/secret_data",
-      "external": false
-    }
-  },
   "services": {
     "foo": {
       "build": {
@@ -1214,7 +1123,7 @@ func fullExampleJSON(workingDir, homeDir string) string {
           "parallelism": 3,
           "delay": "10s",
           "failure_action": "continue",
-          "monitor": "1m0s",
+          "monitor": "1m",
           "max_failure_ratio": 0.3,
           "order": "start-first"
         },
@@ -1222,7 +1131,7 @@ func fullExampleJSON(workingDir, homeDir string) string {
           "parallelism": 3,
           "delay": "10s",
           "failure_action": "continue",
-          "monitor": "1m0s",
+          "monitor": "1m",
           "max_failure_ratio": 0.3,
           "order": "start-first"
         },
@@ -1254,7 +1163,7 @@ func fullExampleJSON(workingDir, homeDir string) string {
           "condition": "on-failure",
           "delay": "5s",
           "max_attempts": 3,
-          "window": "2m0s"
+          "window": "2m"
         },
         "placement": {
           "constraints": [
@@ -1599,9 +1508,53 @@ func fullExampleJSON(workingDir, homeDir string) string {
           }
         }
       ],
-      "working_dir": "/code"
+      "working_dir": "/code",
+      "x-bar": "baz",
+      "x-foo": "bar"
     }
   },
+  "networks": {
+    "external-network": {
+      "name": "external-network",
+      "external": true
+    },
+    "other-external-network": {
+      "name": "my-cool-network",
+      "external": true,
+      "x-bar": "baz",
+      "x-foo": "bar"
+    },
+    "other-network": {
+      "driver": "overlay",
+      "driver_opts": {
+        "baz": "1",
+        "foo": "bar"
+      },
+      "ipam": {
+        "driver": "overlay",
+        "config": [
+          {
+            "subnet": "172.28.0.0/16",
+            "gateway": "172.28.5.254",
+            "ip_range": "172.28.5.0/24",
+            "aux_addresses": {
+              "host1": "172.28.1.5",
+              "host2": "172.28.1.6",
+              "host3": "172.28.1.7"
+            }
+          },
+          {
+            "subnet": "2001:3984:3989::/64",
+            "gateway": "2001:3984:3989::1"
+          }
+        ]
+      },
+      "labels": {
+        "foo": "bar"
+      }
+    },
+    "some-network": {}
+  },
   "volumes": {
     "another-volume": {
       "name": "user_specified_name",
@@ -1609,8 +1562,7 @@ func fullExampleJSON(workingDir, homeDir string) string {
       "driver_opts": {
         "baz": "1",
         "foo": "bar"
-      },
-      "external": false
+      }
     },
     "external-volume": {
       "name": "external-volume",
@@ -1618,7 +1570,9 @@ func fullExampleJSON(workingDir, homeDir string) string {
     },
     "external-volume3": {
       "name": "this-is-volume3",
-      "external": true
+      "external": true,
+      "x-bar": "baz",
+      "x-foo": "bar"
     },
     "other-external-volume": {
       "name": "my-cool-volume",
@@ -1630,13 +1584,57 @@ func fullExampleJSON(workingDir, homeDir string) string {
         "baz": "1",
         "foo": "bar"
       },
-      "external": false,
       "labels": {
         "foo": "bar"
       }
     },
-    "some-volume": {
-      "external": false
+    "some-volume": {}
+  },
+  "secrets": {
+    "secret1": {
+      "file": "%s",
+      "labels": {
+        "foo": "bar"
+      }
+    },
+    "secret2": {
+      "name": "my_secret",
+      "external": true
+    },
+    "secret3": {
+      "name": "secret3",
+      "external": true
+    },
+    "secret4": {
+      "name": "bar",
+      "environment": "BAR",
+      "x-bar": "baz",
+      "x-foo": "bar"
+    },
+    "secret5": {
+      "file": "/abs/secret_data"
+    }
+  },
+  "configs": {
+    "config1": {
+      "file": "%s",
+      "labels": {
+        "foo": "bar"
+      }
+    },
+    "config2": {
+      "name": "my_config",
+      "external": true
+    },
+    "config3": {
+      "name": "config3",
+      "external": true
+    },
+    "config4": {
+      "name": "foo",
+      "file": "%s",
+      "x-bar": "baz",
+      "x-foo": "bar"
     }
   },
   "x-bar": "baz",
@@ -1646,13 +1644,13 @@ func fullExampleJSON(workingDir, homeDir string) string {
     "foo": "bar"
   }
 }`,
-		toPath(workingDir, "config_data"),
-		toPath(homeDir, "config_data"),
-		toPath(workingDir, "secret_data"),
 		toPath(workingDir),
 		toPath(workingDir, "static"),
 		toPath(homeDir, "configs"),
-		toPath(workingDir, "opt"))
+		toPath(workingDir, "opt"),
+		toPath(workingDir, "secret_data"),
+		toPath(workingDir, "config_data"),
+		toPath(homeDir, "config_data"))
 }
 
 func toPath(path ...string) string {
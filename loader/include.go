@@ -0,0 +1,421 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/compose-spec/compose-go/dotenv"
+	"github.com/compose-spec/compose-go/errdefs"
+	interp "github.com/compose-spec/compose-go/interpolation"
+	"github.com/compose-spec/compose-go/template"
+	"github.com/compose-spec/compose-go/types"
+	"github.com/compose-spec/compose-go/utils"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultMaxIncludeDepth is the maximum nesting of `include` sections when Options.MaxIncludeDepth is not set
+const DefaultMaxIncludeDepth = 32
+
+var transformIncludeConfig TransformerFunc = func(data interface{}) (interface{}, error) {
+	switch value := data.(type) {
+	case string:
+		return map[string]interface{}{"path": value}, nil
+	case map[string]interface{}:
+		return value, nil
+	default:
+		return data, errors.Errorf("invalid type %T for `include` configuration", value)
+	}
+}
+
+// loadInclude loads the compose applications declared by the `include` section of filename, and imports
+// their resources into model. Anchors declared by content, the source of filename, can be referenced by the
+// included files. Warnings collected while loading included applications are returned
+func loadInclude(filename string, content []byte, data interface{}, model *types.Config, configDetails types.ConfigDetails, projectName string, opts *Options) ([]string, error) {
+	var includes []types.IncludeConfig
+	if err := Transform(data, &includes, Transformer{
+		TypeOf: reflect.TypeOf(types.IncludeConfig{}),
+		Func:   transformIncludeConfig,
+	}); err != nil {
+		return nil, err
+	}
+
+	chain := append(append([]string{}, opts.includeChain...), includePath(filename, opts))
+	maxDepth := opts.MaxIncludeDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxIncludeDepth
+	}
+
+	anchors, err := includeAnchors(content, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	for _, r := range includes {
+		if len(r.Path) == 0 {
+			return nil, errors.Wrapf(errdefs.ErrInvalid, "%s: include requires a path", filename)
+		}
+		var files []types.ConfigFile
+		projectDir := ""
+		for _, p := range r.Path {
+			var content []byte
+			if remote := opts.remoteResourceLoader(p); remote != nil {
+				b, err := loadRemoteResource(remote, p, opts)
+				if err != nil {
+					return nil, err
+				}
+				content = b
+			} else {
+				p = includePath(absPath(configDetails.WorkingDir, p), opts)
+			}
+			if err := checkIncludeCycle(chain, p); err != nil {
+				return nil, err
+			}
+			files = append(files, types.ConfigFile{Filename: p, Content: content})
+			if projectDir == "" {
+				// a remote file has no local directory, the including project's one is used
+				projectDir = configDetails.WorkingDir
+				if content == nil {
+					projectDir = filepath.Dir(p)
+				}
+			}
+		}
+		if err := checkIncludeDepth(chain, files[0].Filename, maxDepth); err != nil {
+			return nil, err
+		}
+
+		if r.ProjectDirectory != "" {
+			projectDir = absPath(configDetails.WorkingDir, r.ProjectDirectory)
+		}
+		environment, err := includeEnvironment(r, configDetails, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		includeOpts := *opts
+		includeOpts.Interpolate = nil
+		includeOpts.ResolvePaths = true
+		includeOpts.SkipConsistencyCheck = true
+		includeOpts.includeChain = chain
+		includeOpts.includeAnchors = anchors
+		includeOpts.SetProjectName(projectName, true)
+		details := types.ConfigDetails{
+			WorkingDir:  projectDir,
+			ConfigFiles: files,
+			Environment: environment,
+		}
+		if opts.Interpolate != nil {
+			interpolate := *opts.Interpolate
+			interpolate.LookupValue = details.LookupEnv
+			includeOpts.Interpolate = &interpolate
+		}
+		imported, err := load(details, &includeOpts)
+		if err != nil {
+			return nil, err
+		}
+		if err := importResources(model, imported, files[0].Filename, filename); err != nil {
+			return nil, err
+		}
+		warnings = append(warnings, imported.WarningMessages...)
+	}
+	return warnings, nil
+}
+
+// checkIncludeVariables rejects `path` and `env_file` attributes of an `include` section using a variable which is
+// not set but declared by the included project's env_file, before they get interpolated. Those are resolved using the
+// including project's environment, variables declared by the included project can't be used to locate it
+func checkIncludeVariables(filename string, data interface{}, workingDir string, opts *Options) error {
+	items, ok := data.([]interface{})
+	if !ok {
+		return nil
+	}
+	lookup := opts.Interpolate.LookupValue
+	for _, item := range items {
+		var values, envFiles []string
+		switch item := item.(type) {
+		case string:
+			values = append(values, item)
+		case map[string]interface{}:
+			for _, key := range []string{"path", "env_file"} {
+				var list []string
+				switch value := item[key].(type) {
+				case string:
+					list = append(list, value)
+				case []interface{}:
+					for _, v := range value {
+						if s, ok := v.(string); ok {
+							list = append(list, s)
+						}
+					}
+				}
+				values = append(values, list...)
+				if key == "env_file" {
+					envFiles = list
+				}
+			}
+		}
+		declared := declaredVariables(workingDir, envFiles, lookup, opts)
+		for _, s := range values {
+			if name, ok := unsetVariable(s, lookup); ok && declared[name] {
+				return errors.Wrapf(errdefs.ErrInvalid, "%s: include %q uses variable %s which is only declared by the included project's env_file, "+
+					"include paths are interpolated from the including project's environment", filename, s, name)
+			}
+		}
+	}
+	return nil
+}
+
+// unsetVariable returns the first variable used by s which is not set, and has no default value, presence value
+// or required modifier. `${FOO:-}` has an empty default value, so FOO is not reported
+func unsetVariable(s string, lookup interp.LookupValue) (string, bool) {
+	for _, v := range template.ExtractVariablesFromString(s, nil) {
+		if expr := s[v.Offset:]; strings.HasPrefix(expr, "${"+v.Name) && !strings.HasPrefix(expr, "${"+v.Name+"}") {
+			continue
+		}
+		if _, ok := lookup(v.Name); !ok {
+			return v.Name, true
+		}
+	}
+	return "", false
+}
+
+// declaredVariables returns the variables declared by the env files which paths can be interpolated, relative
+// paths being resolved from workingDir. Files which can't be read are ignored, as they are reported once loaded
+func declaredVariables(workingDir string, files []string, lookup interp.LookupValue, opts *Options) map[string]bool {
+	declared := map[string]bool{}
+	for _, f := range files {
+		if _, ok := unsetVariable(f, lookup); ok {
+			continue
+		}
+		f, err := template.Substitute(f, template.Mapping(lookup))
+		if err != nil {
+			continue
+		}
+		b, err := utils.ReadFile(opts.fsys, absPath(workingDir, f))
+		if err != nil {
+			continue
+		}
+		env, err := dotenv.Parse(bytes.NewReader(b))
+		if err != nil {
+			continue
+		}
+		for k := range env {
+			declared[k] = true
+		}
+	}
+	return declared
+}
+
+// includeEnvironment returns the environment of an included project: variables declared by its env_file,
+// overridden by the including project's environment
+func includeEnvironment(r types.IncludeConfig, configDetails types.ConfigDetails, opts *Options) (map[string]string, error) {
+	environment := map[string]string{}
+	for _, f := range r.EnvFile {
+		f = absPath(configDetails.WorkingDir, f)
+		b, err := utils.ReadFile(opts.fsys, f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", f)
+		}
+		env, err := dotenv.ParseWithLookup(bytes.NewBuffer(b), func(k string) (string, bool) {
+			if v, ok := configDetails.LookupEnv(k); ok {
+				return v, true
+			}
+			v, ok := environment[k]
+			return v, ok
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", f)
+		}
+		for k, v := range env {
+			environment[k] = v
+		}
+	}
+	for k, v := range configDetails.Environment {
+		environment[k] = v
+	}
+	return environment, nil
+}
+
+// importResources adds services and resources of an included project to model, the content of including.
+// A resource which is included more than once, like by a diamond-shaped include graph, must always be defined
+// the same way, and an included service can't be redefined by including
+func importResources(model *types.Config, imported *types.Project, filename string, including string) error {
+	for _, service := range imported.AllServices() {
+		found := false
+		for _, s := range model.Services {
+			if s.Name != service.Name {
+				continue
+			}
+			if !reflect.DeepEqual(s, service) {
+				return errors.Wrapf(errdefs.ErrInvalid, "imported compose file %s defines conflicting service %s, also defined by %s",
+					filename, service.Name, including)
+			}
+			found = true
+		}
+		if !found {
+			model.Services = append(model.Services, service)
+		}
+	}
+	var err error
+	if model.Networks, err = importResource(model.Networks, imported.Networks, "network", filename); err != nil {
+		return err
+	}
+	if model.Volumes, err = importResource(model.Volumes, imported.Volumes, "volume", filename); err != nil {
+		return err
+	}
+	if model.Secrets, err = importResource(model.Secrets, imported.Secrets, "secret", filename); err != nil {
+		return err
+	}
+	model.Configs, err = importResource(model.Configs, imported.Configs, "config", filename)
+	return err
+}
+
+func importResource[T any](target map[string]T, imported map[string]T, kind string, filename string) (map[string]T, error) {
+	for name, resource := range imported {
+		if existing, ok := target[name]; ok {
+			if !reflect.DeepEqual(existing, resource) {
+				return nil, errors.Wrapf(errdefs.ErrInvalid, "imported compose file %s defines conflicting %s %s", filename, kind, name)
+			}
+			continue
+		}
+		if target == nil {
+			target = map[string]T{}
+		}
+		target[name] = resource
+	}
+	return target, nil
+}
+
+// inheritedAnchorsKey is the attribute parseYAMLWithAnchors declares the anchors inherited from including files in
+const inheritedAnchorsKey = "x-included-anchors"
+
+// includeAnchors returns the anchored nodes of content, a compose file including other ones, along with the
+// anchors it inherited from the files including it
+func includeAnchors(content []byte, opts *Options) ([]*yaml.Node, error) {
+	if len(content) == 0 {
+		return opts.includeAnchors, nil
+	}
+	var node yaml.Node
+	err := yaml.Unmarshal(content, &node)
+	if err != nil && len(opts.includeAnchors) > 0 {
+		var source []byte
+		if source, err = withAnchors(content, opts.includeAnchors); err == nil {
+			node = yaml.Node{}
+			err = yaml.Unmarshal(source, &node)
+		}
+	}
+	if err != nil {
+		// errors are reported when the file is parsed
+		return opts.includeAnchors, nil
+	}
+	var anchors []*yaml.Node
+	collectAnchors(&node, &anchors)
+	return anchors, nil
+}
+
+// collectAnchors appends the anchored nodes of a YAML tree to anchors, in document order. Anchors nested in an
+// anchored node are declared by it, so they're not collected again
+func collectAnchors(node *yaml.Node, anchors *[]*yaml.Node) {
+	if node.Anchor != "" {
+		*anchors = append(*anchors, node)
+		return
+	}
+	for _, child := range node.Content {
+		collectAnchors(child, anchors)
+	}
+}
+
+// withAnchors prepends source with a single line attribute declaring anchors, so the YAML parser can resolve
+// aliases to them. Being on the first line, it only shifts line numbers of errors by one
+func withAnchors(source []byte, anchors []*yaml.Node) ([]byte, error) {
+	declaration := &yaml.Node{
+		Kind:  yaml.MappingNode,
+		Style: yaml.FlowStyle,
+		Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: inheritedAnchorsKey},
+			{Kind: yaml.SequenceNode, Style: yaml.FlowStyle, Content: anchors},
+		},
+	}
+	b, err := yaml.Marshal(declaration)
+	if err != nil {
+		return nil, err
+	}
+	// a flow mapping is written `{key: [...]}`, while a block mapping entry is needed to merge with source
+	b = bytes.TrimSuffix(bytes.TrimPrefix(bytes.TrimSpace(b), []byte("{")), []byte("}"))
+	return append(append(b, '\n'), source...), nil
+}
+
+// parseYAMLWithAnchors parses source, a compose file which references anchors declared by the files including it
+func parseYAMLWithAnchors(source []byte, anchors []*yaml.Node) (map[string]interface{}, resetPaths, []string, error) {
+	b, err := withAnchors(source, anchors)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	dict, resets, services, err := parseYAMLWithResets(b)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	delete(dict, inheritedAnchorsKey)
+	return dict, resets, services, nil
+}
+
+// includePath returns the absolute path of an included file, as long as it's not read from a virtual filesystem
+func includePath(p string, opts *Options) string {
+	if opts.fsys == nil {
+		if abs, err := filepath.Abs(p); err == nil {
+			return abs
+		}
+	}
+	return filepath.Clean(p)
+}
+
+// checkIncludeCycle rejects including p from the chain of files being loaded if it's already part of it
+func checkIncludeCycle(chain []string, p string) error {
+	for _, included := range chain {
+		if included == p {
+			return errors.Wrap(errdefs.ErrInvalid, "include cycle detected: "+includeChainString(append(chain, p)))
+		}
+	}
+	return nil
+}
+
+// checkIncludeDepth rejects including p from the chain of files being loaded if it nests more than maxDepth includes,
+// as a safety net for include graphs the cycle detection doesn't catch
+func checkIncludeDepth(chain []string, p string, maxDepth int) error {
+	if len(chain) > maxDepth {
+		return errors.Wrapf(errdefs.ErrInvalid, "include depth exceeds the maximum of %d: %s", maxDepth, includeChainString(append(chain, p)))
+	}
+	return nil
+}
+
+// includeChainString renders a chain of included files, relative to the directory of the top-level file
+func includeChainString(chain []string) string {
+	dir := filepath.Dir(chain[0])
+	names := make([]string, len(chain))
+	for i, p := range chain {
+		names[i] = p
+		if rel, err := filepath.Rel(dir, p); err == nil {
+			names[i] = rel
+		}
+	}
+	return strings.Join(names, " -> ")
+}
@@ -0,0 +1,358 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/compose-spec/compose-go/errdefs"
+	"github.com/compose-spec/compose-go/types"
+	"gopkg.in/yaml.v3"
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+)
+
+func loadIncludeTestdata(dir string, options ...func(*Options)) (*types.Project, error) {
+	workingDir := filepath.Join("testdata", "include", dir)
+	return Load(types.ConfigDetails{
+		WorkingDir:  workingDir,
+		ConfigFiles: []types.ConfigFile{{Filename: filepath.Join(workingDir, "a.yaml")}},
+		Environment: map[string]string{},
+	}, func(o *Options) {
+		o.SetProjectName("include", true)
+	}, func(o *Options) {
+		for _, option := range options {
+			option(o)
+		}
+	})
+}
+
+func TestLoadIncludeCycle(t *testing.T) {
+	_, err := loadIncludeTestdata("cycle")
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "include cycle detected: a.yaml -> b.yaml -> a.yaml")
+}
+
+func TestLoadIncludeDiamond(t *testing.T) {
+	project, err := loadIncludeTestdata("diamond")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.ServiceNames(), []string{"a", "b", "c", "d"})
+
+	d, err := project.GetService("d")
+	assert.NilError(t, err)
+	dataDir, err := filepath.Abs(filepath.Join("testdata", "include", "diamond", "data"))
+	assert.NilError(t, err)
+	assert.Equal(t, d.Volumes[0].Source, dataDir)
+	assert.Check(t, is.Contains(project.Networks, "default"))
+	assert.Check(t, is.Contains(project.Volumes, "shared"))
+}
+
+func TestLoadIncludeMaxDepth(t *testing.T) {
+	project, err := loadIncludeTestdata("deep", func(o *Options) {
+		o.MaxIncludeDepth = 2
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.ServiceNames(), []string{"a", "b", "c"})
+
+	_, err = loadIncludeTestdata("deep", func(o *Options) {
+		o.MaxIncludeDepth = 1
+	})
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "include depth exceeds the maximum of 1: a.yaml -> b.yaml -> c.yaml")
+}
+
+func TestLoadIncludeConflictingService(t *testing.T) {
+	workingDir := filepath.Join("testdata", "include", "diamond")
+	_, err := Load(types.ConfigDetails{
+		WorkingDir: workingDir,
+		ConfigFiles: []types.ConfigFile{{Filename: filepath.Join(workingDir, "compose.yaml"), Content: []byte(`
+name: include
+include:
+  - d.yaml
+services:
+  d:
+    image: other
+`)}},
+		Environment: map[string]string{},
+	})
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "d.yaml defines conflicting service d, also defined by "+filepath.Join(workingDir, "compose.yaml"))
+}
+
+func TestLoadIncludeFlattened(t *testing.T) {
+	project, err := loadIncludeTestdata("diamond")
+	assert.NilError(t, err)
+	b, err := project.MarshalYAML()
+	assert.NilError(t, err)
+	var dict map[string]interface{}
+	assert.NilError(t, yaml.Unmarshal(b, &dict))
+	_, ok := dict["include"]
+	assert.Check(t, !ok, "include section must be inlined")
+
+	// the marshaled project is self-contained, it can be loaded from anywhere
+	flattened, err := Load(types.ConfigDetails{
+		WorkingDir:  t.TempDir(),
+		ConfigFiles: []types.ConfigFile{{Filename: "compose.yaml", Content: b}},
+		Environment: map[string]string{},
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, flattened.ServiceNames(), project.ServiceNames())
+	for _, service := range project.Services {
+		s, err := flattened.GetService(service.Name)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, s, service)
+	}
+	assert.DeepEqual(t, flattened.Volumes, project.Volumes)
+}
+
+func TestLoadIncludeInterpolatedPath(t *testing.T) {
+	workingDir := filepath.Join("testdata", "include", "interpolate")
+	load := func(content string, env map[string]string) (*types.Project, error) {
+		return Load(types.ConfigDetails{
+			WorkingDir:  workingDir,
+			ConfigFiles: []types.ConfigFile{{Filename: filepath.Join(workingDir, "compose.yaml"), Content: []byte(content)}},
+			Environment: env,
+		}, func(o *Options) {
+			o.SetProjectName("include", true)
+		})
+	}
+
+	project, err := load(`
+include:
+  - path: ${OVERLAY}/compose.yaml
+    env_file: ${OVERLAY}/overlay.env
+`, map[string]string{"OVERLAY": "overlay"})
+	assert.NilError(t, err)
+	overlay, err := project.GetService("overlay")
+	assert.NilError(t, err)
+	assert.Equal(t, overlay.Image, "overlay:latest")
+
+	project, err = load(`
+include:
+  - ${OVERLAY:-overlay}/compose.yaml
+`, map[string]string{"OVERLAY_IMAGE": "custom"})
+	assert.NilError(t, err)
+	overlay, err = project.GetService("overlay")
+	assert.NilError(t, err)
+	assert.Equal(t, overlay.Image, "custom")
+
+	_, err = load(`
+include:
+  - path: ${OVERLAY}/compose.yaml
+    env_file: overlay/overlay.env
+`, map[string]string{})
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `include "${OVERLAY}/compose.yaml" uses variable OVERLAY which is only declared by the included project's env_file`)
+
+	// variables which are not declared by the included project are replaced by a blank string
+	project, err = load(`
+include:
+  - path: ${UNSET}overlay/compose.yaml
+    env_file: ${OVERLAY:-}overlay/overlay.env
+`, map[string]string{})
+	assert.NilError(t, err)
+	overlay, err = project.GetService("overlay")
+	assert.NilError(t, err)
+	assert.Equal(t, overlay.Image, "overlay:latest")
+}
+
+func TestLoadIncludeInMemory(t *testing.T) {
+	baseDir := "virtual"
+	project, err := Load(types.ConfigDetails{
+		WorkingDir: t.TempDir(),
+		ConfigFiles: []types.ConfigFile{
+			{
+				Filename: "compose.yaml",
+				BaseDir:  baseDir,
+				Content: []byte(`
+name: in-memory
+include:
+  - lib/db.yaml
+services:
+  web:
+    extends:
+      file: common.yaml
+      service: base
+    depends_on:
+      - db
+`),
+			},
+		},
+		Environment: map[string]string{},
+	}, WithInMemoryFiles(
+		types.ConfigFile{
+			Filename: "lib/db.yaml",
+			BaseDir:  baseDir,
+			Content: []byte(`
+services:
+  db:
+    image: postgres
+`),
+		},
+		types.ConfigFile{
+			Filename: "common.yaml",
+			BaseDir:  baseDir,
+			Content: []byte(`
+services:
+  base:
+    image: nginx
+`),
+		},
+	))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.ServiceNames(), []string{"db", "web"})
+	web, err := project.GetService("web")
+	assert.NilError(t, err)
+	assert.Equal(t, web.Image, "nginx")
+}
+
+func TestLoadInMemoryExtendsConfigFile(t *testing.T) {
+	workingDir := t.TempDir()
+	compose := []byte(`
+name: in-memory
+services:
+  base:
+    image: nginx
+  web:
+    extends: base
+`)
+	override := []byte(`
+services:
+  worker:
+    extends:
+      file: compose.yaml
+      service: base
+`)
+	project, err := Load(types.ConfigDetails{
+		WorkingDir: workingDir,
+		ConfigFiles: []types.ConfigFile{
+			{Filename: filepath.Join(workingDir, "compose.yaml"), Content: compose},
+		},
+		Environment: map[string]string{},
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.ServiceNames(), []string{"base", "web"})
+
+	project, err = Load(types.ConfigDetails{
+		WorkingDir: workingDir,
+		ConfigFiles: []types.ConfigFile{
+			{Filename: filepath.Join(workingDir, "compose.yaml"), Content: compose},
+			{Filename: filepath.Join(workingDir, "override.yaml"), Content: override},
+		},
+		Environment: map[string]string{},
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.ServiceNames(), []string{"base", "web", "worker"})
+	worker, err := project.GetService("worker")
+	assert.NilError(t, err)
+	assert.Equal(t, worker.Image, "nginx")
+}
+
+func TestLoadIncludeAnchors(t *testing.T) {
+	baseDir := "virtual"
+	project, err := Load(types.ConfigDetails{
+		WorkingDir: t.TempDir(),
+		ConfigFiles: []types.ConfigFile{
+			{
+				Filename: "compose.yaml",
+				BaseDir:  baseDir,
+				Content: []byte(`
+name: include-anchors
+x-healthcheck: &healthcheck
+  test: ["CMD", "true"]
+  interval: 10s
+x-defaults: &defaults
+  image: busybox
+  healthcheck: *healthcheck
+include:
+  - lib/db.yaml
+services:
+  web:
+    <<: *defaults
+`),
+			},
+		},
+		Environment: map[string]string{},
+	}, WithInMemoryFiles(
+		types.ConfigFile{
+			Filename: "lib/db.yaml",
+			BaseDir:  baseDir,
+			Content: []byte(`
+x-logging: &logging
+  driver: syslog
+include:
+  - cache.yaml
+services:
+  db:
+    <<: *defaults
+    logging: *logging
+`),
+		},
+		types.ConfigFile{
+			Filename: "lib/cache.yaml",
+			BaseDir:  baseDir,
+			Content: []byte(`
+services:
+  cache:
+    image: redis
+    healthcheck: *healthcheck
+    logging: *logging
+`),
+		},
+	))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.ServiceNames(), []string{"cache", "db", "web"})
+	for _, name := range project.ServiceNames() {
+		service, err := project.GetService(name)
+		assert.NilError(t, err)
+		assert.Check(t, service.HealthCheck != nil, name)
+		assert.DeepEqual(t, service.HealthCheck.Test, types.HealthCheckTest{"CMD", "true"})
+	}
+	db, err := project.GetService("db")
+	assert.NilError(t, err)
+	assert.Equal(t, db.Image, "busybox")
+	assert.Equal(t, db.Logging.Driver, "syslog")
+
+	_, err = Load(types.ConfigDetails{
+		WorkingDir: t.TempDir(),
+		ConfigFiles: []types.ConfigFile{
+			{
+				Filename: "compose.yaml",
+				BaseDir:  baseDir,
+				Content: []byte(`
+name: include-anchors
+include:
+  - lib/db.yaml
+services:
+  web:
+    image: nginx
+`),
+			},
+		},
+		Environment: map[string]string{},
+	}, WithInMemoryFiles(types.ConfigFile{
+		Filename: "lib/db.yaml",
+		BaseDir:  baseDir,
+		Content: []byte(`
+services:
+  db:
+    <<: *defaults
+`),
+	}))
+	assert.ErrorContains(t, err, `undefined anchor "defaults", YAML anchors are only shared with included compose files`)
+}
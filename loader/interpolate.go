@@ -17,14 +17,20 @@
 package loader
 
 import (
+	"encoding/json"
 	"strconv"
 	"strings"
 
 	interp "github.com/compose-spec/compose-go/interpolation"
+	"github.com/compose-spec/compose-go/schema"
+	"github.com/compose-spec/compose-go/types"
 	"github.com/pkg/errors"
 )
 
-var interpolateTypeCastMapping = map[interp.Path]interp.Cast{
+// interpolateTypeCastMapping maps the attributes which don't accept a string to the cast applied to their value
+// once interpolated, so that `replicas: ${REPLICAS}` validates as an integer. Attributes not listed here are cast
+// according to the type the schema declares for them
+var interpolateTypeCastMapping = withSchemaTypeCasts(map[interp.Path]interp.Cast{
 	servicePath("configs", interp.PathMatchList, "mode"):             toInt,
 	servicePath("cpu_count"):                                         toInt64,
 	servicePath("cpu_percent"):                                       toFloat,
@@ -35,6 +41,7 @@ var interpolateTypeCastMapping = map[interp.Path]interp.Cast{
 	servicePath("cpus"):                                              toFloat32,
 	servicePath("cpu_shares"):                                        toInt64,
 	servicePath("init"):                                              toBoolean,
+	servicePath("env_file", interp.PathMatchList, "required"):        toBoolean,
 	servicePath("deploy", "replicas"):                                toInt,
 	servicePath("deploy", "update_config", "parallelism"):            toInt,
 	servicePath("deploy", "update_config", "max_failure_ratio"):      toFloat,
@@ -73,6 +80,108 @@ var interpolateTypeCastMapping = map[interp.Path]interp.Cast{
 	iPath("volumes", interp.PathMatchAll, "external"):                toBoolean,
 	iPath("secrets", interp.PathMatchAll, "external"):                toBoolean,
 	iPath("configs", interp.PathMatchAll, "external"):                toBoolean,
+})
+
+// withSchemaTypeCasts adds to mapping a cast for the attributes the schema declares as a single scalar type other
+// than string, which are not already mapped
+func withSchemaTypeCasts(mapping map[interp.Path]interp.Cast) map[interp.Path]interp.Cast {
+	var s map[string]interface{}
+	if err := json.Unmarshal([]byte(schema.Schema), &s); err != nil {
+		panic(err)
+	}
+	definitions, _ := s["definitions"].(map[string]interface{})
+	types := map[interp.Path]map[string]bool{}
+	collectSchemaTypes(s, "", definitions, map[string]bool{}, types)
+	for path, t := range types {
+		if _, ok := mapping[path]; ok || t["string"] {
+			continue
+		}
+		var casts []interp.Cast
+		if t["integer"] && !t["number"] {
+			casts = append(casts, toInt)
+		}
+		if t["number"] {
+			casts = append(casts, toFloat)
+		}
+		if t["boolean"] {
+			casts = append(casts, toBoolean)
+		}
+		if len(casts) == 1 {
+			mapping[path] = casts[0]
+		}
+	}
+	return mapping
+}
+
+// collectSchemaTypes records the types node accepts for the attribute at path, and recurses into the attributes
+// it declares. refs holds the definitions being walked, as a definition may reference itself
+func collectSchemaTypes(node map[string]interface{}, path interp.Path, definitions map[string]interface{}, refs map[string]bool, types map[interp.Path]map[string]bool) {
+	next := func(child interface{}, key string) {
+		if child, ok := child.(map[string]interface{}); ok {
+			p := interp.Path(key)
+			if path != "" {
+				p = path.Next(key)
+			}
+			collectSchemaTypes(child, p, definitions, refs, types)
+		}
+	}
+
+	if ref, ok := node["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/definitions/")
+		if definition, ok := definitions[name].(map[string]interface{}); ok && !refs[name] {
+			refs[name] = true
+			collectSchemaTypes(definition, path, definitions, refs, types)
+			delete(refs, name)
+		}
+	}
+	if path != "" {
+		if types[path] == nil {
+			types[path] = map[string]bool{}
+		}
+		switch t := node["type"].(type) {
+		case string:
+			types[path][t] = true
+		case []interface{}:
+			for _, t := range t {
+				if t, ok := t.(string); ok {
+					types[path][t] = true
+				}
+			}
+		}
+	}
+	for _, keyword := range []string{"oneOf", "anyOf", "allOf"} {
+		branches, _ := node[keyword].([]interface{})
+		for _, branch := range branches {
+			if branch, ok := branch.(map[string]interface{}); ok {
+				collectSchemaTypes(branch, path, definitions, refs, types)
+			}
+		}
+	}
+	properties, _ := node["properties"].(map[string]interface{})
+	for key, child := range properties {
+		next(child, key)
+	}
+	patterns, _ := node["patternProperties"].(map[string]interface{})
+	for _, child := range patterns {
+		next(child, interp.PathMatchAll)
+	}
+	next(node["additionalProperties"], interp.PathMatchAll)
+	next(node["items"], interp.PathMatchList)
+}
+
+// CheckVariables interpolates a compose file with env, and reports all the variables which are required but not set,
+// as well as invalid interpolation syntax, as an *interpolation.MultiError. Neither the project is loaded nor the
+// file is validated, so the check is fast enough to be run before loading
+func CheckVariables(content []byte, env types.Mapping) error {
+	dict, err := ParseYAML(content)
+	if err != nil {
+		return err
+	}
+	_, err = interp.Interpolate(dict, interp.Options{
+		LookupValue:   env.Resolve,
+		CollectErrors: true,
+	})
+	return err
 }
 
 func iPath(parts ...string) interp.Path {
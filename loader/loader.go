@@ -17,23 +17,25 @@
 package loader
 
 import (
+	"context"
 	"fmt"
+	"io/fs"
 	"os"
 	paths "path"
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/compose-spec/compose-go/consts"
+	"github.com/compose-spec/compose-go/errdefs"
 	interp "github.com/compose-spec/compose-go/interpolation"
 	"github.com/compose-spec/compose-go/schema"
 	"github.com/compose-spec/compose-go/template"
 	"github.com/compose-spec/compose-go/types"
-	"github.com/docker/go-units"
-	"github.com/mattn/go-shellwords"
+	"github.com/compose-spec/compose-go/utils"
 	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -44,6 +46,8 @@ import (
 type Options struct {
 	// Skip schema validation
 	SkipValidation bool
+	// Reject attributes not declared by the schema, except for `x-` extensions, during schema validation
+	StrictUnknownFields bool
 	// Skip interpolation
 	SkipInterpolation bool
 	// Skip normalization
@@ -54,8 +58,31 @@ type Options struct {
 	ConvertWindowsPaths bool
 	// Skip consistency check
 	SkipConsistencyCheck bool
+	// Report mutually exclusive service attributes as warnings rather than errors during consistency check
+	WarnOnConflicts bool
+	// Report `environment` and `build.args` keys which aren't valid POSIX variable names as errors rather than
+	// warnings during consistency check
+	StrictEnvironmentNames bool
+	// Skip collecting warnings about the deprecated attributes used by compose files
+	SkipDeprecationWarnings bool
+	// Omit `build.args` without a value which are not set in the environment, see WithOmitUnsetBuildArgs
+	OmitUnsetBuildArgs bool
 	// Skip extends
 	SkipExtends bool
+	// Maximum length of an `extends` chain, DefaultMaxExtendsDepth is used if not set
+	MaxExtendsDepth int
+	// Strategies to merge list attributes of services declared by multiple compose files
+	MergeOptions MergeOptions
+	// Maximum nesting of `include` sections, DefaultMaxIncludeDepth is used if not set
+	MaxIncludeDepth int
+	// Loaders for `extends.file` and `include` paths which are not on the local filesystem, like URLs
+	RemoteResourceLoaders []ResourceLoader
+	// ImageResolver rewrites the image of each service, and the `docker-image://` additional build contexts,
+	// during normalization, see WithImageResolver
+	ImageResolver func(ref string) (string, error)
+	// ExternalResourceResolver sets the name of external networks, volumes, secrets and configs during
+	// normalization, see WithExternalResourceResolver
+	ExternalResourceResolver func(kind, composeName string) (string, error)
 	// Interpolation options
 	Interpolate *interp.Options
 	// Discard 'env_file' entries after resolving to 'environment' section
@@ -66,6 +93,22 @@ type Options struct {
 	projectNameImperativelySet bool
 	// Profiles set profiles to enable
 	Profiles []string
+	// Drop networks, volumes, secrets and configs not used by the services enabled by Profiles, see
+	// WithPruneUnusedResources
+	PruneUnusedResources bool
+	// InMemoryFiles are compose files which are not loaded as such, but can be included or extended by the
+	// loaded config files, see WithInMemoryFiles
+	InMemoryFiles []types.ConfigFile
+	// Filesystem to read compose files and resources from, local filesystem is used if not set
+	fsys fs.FS
+	// Absolute paths of the compose files including the one being loaded, to detect include cycles
+	includeChain []string
+	// YAML nodes anchored by the including compose files, which aliases of the included ones can reference
+	includeAnchors []*yaml.Node
+	// Context passed to RemoteResourceLoaders, set by LoadWithContext
+	ctx context.Context
+	// Content of the in-memory compose files, by path, so they can be included or extended without reading disk
+	inMemoryFiles map[string][]byte
 }
 
 func (o *Options) SetProjectName(name string, imperativelySet bool) {
@@ -84,35 +127,52 @@ type serviceRef struct {
 	service  string
 }
 
+// DefaultMaxExtendsDepth is the maximum length of an `extends` chain when Options.MaxExtendsDepth is not set
+const DefaultMaxExtendsDepth = 32
+
 type cycleTracker struct {
 	loaded []serviceRef
 }
 
-func (ct *cycleTracker) Add(filename, service string) error {
+// Add appends a service to the `extends` chain, failing if it's already part of it, or if the chain gets longer
+// than maxDepth
+func (ct *cycleTracker) Add(filename, service string, maxDepth int) error {
 	toAdd := serviceRef{filename: filename, service: service}
 	for _, loaded := range ct.loaded {
 		if toAdd == loaded {
-			// Create an error message of the form:
-			// Circular reference:
-			//   service-a in docker-compose.yml
-			//   extends service-b in docker-compose.yml
-			//   extends service-a in docker-compose.yml
-			errLines := []string{
-				"Circular reference:",
-				fmt.Sprintf("  %s in %s", ct.loaded[0].service, ct.loaded[0].filename),
-			}
-			for _, service := range append(ct.loaded[1:], toAdd) {
-				errLines = append(errLines, fmt.Sprintf("  extends %s in %s", service.service, service.filename))
-			}
-
-			return errors.New(strings.Join(errLines, "\n"))
+			return errors.Wrapf(errdefs.ErrInvalid, "extends cycle: %s", ct.chain(toAdd))
 		}
 	}
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxExtendsDepth
+	}
+	if len(ct.loaded) > maxDepth {
+		return errors.Wrapf(errdefs.ErrInvalid, "extends depth exceeds the maximum of %d: %s", maxDepth, ct.chain(toAdd))
+	}
 
 	ct.loaded = append(ct.loaded, toAdd)
 	return nil
 }
 
+// chain renders the `extends` chain ending with last, like `a -> b -> a`. Services declared by another file than
+// the first one are qualified by the path of their file, relative to the first one
+func (ct *cycleTracker) chain(last serviceRef) string {
+	refs := append(append([]serviceRef{}, ct.loaded...), last)
+	dir := filepath.Dir(refs[0].filename)
+	names := make([]string, len(refs))
+	for i, ref := range refs {
+		names[i] = ref.service
+		if ref.filename != refs[0].filename {
+			file := ref.filename
+			if rel, err := filepath.Rel(dir, file); err == nil {
+				file = rel
+			}
+			names[i] = fmt.Sprintf("%s (%s)", ref.service, file)
+		}
+	}
+	return strings.Join(names, " -> ")
+}
+
 // WithDiscardEnvFiles sets the Options to discard the `env_file` section after resolving to
 // the `environment` section
 func WithDiscardEnvFiles(opts *Options) {
@@ -124,6 +184,15 @@ func WithSkipValidation(opts *Options) {
 	opts.SkipValidation = true
 }
 
+// WithStrictUnknownFields sets the Options to reject attributes which are not declared by the compose-spec
+// schema, with the path of the offending attribute, rather than ignore them. Extension `x-` attributes are
+// still permitted
+func WithStrictUnknownFields() func(*Options) {
+	return func(opts *Options) {
+		opts.StrictUnknownFields = true
+	}
+}
+
 // WithProfiles sets profiles to be activated
 func WithProfiles(profiles []string) func(*Options) {
 	return func(opts *Options) {
@@ -131,13 +200,103 @@ func WithProfiles(profiles []string) func(*Options) {
 	}
 }
 
+// WithPruneUnusedResources sets the Options to drop the networks, volumes, secrets and configs which are not used
+// by any service enabled by the selected profiles. Pruned resources are reported by Project.Warnings
+func WithPruneUnusedResources(opts *Options) {
+	opts.PruneUnusedResources = true
+}
+
+// WithInMemoryFiles sets compose files, set with Content, which can be included or extended by the loaded
+// config files using their Filename relative to their BaseDir, or the working directory, before disk is read.
+// Unlike ConfigDetails.ConfigFiles, those are only loaded when referenced
+func WithInMemoryFiles(files ...types.ConfigFile) func(*Options) {
+	return func(opts *Options) {
+		opts.InMemoryFiles = append(opts.InMemoryFiles, files...)
+	}
+}
+
+// WithFS sets the filesystem to read compose files, extended files and env_file from.
+// Paths are resolved against the virtual working directory and are not made absolute
+func WithFS(fsys fs.FS) func(*Options) {
+	return func(opts *Options) {
+		opts.fsys = fsys
+	}
+}
+
 // ParseYAML reads the bytes from a file, parses the bytes into a mapping
 // structure, and returns it.
+// Attributes tagged `!reset` are removed.
 func ParseYAML(source []byte) (map[string]interface{}, error) {
-	var cfg interface{}
-	if err := yaml.Unmarshal(source, &cfg); err != nil {
-		return nil, err
+	dict, _, _, err := parseYAMLWithResets(source)
+	return dict, err
+}
+
+// duplicateKeysSections are the top-level sections checked by checkDuplicateKeys
+var duplicateKeysSections = []string{"services", "networks", "volumes", "secrets", "configs"}
+
+// checkDuplicateKeys reports top-level sections, or services and resources, declared more than once in a
+// compose file, with the lines of both declarations
+func checkDuplicateKeys(node *yaml.Node) error {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	if err := duplicateKey(node, ""); err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		for _, section := range duplicateKeysSections {
+			if node.Content[i].Value == section && node.Content[i+1].Kind == yaml.MappingNode {
+				if err := duplicateKey(node.Content[i+1], section+"."); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func duplicateKey(node *yaml.Node, prefix string) error {
+	seen := map[string]*yaml.Node{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if key.Tag == "!!merge" {
+			continue
+		}
+		if first, ok := seen[key.Value]; ok {
+			return &LoadError{
+				Line:   key.Line,
+				Column: key.Column,
+				Path:   prefix + key.Value,
+				Err: errors.Wrapf(errdefs.ErrInvalid, "%s%s is defined more than once, at lines %d and %d",
+					prefix, key.Value, first.Line, key.Line),
+			}
+		}
+		seen[key.Value] = key
 	}
+	return nil
+}
+
+// forceStringKeys makes mapping keys which look like numbers, booleans or dates, like a service named `123`
+// or a `2024` label, decode as strings. Merge keys are left untouched
+func forceStringKeys(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			switch key.ShortTag() {
+			case "!!int", "!!float", "!!bool", "!!timestamp":
+				key.Tag = "!!str"
+			}
+		}
+	}
+	for _, n := range node.Content {
+		forceStringKeys(n)
+	}
+}
+
+func toStringKeysMap(cfg interface{}) (map[string]interface{}, error) {
 	stringMap, ok := cfg.(map[string]interface{})
 	if ok {
 		converted, err := convertToStringKeysRecursive(stringMap, "")
@@ -159,96 +318,153 @@ func ParseYAML(source []byte) (map[string]interface{}, error) {
 
 // Load reads a ConfigDetails and returns a fully loaded configuration
 func Load(configDetails types.ConfigDetails, options ...func(*Options)) (*types.Project, error) {
+	return LoadWithContext(context.Background(), configDetails, options...)
+}
+
+// LoadWithContext reads a ConfigDetails and returns a fully loaded configuration. ctx is passed to the
+// RemoteResourceLoaders used to load extended and included compose files
+func LoadWithContext(ctx context.Context, configDetails types.ConfigDetails, options ...func(*Options)) (*types.Project, error) {
 	if len(configDetails.ConfigFiles) < 1 {
 		return nil, errors.Errorf("No files specified")
 	}
 
-	opts := &Options{
-		Interpolate: &interp.Options{
-			Substitute:      template.Substitute,
-			LookupValue:     configDetails.LookupEnv,
-			TypeCastMapping: interpolateTypeCastMapping,
-		},
+	opts := toOptions(configDetails, options)
+	opts.ctx = ctx
+	opts.inMemoryFiles = map[string][]byte{}
+	for _, file := range append(opts.InMemoryFiles, configDetails.ConfigFiles...) {
+		if len(file.Content) > 0 {
+			opts.inMemoryFiles[inMemoryPath(file, configDetails, opts)] = file.Content
+		}
 	}
+	return load(configDetails, opts)
+}
 
-	for _, op := range options {
-		op(opts)
+// inMemoryPath returns the path an in-memory config file can be included or extended by
+func inMemoryPath(file types.ConfigFile, configDetails types.ConfigDetails, opts *Options) string {
+	dir := file.BaseDir
+	if dir == "" {
+		dir = configDetails.WorkingDir
+	}
+	return includePath(absPath(dir, file.Filename), opts)
+}
+
+// readFile reads an included or extended compose file, from the in-memory config files if one was set with this path
+func (o *Options) readFile(path string) ([]byte, error) {
+	if content, ok := o.inMemoryFiles[includePath(path, o)]; ok {
+		return content, nil
 	}
+	return utils.ReadFile(o.fsys, path)
+}
 
+func load(configDetails types.ConfigDetails, opts *Options) (*types.Project, error) {
 	projectName, err := projectName(configDetails, opts)
 	if err != nil {
 		return nil, err
 	}
 
 	var configs []*types.Config
+	var resets []resetPaths
+	var warnings []string
+	var servicesOrder []string
 	for i, file := range configDetails.ConfigFiles {
+		fileDetails := configDetails
+		if file.BaseDir != "" {
+			fileDetails.WorkingDir = file.BaseDir
+		}
 		configDict := file.Config
+		var fileResets resetPaths
 		if configDict == nil {
 			if len(file.Content) == 0 {
-				content, err := os.ReadFile(file.Filename)
+				content, err := opts.readFile(file.Filename)
 				if err != nil {
 					return nil, err
 				}
 				file.Content = content
 			}
-			dict, err := parseConfig(file.Content, opts)
+			dict, r, services, err := parseConfig(file.Filename, file.Content, fileDetails.WorkingDir, opts)
 			if err != nil {
-				return nil, err
+				return nil, yamlLoadError(file.Filename, err)
 			}
 			configDict = dict
+			fileResets = r
+			servicesOrder = unique(append(servicesOrder, services...))
 			file.Config = dict
 			configDetails.ConfigFiles[i] = file
 		}
 
 		if !opts.SkipValidation {
-			if err := schema.Validate(configDict); err != nil {
-				return nil, err
+			validate := schema.Validate
+			if opts.StrictUnknownFields {
+				validate = schema.ValidateStrict
+			}
+			if err := validate(configDict); err != nil {
+				return nil, schemaLoadError(file.Filename, file.Content, err)
 			}
 		}
 
+		if !opts.SkipDeprecationWarnings {
+			warnings = append(warnings, deprecationWarnings(file.Filename, configDict)...)
+		}
+
 		configDict = groupXFieldsIntoExtensions(configDict)
 
-		cfg, err := loadSections(file.Filename, configDict, configDetails, opts)
+		cfg, err := loadSections(file.Filename, configDict, fileDetails, opts)
 		if err != nil {
 			return nil, err
 		}
+		if include, ok := configDict["include"]; ok {
+			included, err := loadInclude(file.Filename, file.Content, include, cfg, fileDetails, projectName, opts)
+			if err != nil {
+				return nil, err
+			}
+			warnings = append(warnings, included...)
+		}
 		configs = append(configs, cfg)
+		resets = append(resets, fileResets)
 	}
 
-	model, err := merge(configs)
+	model, err := merge(configs, resets, opts.MergeOptions)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, s := range model.Services {
-		var newEnvFiles types.StringList
-		for _, ef := range s.EnvFile {
-			newEnvFiles = append(newEnvFiles, absPath(configDetails.WorkingDir, ef))
-		}
-		s.EnvFile = newEnvFiles
-	}
-
 	project := &types.Project{
-		Name:        projectName,
-		WorkingDir:  configDetails.WorkingDir,
-		Services:    model.Services,
-		Networks:    model.Networks,
-		Volumes:     model.Volumes,
-		Secrets:     model.Secrets,
-		Configs:     model.Configs,
-		Environment: configDetails.Environment,
-		Extensions:  model.Extensions,
+		Name:            projectName,
+		WorkingDir:      configDetails.WorkingDir,
+		Services:        model.Services,
+		Networks:        model.Networks,
+		Volumes:         model.Volumes,
+		Secrets:         model.Secrets,
+		Configs:         model.Configs,
+		Environment:     configDetails.Environment,
+		Extensions:      model.Extensions,
+		ServicesOrder:   servicesOrder,
+		WarningMessages: warnings,
+	}
+	for _, r := range resets {
+		project.ResetPaths = append(project.ResetPaths, r...)
 	}
 
 	if !opts.SkipNormalization {
-		err = Normalize(project, opts.ResolvePaths)
+		err = normalize(project, opts.ResolvePaths, normalizeOptions{
+			fsys: opts.fsys,
+			// included projects get the default network once imported
+			withoutDefaultNetwork: len(opts.includeChain) > 0,
+			omitUnsetBuildArgs:    opts.OmitUnsetBuildArgs,
+			imageResolver:         opts.ImageResolver,
+			externalResolver:      opts.ExternalResourceResolver,
+		})
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	if !opts.SkipConsistencyCheck {
-		err = checkConsistency(project)
+		err = checkConsistency(project, opts.WarnOnConflicts)
+		if err != nil {
+			return nil, err
+		}
+		err = checkEnvironmentNames(project, opts.StrictEnvironmentNames)
 		if err != nil {
 			return nil, err
 		}
@@ -258,12 +474,41 @@ func Load(configDetails types.ConfigDetails, options ...func(*Options)) (*types.
 		opts.Profiles = strings.Split(profiles, ",")
 	}
 	project.ApplyProfiles(opts.Profiles)
+	if opts.PruneUnusedResources && len(opts.includeChain) == 0 {
+		// included projects are pruned once imported, as their resources may be used by the including one
+		for _, resource := range project.PruneUnusedResources() {
+			if resource.Kind == "network" && resource.Name == "default" {
+				// the default network is implicitly declared, it's only created for services using it
+				continue
+			}
+			project.WarningMessages = append(project.WarningMessages,
+				fmt.Sprintf("%s is not used by any enabled service, it has been pruned", resource))
+		}
+	}
+
+	if !opts.SkipConsistencyCheck {
+		project.WarningMessages = append(project.WarningMessages, checkPortConflicts(project.Services)...)
+	}
 
-	err = project.ResolveServicesEnvironment(opts.discardEnvFiles)
+	err = project.ResolveServicesEnvironmentFS(opts.fsys, opts.discardEnvFiles)
 
 	return project, err
 }
 
+func toOptions(configDetails types.ConfigDetails, options []func(*Options)) *Options {
+	opts := &Options{
+		Interpolate: &interp.Options{
+			LookupValue:     configDetails.LookupEnv,
+			TypeCastMapping: interpolateTypeCastMapping,
+		},
+	}
+
+	for _, op := range options {
+		op(opts)
+	}
+	return opts
+}
+
 func InvalidProjectNameErr(v string) error {
 	return fmt.Errorf(
 		"%q is not a valid project name: it must contain only "+
@@ -278,13 +523,23 @@ func projectName(details types.ConfigDetails, opts *Options) (string, error) {
 	// in any of the config files
 	if !projectNameImperativelySet {
 		var pjNameFromConfigFile string
-		for _, configFile := range details.ConfigFiles {
+		for i, configFile := range details.ConfigFiles {
+			if configFile.Config == nil && len(configFile.Content) == 0 {
+				content, err := opts.readFile(configFile.Filename)
+				if err != nil {
+					// reported when the file gets loaded
+					continue
+				}
+				// keep the content so the file is not read twice
+				details.ConfigFiles[i].Content = content
+				configFile.Content = content
+			}
 			yml, err := ParseYAML(configFile.Content)
 			if err != nil {
 				return "", nil
 			}
-			if val, ok := yml["name"]; ok && val != "" {
-				pjNameFromConfigFile = yml["name"].(string)
+			if val, ok := yml["name"].(string); ok && val != "" {
+				pjNameFromConfigFile = val
 			}
 		}
 		if !opts.SkipInterpolation {
@@ -312,7 +567,7 @@ func projectName(details types.ConfigDetails, opts *Options) (string, error) {
 	}
 
 	// TODO(milas): this should probably ALWAYS set (overriding any existing)
-	if _, ok := details.Environment[consts.ComposeProjectName]; !ok && projectName != "" {
+	if _, ok := details.Environment[consts.ComposeProjectName]; !ok && projectName != "" && details.Environment != nil {
 		details.Environment[consts.ComposeProjectName] = projectName
 	}
 	return projectName, nil
@@ -325,15 +580,95 @@ func NormalizeProjectName(s string) string {
 	return strings.TrimLeft(s, "_-")
 }
 
-func parseConfig(b []byte, opts *Options) (map[string]interface{}, error) {
-	yml, err := ParseYAML(b)
+// parseConfig parses and interpolates a compose file. workingDir is the directory the file's relative paths are
+// resolved from
+func parseConfig(filename string, b []byte, workingDir string, opts *Options) (map[string]interface{}, resetPaths, []string, error) {
+	yml, resets, services, err := parseYAMLWithResets(b)
+	if err != nil && len(opts.includeAnchors) > 0 && unknownAnchor.MatchString(err.Error()) {
+		yml, resets, services, err = parseYAMLWithAnchors(b, opts.includeAnchors)
+	}
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, anchorError(filename, err)
 	}
 	if !opts.SkipInterpolation {
-		return interp.Interpolate(yml, *opts.Interpolate)
+		if include, ok := yml["include"]; ok {
+			if err := checkIncludeVariables(filename, include, workingDir, opts); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		if services, ok := yml["services"]; ok {
+			if err := checkEnvFileVariables(filename, services, workingDir, opts); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		yml, err = interp.Interpolate(yml, *opts.Interpolate)
+	}
+	return yml, resets, services, err
+}
+
+// checkEnvFileVariables rejects `env_file` paths using a variable which is not set but declared by one of the
+// service's env_file, before they get interpolated. Those are resolved using the project environment, variables
+// declared by an env_file can't be used to locate another one. Optional env_file are not checked
+func checkEnvFileVariables(filename string, data interface{}, workingDir string, opts *Options) error {
+	services, ok := data.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lookup := opts.Interpolate.LookupValue
+	for _, name := range names {
+		service, ok := services[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var files, required []string
+		switch value := service["env_file"].(type) {
+		case string:
+			files = append(files, value)
+			required = append(required, value)
+		case []interface{}:
+			for _, item := range value {
+				switch item := item.(type) {
+				case string:
+					files = append(files, item)
+					required = append(required, item)
+				case map[string]interface{}:
+					path, ok := item["path"].(string)
+					if !ok {
+						continue
+					}
+					files = append(files, path)
+					if r, ok := item["required"].(bool); !ok || r {
+						required = append(required, path)
+					}
+				}
+			}
+		}
+		declared := declaredVariables(workingDir, files, lookup, opts)
+		for _, s := range required {
+			if variable, ok := unsetVariable(s, lookup); ok && declared[variable] {
+				return errors.Wrapf(errdefs.ErrInvalid, "%s: service %q env_file %q uses variable %s which is only declared by an env_file, "+
+					"env_file paths are interpolated from the project environment", filename, name, s, variable)
+			}
+		}
+	}
+	return nil
+}
+
+var unknownAnchor = regexp.MustCompile(`unknown anchor '(.*)' referenced`)
+
+// anchorError makes a YAML error about an undefined anchor point at the file it was referenced from,
+// as anchors are scoped to a single compose file, and the ones including it
+func anchorError(filename string, err error) error {
+	matches := unknownAnchor.FindStringSubmatch(err.Error())
+	if matches == nil {
+		return err
 	}
-	return yml, err
+	return errors.Wrapf(errdefs.ErrInvalid, "%s: undefined anchor %q, YAML anchors are only shared with included compose files", filename, matches[1])
 }
 
 const extensions = "#extensions" // Using # prefix, we prevent risk to conflict with an actual yaml key
@@ -459,14 +794,17 @@ func createTransformHook(additionalTransformers ...Transformer) mapstructure.Dec
 		reflect.TypeOf(types.MappingWithEquals{}):                transformMappingOrListFunc("=", true),
 		reflect.TypeOf(types.Labels{}):                           transformMappingOrListFunc("=", false),
 		reflect.TypeOf(types.MappingWithColon{}):                 transformMappingOrListFunc(":", false),
-		reflect.TypeOf(types.HostsList{}):                        transformMappingOrListFunc(":", false),
+		reflect.TypeOf(types.HostsList{}):                        transformHostsList,
 		reflect.TypeOf(types.ServiceVolumeConfig{}):              transformServiceVolumeConfig,
 		reflect.TypeOf(types.BuildConfig{}):                      transformBuildConfig,
 		reflect.TypeOf(types.Duration(0)):                        transformStringToDuration,
 		reflect.TypeOf(types.DependsOnConfig{}):                  transformDependsOnConfig,
 		reflect.TypeOf(types.ExtendsConfig{}):                    transformExtendsConfig,
 		reflect.TypeOf(types.DeviceRequest{}):                    transformServiceDeviceRequest,
+		reflect.TypeOf(types.GpusConfig{}):                       transformGpusConfig,
 		reflect.TypeOf(types.SSHConfig{}):                        transformSSHConfig,
+		reflect.TypeOf([]types.EnvFile{}):                        transformEnvFiles,
+		reflect.TypeOf(types.EnvFile{}):                          transformEnvFile,
 	}
 
 	for _, transformer := range additionalTransformers {
@@ -572,7 +910,7 @@ func LoadServices(filename string, servicesDict map[string]interface{}, workingD
 }
 
 func loadServiceWithExtends(filename, name string, servicesDict map[string]interface{}, workingDir string, lookupEnv template.Mapping, opts *Options, ct *cycleTracker) (*types.ServiceConfig, error) {
-	if err := ct.Add(filename, name); err != nil {
+	if err := ct.Add(filename, name, opts.MaxExtendsDepth); err != nil {
 		return nil, err
 	}
 
@@ -602,41 +940,63 @@ func loadServiceWithExtends(filename, name string, servicesDict map[string]inter
 		} else {
 			// Resolve the path to the imported file, and load it.
 			baseFilePath := absPath(workingDir, file)
-
-			b, err := os.ReadFile(baseFilePath)
+			baseWorkingDir := filepath.Dir(baseFilePath)
+
+			var b []byte
+			remote := opts.remoteResourceLoader(file)
+			if remote == nil && !filepath.IsAbs(file) && opts.remoteResourceLoader(filename) != nil {
+				// a relative extends.file in a remote file, like an included one, is located next to it
+				if sibling := remoteSibling(filename, file); opts.remoteResourceLoader(sibling) != nil {
+					file = sibling
+					remote = opts.remoteResourceLoader(file)
+				}
+			}
+			if remote != nil {
+				// relative paths in a remote file are resolved against the extending file's directory
+				baseFilePath, baseWorkingDir = file, workingDir
+				b, err = loadRemoteResource(remote, file, opts)
+			} else {
+				b, err = opts.readFile(baseFilePath)
+			}
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, errors.Wrapf(errdefs.ErrNotFound, "cannot extend service %q in %s: extends.file %s (resolved to %s) does not exist",
+					name, filename, file, baseFilePath)
+			}
 			if err != nil {
 				return nil, err
 			}
 
-			baseFile, err := parseConfig(b, opts)
+			baseFile, _, _, err := parseConfig(baseFilePath, b, baseWorkingDir, opts)
 			if err != nil {
 				return nil, err
 			}
 
 			baseFileServices := getSection(baseFile, "services")
-			baseService, err = loadServiceWithExtends(baseFilePath, baseServiceName, baseFileServices, filepath.Dir(baseFilePath), lookupEnv, opts, ct)
+			baseService, err = loadServiceWithExtends(baseFilePath, baseServiceName, baseFileServices, baseWorkingDir, lookupEnv, opts, ct)
 			if err != nil {
 				return nil, err
 			}
 
-			// Make paths relative to the importing Compose file. Note that we
-			// make the paths relative to `file` rather than `baseFilePath` so
-			// that the resulting paths won't be absolute if `file` isn't an
-			// absolute path.
-			baseFileParent := filepath.Dir(file)
-			if baseService.Build != nil {
-				baseService.Build.Context = resolveBuildContextPath(baseFileParent, baseService.Build.Context)
-			}
+			if remote == nil {
+				// Make paths relative to the importing Compose file. Note that we
+				// make the paths relative to `file` rather than `baseFilePath` so
+				// that the resulting paths won't be absolute if `file` isn't an
+				// absolute path.
+				baseFileParent := filepath.Dir(file)
+				if baseService.Build != nil {
+					baseService.Build.Context = resolveBuildContextPath(baseFileParent, baseService.Build.Context)
+				}
 
-			for i, vol := range baseService.Volumes {
-				if vol.Type != types.VolumeTypeBind {
-					continue
+				for i, vol := range baseService.Volumes {
+					if vol.Type != types.VolumeTypeBind {
+						continue
+					}
+					baseService.Volumes[i].Source = resolveMaybeUnixPath(vol.Source, baseFileParent, lookupEnv)
 				}
-				baseService.Volumes[i].Source = resolveMaybeUnixPath(vol.Source, baseFileParent, lookupEnv)
-			}
 
-			for i, envFile := range baseService.EnvFile {
-				baseService.EnvFile[i] = resolveMaybeUnixPath(envFile, baseFileParent, lookupEnv)
+				for i, envFile := range baseService.EnvFile {
+					baseService.EnvFile[i].Path = resolveMaybeUnixPath(envFile.Path, baseFileParent, lookupEnv)
+				}
 			}
 		}
 
@@ -650,13 +1010,23 @@ func loadServiceWithExtends(filename, name string, servicesDict map[string]inter
 	return serviceConfig, nil
 }
 
-func resolveBuildContextPath(baseFileParent string, context string) string {
-	// Checks if the context is an HTTP(S) URL or a remote git repository URL
-	for _, prefix := range []string{"https://", "http://", "git://", "github.com/", "git@"} {
+// remoteContextPrefixes are the prefixes of build contexts which are an HTTP(S) URL or a remote git repository
+var remoteContextPrefixes = []string{"https://", "http://", "git://", "ssh://", "github.com/", "git@"}
+
+// isRemoteContext checks if a build context is a remote git repository or a tarball URL, rather than a local path
+func isRemoteContext(context string) bool {
+	for _, prefix := range remoteContextPrefixes {
 		if strings.HasPrefix(context, prefix) {
-			return context
+			return true
 		}
 	}
+	return false
+}
+
+func resolveBuildContextPath(baseFileParent string, context string) string {
+	if isRemoteContext(context) {
+		return context
+	}
 
 	// Note that the Dockerfile is always defined relative to the
 	// build context, so there's no need to update the Dockerfile field.
@@ -673,6 +1043,18 @@ func LoadService(name string, serviceDict map[string]interface{}, workingDir str
 		return nil, err
 	}
 	serviceConfig.Name = name
+	serviceConfig.CommandForm = commandForm(serviceDict["command"])
+	serviceConfig.EntrypointForm = commandForm(serviceDict["entrypoint"])
+	policy, err := types.ParsePullPolicy(serviceConfig.PullPolicy)
+	if err != nil {
+		return nil, errors.Wrapf(errdefs.ErrInvalid, "service %q: %s", name, err)
+	}
+	serviceConfig.PullPolicy = policy
+	signal, err := types.ParseSignal(serviceConfig.StopSignal)
+	if err != nil {
+		return nil, errors.Wrapf(errdefs.ErrInvalid, "service %q: %s", name, err)
+	}
+	serviceConfig.StopSignal = signal
 
 	for i, volume := range serviceConfig.Volumes {
 		if volume.Type != types.VolumeTypeBind {
@@ -784,7 +1166,6 @@ func LoadNetworks(source map[string]interface{}) (map[string]types.NetworkConfig
 			if network.Name != "" {
 				return nil, errors.Errorf("network %s: network.external.name and network.name conflict; only use network.name", name)
 			}
-			logrus.Warnf("network %s: network.external.name is deprecated. Please set network.name with external: true", name)
 			network.Name = network.External.Name
 			network.External.Name = ""
 		case network.Name == "":
@@ -824,7 +1205,6 @@ func LoadVolumes(source map[string]interface{}) (map[string]types.VolumeConfig,
 			if volume.Name != "" {
 				return nil, errors.Errorf("volume %s: volume.external.name and volume.name conflict; only use volume.name", name)
 			}
-			logrus.Warnf("volume %s: volume.external.name is deprecated in favor of volume.name", name)
 			volume.Name = volume.External.Name
 			volume.External.Name = ""
 		case volume.Name == "":
@@ -875,6 +1255,16 @@ func LoadConfigObjs(source map[string]interface{}, details types.ConfigDetails,
 }
 
 func loadFileObjectConfig(name string, objType string, obj types.FileObjectConfig, details types.ConfigDetails, resolvePaths bool) (types.FileObjectConfig, error) {
+	sources := 0
+	for _, set := range []bool{obj.File != "", obj.Environment != "", obj.External.External} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return obj, errors.Wrapf(errdefs.ErrInvalid, "%[1]s %[2]s: %[1]s.file, %[1]s.environment and %[1]s.external are mutually exclusive", objType, name)
+	}
+
 	// if "external: true"
 	switch {
 	case obj.External.External:
@@ -883,7 +1273,6 @@ func loadFileObjectConfig(name string, objType string, obj types.FileObjectConfi
 			if obj.Name != "" {
 				return obj, errors.Errorf("%[1]s %[2]s: %[1]s.external.name and %[1]s.name conflict; only use %[1]s.name", objType, name)
 			}
-			logrus.Warnf("%[1]s %[2]s: %[1]s.external.name is deprecated in favor of %[1]s.name", objType, name)
 			obj.Name = obj.External.Name
 			obj.External.Name = ""
 		} else if obj.Name == "" {
@@ -894,6 +1283,12 @@ func loadFileObjectConfig(name string, objType string, obj types.FileObjectConfi
 		if obj.File != "" {
 			return obj, errors.Errorf("%[1]s %[2]s: %[1]s.driver and %[1]s.file conflict; only use %[1]s.driver", objType, name)
 		}
+	case obj.Environment != "":
+		value, ok := details.LookupEnv(obj.Environment)
+		if !ok {
+			return obj, errors.Wrapf(errdefs.ErrInvalid, "%s %s: environment variable %q is not set", objType, name, obj.Environment)
+		}
+		obj.Content = value
 	default:
 		if obj.File != "" && resolvePaths {
 			obj.File = absPath(details.WorkingDir, obj.File)
@@ -984,23 +1379,47 @@ var transformServiceDeviceRequest TransformerFunc = func(data interface{}) (inte
 		if ok {
 			switch val := count.(type) {
 			case int:
-				return value, nil
 			case string:
-				if strings.ToLower(val) == "all" {
-					value["count"] = -1
-					return value, nil
+				if strings.ToLower(val) != "all" {
+					return data, errors.Errorf("invalid string value for 'count' (the only value allowed is 'all')")
 				}
-				return data, errors.Errorf("invalid string value for 'count' (the only value allowed is 'all')")
+				value["count"] = -1
 			default:
 				return data, errors.Errorf("invalid type %T for device count", val)
 			}
 		}
-		return data, nil
+		return groupXFieldsIntoExtensions(value), nil
 	default:
 		return data, errors.Errorf("invalid type %T for resource reservation", value)
 	}
 }
 
+// transformGpusConfig expands the `gpus: all` short syntax into a device request for all GPUs.
+// Device requests which don't declare capabilities are requests for the `gpu` capability
+var transformGpusConfig TransformerFunc = func(data interface{}) (interface{}, error) {
+	switch value := data.(type) {
+	case string:
+		if strings.ToLower(value) != "all" {
+			return data, errors.Errorf("invalid string value for 'gpus' (the only value allowed is 'all')")
+		}
+		return []interface{}{map[string]interface{}{
+			"count":        -1,
+			"capabilities": []interface{}{"gpu"},
+		}}, nil
+	case []interface{}:
+		for _, item := range value {
+			if device, ok := item.(map[string]interface{}); ok {
+				if _, ok := device["capabilities"]; !ok {
+					device["capabilities"] = []interface{}{"gpu"}
+				}
+			}
+		}
+		return value, nil
+	default:
+		return data, errors.Errorf("invalid type %T for gpus", value)
+	}
+}
+
 var transformFileReferenceConfig TransformerFunc = func(data interface{}) (interface{}, error) {
 	switch value := data.(type) {
 	case string:
@@ -1145,6 +1564,54 @@ var transformStringList TransformerFunc = func(data interface{}) (interface{}, e
 	}
 }
 
+var transformEnvFiles TransformerFunc = func(data interface{}) (interface{}, error) {
+	switch value := data.(type) {
+	case string:
+		return []interface{}{value}, nil
+	case []interface{}:
+		return value, nil
+	default:
+		return data, errors.Errorf("invalid type %T for env_file", value)
+	}
+}
+
+var transformEnvFile TransformerFunc = func(data interface{}) (interface{}, error) {
+	switch value := data.(type) {
+	case string:
+		return map[string]interface{}{
+			"path":     value,
+			"required": true,
+		}, nil
+	case map[string]interface{}:
+		if _, ok := value["required"]; !ok {
+			value["required"] = true
+		}
+		return value, nil
+	default:
+		return data, errors.Errorf("invalid type %T for env_file", value)
+	}
+}
+
+var transformHostsList TransformerFunc = func(data interface{}) (interface{}, error) {
+	switch value := data.(type) {
+	case map[string]interface{}:
+		hosts := types.HostsList{}
+		for host, ip := range toMapStringString(value, false) {
+			if err := hosts.Add(host, fmt.Sprint(ip)); err != nil {
+				return data, err
+			}
+		}
+		return hosts, nil
+	case []interface{}:
+		entries := make([]string, len(value))
+		for i, entry := range value {
+			entries[i] = fmt.Sprint(entry)
+		}
+		return types.NewHostsList(entries)
+	}
+	return data, errors.Errorf("invalid type %T for extra_hosts", data)
+}
+
 func transformMappingOrListFunc(sep string, allowNil bool) TransformerFunc {
 	return func(data interface{}) (interface{}, error) {
 		return transformMappingOrList(data, sep, allowNil)
@@ -1181,11 +1648,23 @@ func transformValueToMapEntry(value string, separator string, allowNil bool) (st
 
 var transformShellCommand TransformerFunc = func(value interface{}) (interface{}, error) {
 	if str, ok := value.(string); ok {
-		return shellwords.Parse(str)
+		return types.ParseShellCommand(str)
 	}
 	return value, nil
 }
 
+// commandForm tells the form a service `command` or `entrypoint` is declared with, if set
+func commandForm(value interface{}) types.CommandForm {
+	switch value.(type) {
+	case string:
+		return types.CommandFormShell
+	case []interface{}:
+		return types.CommandFormExec
+	default:
+		return ""
+	}
+}
+
 var transformHealthCheckTest TransformerFunc = func(data interface{}) (interface{}, error) {
 	switch value := data.(type) {
 	case string:
@@ -1204,7 +1683,7 @@ var transformSize TransformerFunc = func(value interface{}) (interface{}, error)
 	case int64, types.UnitBytes:
 		return value, nil
 	case string:
-		return units.RAMInBytes(value)
+		return types.ParseUnitBytes(value)
 	default:
 		return value, errors.Errorf("invalid type for size %T", value)
 	}
@@ -1213,11 +1692,11 @@ var transformSize TransformerFunc = func(value interface{}) (interface{}, error)
 var transformStringToDuration TransformerFunc = func(value interface{}) (interface{}, error) {
 	switch value := value.(type) {
 	case string:
-		d, err := time.ParseDuration(value)
+		d, err := types.ParseDuration(value)
 		if err != nil {
 			return value, err
 		}
-		return types.Duration(d), nil
+		return d, nil
 	case types.Duration:
 		return value, nil
 	default:
@@ -18,12 +18,14 @@ package loader
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -31,6 +33,9 @@ import (
 	"gotest.tools/v3/assert"
 	is "gotest.tools/v3/assert/cmp"
 
+	"github.com/compose-spec/compose-go/consts"
+	"github.com/compose-spec/compose-go/errdefs"
+	interp "github.com/compose-spec/compose-go/interpolation"
 	"github.com/compose-spec/compose-go/types"
 )
 
@@ -304,6 +309,25 @@ func TestLoadFromFile(t *testing.T) {
 	assert.Check(t, is.DeepEqual(sampleConfig.Volumes, actual.Volumes))
 }
 
+func generateServices(count int) string {
+	var b strings.Builder
+	b.WriteString("name: bench\nservices:\n")
+	for i := 0; i < count; i++ {
+		fmt.Fprintf(&b, "  service_%d:\n    image: busybox\n    environment:\n      - FOO=%d\n    ports:\n      - %d:80\n", i, i, 1024+i)
+	}
+	return b.String()
+}
+
+func BenchmarkLoad(b *testing.B) {
+	yaml := generateServices(500)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Load(buildConfigDetails(yaml, nil)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func TestLoadExtensions(t *testing.T) {
 	actual, err := loadYAML(`
 name: load-extensions
@@ -395,41 +419,39 @@ func TestInvalidTopLevelObjectType(t *testing.T) {
 
 func TestNonStringKeys(t *testing.T) {
 	_, err := loadYAML(`
-123:
-  foo:
-    image: busybox
-`)
-	assert.ErrorContains(t, err, "Non-string key at top level: 123")
-
-	_, err = loadYAML(`
-services:
-  foo:
-    image: busybox
-  123:
-    image: busybox
-`)
-	assert.ErrorContains(t, err, "Non-string key in services: 123")
-
-	_, err = loadYAML(`
 services:
   foo:
     image: busybox
-networks:
-  default:
-    ipam:
-      config:
-        - 123: oh dear
+    labels:
+      null: oh dear
 `)
-	assert.ErrorContains(t, err, "Non-string key in networks.default.ipam.config[0]: 123")
+	assert.ErrorContains(t, err, "Non-string key in services.foo.labels: <nil>")
+}
 
-	_, err = loadYAML(`
+func TestNumericKeys(t *testing.T) {
+	project, err := loadYAML(`
+name: numeric-keys
 services:
-  dict-env:
+  123:
     image: busybox
+    labels:
+      2024: foo
+      2024-01-01: date
+      1.5: float
+      true: bool
     environment:
       1: FOO
+    build:
+      context: .
+      args:
+        42: answer
 `)
-	assert.ErrorContains(t, err, "Non-string key in services.dict-env.environment: 1")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.ServiceNames(), []string{"123"})
+	s := project.Services[0]
+	assert.DeepEqual(t, s.Labels, types.Labels{"2024": "foo", "2024-01-01": "date", "1.5": "float", "true": "bool"})
+	assert.DeepEqual(t, s.Environment, types.MappingWithEquals{"1": strPtr("FOO")})
+	assert.DeepEqual(t, s.Build.Args, types.MappingWithEquals{"42": strPtr("answer")})
 }
 
 func TestV1Unsupported(t *testing.T) {
@@ -776,6 +798,7 @@ networks:
 				Environment: types.MappingWithEquals{},
 			},
 		},
+		ServicesOrder: []string{"web"},
 		Configs: map[string]types.ConfigObjConfig{
 			"appconfig": {External: types.External{External: true}, Name: "appconfig"},
 		},
@@ -845,14 +868,16 @@ services:
 		options.SkipNormalization = true
 	})
 	assert.NilError(t, err)
-	assert.DeepEqual(t, configWithEnvFiles.Services[0].EnvFile, types.StringList{"example1.env",
-		"example2.env"})
+	assert.DeepEqual(t, configWithEnvFiles.Services[0].EnvFile, []types.EnvFile{
+		{Path: "example1.env", Required: true},
+		{Path: "example2.env", Required: true},
+	})
 	assert.DeepEqual(t, configWithEnvFiles.Services[0].Environment, expectedEnvironmentMap)
 
 	// Custom behavior removes the `env_file` entries
 	configWithoutEnvFiles, err := Load(configDetails, WithDiscardEnvFiles)
 	assert.NilError(t, err)
-	assert.DeepEqual(t, configWithoutEnvFiles.Services[0].EnvFile, types.StringList(nil))
+	assert.DeepEqual(t, configWithoutEnvFiles.Services[0].EnvFile, []types.EnvFile(nil))
 	assert.DeepEqual(t, configWithoutEnvFiles.Services[0].Environment, expectedEnvironmentMap)
 }
 
@@ -975,6 +1000,67 @@ services:
 	assert.Equal(t, project.Services[0].Scale, 2)
 }
 
+func TestInterpolateTypedValues(t *testing.T) {
+	project, err := loadYAMLWithEnv(`
+name: interpolate-typed
+services:
+  foo:
+    image: ${IMAGE}
+    deploy:
+      replicas: ${REPLICAS}
+      resources:
+        limits:
+          pids: ${PIDS}
+    build:
+      context: .
+      no_cache: ${NO_CACHE}
+    depends_on:
+      bar:
+        condition: service_started
+        restart: ${RESTART}
+    networks:
+      front:
+        priority: ${PRIORITY}
+    volumes:
+      - type: tmpfs
+        target: /tmp
+        tmpfs:
+          mode: ${MODE}
+  bar:
+    image: bar
+networks:
+  front: {}
+`, map[string]string{
+		"IMAGE":    "3",
+		"REPLICAS": "3",
+		"PIDS":     "100",
+		"NO_CACHE": "true",
+		"RESTART":  "yes",
+		"PRIORITY": "10",
+		"MODE":     "1777",
+	})
+	assert.NilError(t, err)
+	foo := project.MustGetService("foo")
+	// a string attribute is not cast, even when the value looks like a number
+	assert.Equal(t, foo.Image, "3")
+	assert.Equal(t, *foo.Deploy.Replicas, uint64(3))
+	assert.Equal(t, foo.Deploy.Resources.Limits.PIds, int64(100))
+	assert.Equal(t, foo.Build.NoCache, true)
+	assert.Equal(t, foo.DependsOn["bar"].Restart, true)
+	assert.Equal(t, foo.Networks["front"].Priority, 10)
+	assert.Equal(t, foo.Volumes[0].Tmpfs.Mode, uint32(1777))
+
+	_, err = loadYAMLWithEnv(`
+name: interpolate-typed
+services:
+  foo:
+    image: foo
+    deploy:
+      replicas: ${REPLICAS}
+`, map[string]string{"REPLICAS": "many"})
+	assert.ErrorContains(t, err, "failed to cast to expected type")
+}
+
 func durationPtr(value time.Duration) *types.Duration {
 	result := types.Duration(value)
 	return &result
@@ -1328,8 +1414,8 @@ services:
 	assert.NilError(t, err)
 
 	expected := types.HostsList{
-		"alpha": "50.31.209.229",
-		"zulu":  "162.242.195.82",
+		"alpha": []string{"50.31.209.229"},
+		"zulu":  []string{"162.242.195.82"},
 	}
 
 	assert.Assert(t, is.Len(config.Services, 1))
@@ -1349,18 +1435,74 @@ services:
 	assert.NilError(t, err)
 
 	expected := types.HostsList{
-		"alpha": "50.31.209.229",
-		"zulu":  "ff02::1",
+		"alpha": []string{"50.31.209.229"},
+		"zulu":  []string{"ff02::1"},
 	}
 
 	assert.Assert(t, is.Len(config.Services, 1))
 	assert.Check(t, is.DeepEqual(expected, config.Services[0].ExtraHosts))
 }
 
-func TestLoadVolumesWarnOnDeprecatedExternalNameVersion34(t *testing.T) {
-	buf, cleanup := patchLogrus()
-	defer cleanup()
+func TestLoadExtraHostsMultipleIPs(t *testing.T) {
+	config, err := loadYAML(`
+name: load-extra-hosts-multiple-ips
+services:
+  web:
+    image: busybox
+    extra_hosts:
+      - "alpha:50.31.209.229"
+      - "alpha:50.31.209.230"
+      - "zulu:ff02::1"
+      - "zulu:[fe80::1]"
+      - "zulu:[ff02::1]"
+      - "gateway:host-gateway"
+`)
+	assert.NilError(t, err)
+
+	expected := types.HostsList{
+		"alpha":   []string{"50.31.209.229", "50.31.209.230"},
+		"zulu":    []string{"ff02::1", "fe80::1"},
+		"gateway": []string{types.HostGateway},
+	}
+	assert.Check(t, is.DeepEqual(expected, config.Services[0].ExtraHosts))
+
+	marshalled, err := config.MarshalYAML()
+	assert.NilError(t, err)
+	assert.Check(t, strings.Contains(string(marshalled), `
+      - alpha:50.31.209.229
+      - alpha:50.31.209.230
+      - gateway:host-gateway
+      - zulu:ff02::1
+      - zulu:fe80::1
+`), string(marshalled))
+	reloaded, err := loadYAML(string(marshalled))
+	assert.NilError(t, err)
+	assert.Check(t, is.DeepEqual(expected, reloaded.Services[0].ExtraHosts))
+}
+
+func TestLoadExtraHostsInvalidIP(t *testing.T) {
+	_, err := loadYAML(`
+name: load-extra-hosts-invalid-ip
+services:
+  web:
+    image: busybox
+    extra_hosts:
+      alpha: 50.31.209
+`)
+	assert.ErrorContains(t, err, `invalid IP address "50.31.209" for extra host "alpha"`)
+
+	_, err = loadYAML(`
+name: load-extra-hosts-invalid-ip
+services:
+  web:
+    image: busybox
+    extra_hosts:
+      - "zulu:ff02:::1"
+`)
+	assert.ErrorContains(t, err, `invalid IP address "ff02:::1" for extra host "zulu"`)
+}
 
+func TestLoadVolumesWarnOnDeprecatedExternalNameVersion34(t *testing.T) {
 	source := map[string]interface{}{
 		"foo": map[string]interface{}{
 			"external": map[string]interface{}{
@@ -1377,7 +1519,8 @@ func TestLoadVolumesWarnOnDeprecatedExternalNameVersion34(t *testing.T) {
 		},
 	}
 	assert.Check(t, is.DeepEqual(expected, volumes))
-	assert.Check(t, is.Contains(buf.String(), "volume.external.name is deprecated"))
+	assert.Check(t, is.DeepEqual(deprecationWarnings("compose.yaml", map[string]interface{}{"volumes": source}),
+		[]string{"compose.yaml: volumes.foo.external.name is deprecated, use `name` along with `external: true`"}))
 
 }
 
@@ -1389,9 +1532,6 @@ func patchLogrus() (*bytes.Buffer, func()) {
 }
 
 func TestLoadVolumesWarnOnDeprecatedExternalName(t *testing.T) {
-	buf, cleanup := patchLogrus()
-	defer cleanup()
-
 	source := map[string]interface{}{
 		"foo": map[string]interface{}{
 			"external": map[string]interface{}{
@@ -1408,7 +1548,8 @@ func TestLoadVolumesWarnOnDeprecatedExternalName(t *testing.T) {
 		},
 	}
 	assert.Check(t, is.DeepEqual(expected, volumes))
-	assert.Check(t, strings.Contains(buf.String(), "volume foo: volume.external.name is deprecated in favor of volume.name"))
+	assert.Check(t, is.DeepEqual(deprecationWarnings("compose.yaml", map[string]interface{}{"volumes": source}),
+		[]string{"compose.yaml: volumes.foo.external.name is deprecated, use `name` along with `external: true`"}))
 }
 
 func TestLoadInvalidIsolation(t *testing.T) {
@@ -1442,10 +1583,37 @@ secrets:
 	assert.ErrorContains(t, err, "external_secret")
 }
 
-func TestLoadSecretsWarnOnDeprecatedExternalNameVersion35(t *testing.T) {
-	buf, cleanup := patchLogrus()
-	defer cleanup()
+func TestLoadSecretAndConfigFromEnvironment(t *testing.T) {
+	yaml := `
+name: load-secret-and-config-from-environment
+secrets:
+  token:
+    environment: TOKEN
+configs:
+  settings:
+    environment: SETTINGS
+`
+	actual, err := loadYAMLWithEnv(yaml, map[string]string{"TOKEN": "s3cr3t", "SETTINGS": "debug=true"})
+	assert.NilError(t, err)
+	assert.Equal(t, actual.Secrets["token"].Content, "s3cr3t")
+	assert.Equal(t, actual.Configs["settings"].Content, "debug=true")
 
+	_, err = loadYAMLWithEnv(yaml, map[string]string{"SETTINGS": "debug=true"})
+	assert.Error(t, err, `secret token: environment variable "TOKEN" is not set: invalid compose project`)
+}
+
+func TestLoadSecretMutuallyExclusiveSources(t *testing.T) {
+	_, err := loadYAMLWithEnv(`
+name: load-secret-mutually-exclusive-sources
+secrets:
+  token:
+    file: ./token.txt
+    environment: TOKEN
+`, map[string]string{"TOKEN": "s3cr3t"})
+	assert.Error(t, err, "secret token: secret.file, secret.environment and secret.external are mutually exclusive: invalid compose project")
+}
+
+func TestLoadSecretsWarnOnDeprecatedExternalNameVersion35(t *testing.T) {
 	source := map[string]interface{}{
 		"foo": map[string]interface{}{
 			"external": map[string]interface{}{
@@ -1463,13 +1631,11 @@ func TestLoadSecretsWarnOnDeprecatedExternalNameVersion35(t *testing.T) {
 		},
 	}
 	assert.Check(t, is.DeepEqual(expected, secrets))
-	assert.Check(t, is.Contains(buf.String(), "secret.external.name is deprecated"))
+	assert.Check(t, is.DeepEqual(deprecationWarnings("compose.yaml", map[string]interface{}{"secrets": source}),
+		[]string{"compose.yaml: secrets.foo.external.name is deprecated, use `name` along with `external: true`"}))
 }
 
 func TestLoadNetworksWarnOnDeprecatedExternalNameVersion35(t *testing.T) {
-	buf, cleanup := patchLogrus()
-	defer cleanup()
-
 	source := map[string]interface{}{
 		"foo": map[string]interface{}{
 			"external": map[string]interface{}{
@@ -1486,14 +1652,12 @@ func TestLoadNetworksWarnOnDeprecatedExternalNameVersion35(t *testing.T) {
 		},
 	}
 	assert.Check(t, is.DeepEqual(expected, networks))
-	assert.Check(t, is.Contains(buf.String(), "network.external.name is deprecated"))
+	assert.Check(t, is.DeepEqual(deprecationWarnings("compose.yaml", map[string]interface{}{"networks": source}),
+		[]string{"compose.yaml: networks.foo.external.name is deprecated, use `name` along with `external: true`"}))
 
 }
 
 func TestLoadNetworksWarnOnDeprecatedExternalName(t *testing.T) {
-	buf, cleanup := patchLogrus()
-	defer cleanup()
-
 	source := map[string]interface{}{
 		"foo": map[string]interface{}{
 			"external": map[string]interface{}{
@@ -1510,7 +1674,8 @@ func TestLoadNetworksWarnOnDeprecatedExternalName(t *testing.T) {
 		},
 	}
 	assert.Check(t, is.DeepEqual(expected, networks))
-	assert.Check(t, strings.Contains(buf.String(), "network foo: network.external.name is deprecated. Please set network.name with external: true"))
+	assert.Check(t, is.DeepEqual(deprecationWarnings("compose.yaml", map[string]interface{}{"networks": source}),
+		[]string{"compose.yaml: networks.foo.external.name is deprecated, use `name` along with `external: true`"}))
 }
 
 func TestLoadNetworkInvalidExternalNameAndNameCombination(t *testing.T) {
@@ -1560,6 +1725,7 @@ networks:
 				},
 			},
 		},
+		ServicesOrder: []string{"hello-world"},
 		Networks: map[string]types.NetworkConfig{
 			"network1": {Name: "network2"},
 			"network3": {},
@@ -1616,6 +1782,7 @@ networks:
 				},
 			},
 		},
+		ServicesOrder: []string{"foo"},
 		Networks: map[string]types.NetworkConfig{
 			"network1": {
 				Name:       "network1",
@@ -1798,6 +1965,7 @@ secrets:
 				},
 			},
 		},
+		ServicesOrder: []string{"hello-world"},
 		Configs: map[string]types.ConfigObjConfig{
 			"config": {
 				Name:           "config",
@@ -1868,6 +2036,7 @@ secrets:
 				},
 			},
 		},
+		ServicesOrder: []string{"hello-world"},
 		Configs: map[string]types.ConfigObjConfig{
 			"config": {
 				Name:     "config",
@@ -1941,7 +2110,7 @@ func TestLoadWithExtends(t *testing.T) {
 			Environment: types.MappingWithEquals{
 				"SOURCE": strPtr("extends"),
 			},
-			EnvFile:  []string{expectedEnvFilePath},
+			EnvFile:  []types.EnvFile{{Path: expectedEnvFilePath, Required: true}},
 			Networks: map[string]*types.ServiceNetworkConfig{"default": nil},
 			Volumes: []types.ServiceVolumeConfig{{
 				Type:   "bind",
@@ -1955,6 +2124,24 @@ func TestLoadWithExtends(t *testing.T) {
 	assert.Check(t, is.DeepEqual(expServices, actual.Services))
 }
 
+func TestLoadWithExtendsMissingFile(t *testing.T) {
+	_, err := Load(types.ConfigDetails{
+		WorkingDir: "testdata",
+		ConfigFiles: []types.ConfigFile{{Filename: "compose.yaml", Content: []byte(`
+name: extends-missing-file
+services:
+  importer:
+    extends:
+      file: subdir/missing.yaml
+      service: base
+`)}},
+		Environment: map[string]string{},
+	})
+	assert.Check(t, errdefs.IsNotFoundError(err))
+	expected := filepath.Join("testdata", "subdir", "missing.yaml")
+	assert.ErrorContains(t, err, fmt.Sprintf(`cannot extend service "importer" in compose.yaml: extends.file subdir/missing.yaml (resolved to %s) does not exist`, expected))
+}
+
 func TestLoadWithExtendsWithContextUrl(t *testing.T) {
 	b, err := os.ReadFile("testdata/compose-test-extends-with-context-url.yaml")
 	assert.NilError(t, err)
@@ -2019,321 +2206,1805 @@ services:
 	assert.ErrorContains(t, err, "invalid string value for 'count' (the only value allowed is 'all')")
 }
 
-func TestServicePullPolicy(t *testing.T) {
-	actual, err := loadYAML(`
-name: service-pull-policy
+func TestServiceGpus(t *testing.T) {
+	project, err := Load(buildConfigDetails(`
+name: service-gpus
 services:
-  hello-world:
-    image: redis:alpine
-    pull_policy: always
-`)
-	assert.NilError(t, err)
-	svc, err := actual.GetService("hello-world")
+  all:
+    image: cuda
+    gpus: all
+  some:
+    image: cuda
+    gpus:
+      - driver: nvidia
+        device_ids: ["0", "3"]
+        options:
+          virtualization: "false"
+  reserved:
+    image: cuda
+    deploy:
+      resources:
+        reservations:
+          devices:
+            - driver: nvidia
+              capabilities: [gpu, utility]
+              count: 2
+              x-foo: bar
+`, nil))
 	assert.NilError(t, err)
-	assert.Equal(t, "always", svc.PullPolicy)
-}
 
-func TestEmptyList(t *testing.T) {
-	_, err := loadYAML(`
-name: empty-list
-services:
-  test:
-    image: nginx:latest
-    ports: []
-`)
+	all, err := project.GetService("all")
 	assert.NilError(t, err)
-}
+	assert.DeepEqual(t, all.Gpus, types.GpusConfig{{Count: -1, Capabilities: []string{"gpu"}}})
 
-func TestLoadServiceWithEnvFile(t *testing.T) {
-	file, err := os.CreateTemp("", "test-compose-go")
+	some, err := project.GetService("some")
 	assert.NilError(t, err)
-	defer os.Remove(file.Name())
+	assert.DeepEqual(t, some.Gpus, types.GpusConfig{{
+		Driver:       "nvidia",
+		Capabilities: []string{"gpu"},
+		IDs:          []string{"0", "3"},
+		Options:      types.Mapping{"virtualization": "false"},
+	}})
 
-	_, err = file.Write([]byte("HALLO=$TEST"))
+	reserved, err := project.GetService("reserved")
 	assert.NilError(t, err)
+	assert.DeepEqual(t, reserved.Deploy.Resources.Reservations.Devices, []types.DeviceRequest{{
+		Driver:       "nvidia",
+		Capabilities: []string{"gpu", "utility"},
+		Count:        2,
+		Extensions:   types.Extensions{"x-foo": "bar"},
+	}})
 
-	p := &types.Project{
-		Environment: map[string]string{
-			"TEST": "YES",
-		},
-		Services: []types.ServiceConfig{
-			{
-				Name:    "Test",
-				EnvFile: []string{file.Name()},
-			},
-		},
-	}
-	err = p.ResolveServicesEnvironment(false)
+	marshalled, err := project.MarshalYAML()
 	assert.NilError(t, err)
-	service, err := p.GetService("Test")
+	reloaded, err := Load(buildConfigDetails(string(marshalled), nil))
 	assert.NilError(t, err)
-	assert.Equal(t, "YES", *service.Environment["HALLO"])
-}
-
-func TestLoadServiceWithVolumes(t *testing.T) {
-	m := map[string]interface{}{
-		"volumes": []interface{}{
-			"source:/path 1/",
-			map[string]interface{}{
-				"target": "/path 2/",
-			},
-		},
-		"configs": []interface{}{
-			map[string]interface{}{
-				"target": "/path 3/",
-			},
-		},
-		"secrets": []interface{}{
-			map[string]interface{}{
-				"target": "/path 4/",
-			},
-		},
+	for _, service := range project.Services {
+		reloadedService, err := reloaded.GetService(service.Name)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, reloadedService, service)
 	}
-	s, err := LoadService("Test Name", m, ".", nil, true, false)
-	assert.NilError(t, err)
-	assert.Equal(t, len(s.Volumes), 2)
-	assert.Equal(t, "/path 1", s.Volumes[0].Target)
-	assert.Equal(t, "/path 2", s.Volumes[1].Target)
-	assert.Equal(t, len(s.Configs), 1)
-	assert.Equal(t, "/path 3", s.Configs[0].Target)
-	assert.Equal(t, len(s.Secrets), 1)
-	assert.Equal(t, "/path 4", s.Secrets[0].Target)
 }
 
-func TestLoadNoSSHInBuildConfig(t *testing.T) {
-	actual, err := loadYAML(`
-name: load-no-ssh-in-build-config
+func TestServiceGpusCountAndDeviceIDs(t *testing.T) {
+	_, err := Load(buildConfigDetails(`
+name: service-gpus
 services:
-  test:
-    build:
-      context: .
-`)
-	assert.NilError(t, err)
-	svc, err := actual.GetService("test")
-	assert.NilError(t, err)
-	assert.Check(t, svc.Build.SSH == nil)
-}
-
-func TestLoadSSHWithoutValueInBuildConfig(t *testing.T) {
-	_, err := loadYAML(`
-name: load-ssh-without-value-in-build-config
+  web:
+    image: cuda
+    gpus:
+      - count: 1
+        device_ids: ["0"]
+`, nil))
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "service \"web\" gpus[0] declares mutually exclusive `count` and `device_ids`")
+
+	_, err = Load(buildConfigDetails(`
+name: service-gpus
 services:
-  test:
-    build:
-      context: .
-      ssh:
-`)
-	assert.ErrorContains(t, err, "services.test.build.ssh must be a mapping")
+  web:
+    image: cuda
+    deploy:
+      resources:
+        reservations:
+          devices:
+            - count: all
+              device_ids: ["0"]
+`, nil))
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "service \"web\" deploy.resources.reservations.devices[0] declares mutually exclusive `count` and `device_ids`")
+
+	_, err = Load(buildConfigDetails(`
+name: service-gpus
+services:
+  web:
+    image: cuda
+    gpus: some
+`, nil))
+	assert.ErrorContains(t, err, "gpus")
 }
 
-func TestLoadSSHWithDefaultValueInBuildConfig(t *testing.T) {
+func TestServicePullPolicy(t *testing.T) {
 	actual, err := loadYAML(`
-name: load-ssh-with-default-value-in-build-config
+name: service-pull-policy
 services:
-  test:
-    build:
-      context: .
-      ssh: [default]
+  hello-world:
+    image: redis:alpine
+    pull_policy: always
 `)
 	assert.NilError(t, err)
-	svc, err := actual.GetService("test")
-	assert.NilError(t, err)
-	sshValue, err := svc.Build.SSH.Get("default")
+	svc, err := actual.GetService("hello-world")
 	assert.NilError(t, err)
-	assert.Equal(t, "", sshValue)
+	assert.Equal(t, "always", svc.PullPolicy)
 }
 
-func TestLoadSSHWithKeyValueInBuildConfig(t *testing.T) {
-	actual, err := loadYAML(`
-name: load-ssh-with-key-value-in-build-config
+func TestServicePullPolicyCanonical(t *testing.T) {
+	project, err := Load(buildConfigDetails(`
+name: service-pull-policy
 services:
-  test:
-    build:
-      context: .
-      ssh: 
-        key1: value1
-`)
+  web:
+    image: web
+    pull_policy: if_not_present
+  app:
+    image: app
+    pull_policy: build
+`, nil), func(o *Options) {
+		o.SkipNormalization = true
+	})
 	assert.NilError(t, err)
-	svc, err := actual.GetService("test")
+	web, err := project.GetService("web")
 	assert.NilError(t, err)
-	sshValue, err := svc.Build.SSH.Get("key1")
+	assert.Equal(t, web.PullPolicy, types.PullPolicyMissing)
+	marshalled, err := project.MarshalYAML()
 	assert.NilError(t, err)
-	assert.Equal(t, "value1", sshValue)
+	assert.Check(t, strings.Contains(string(marshalled), "pull_policy: missing"))
+	assert.DeepEqual(t, project.WarningMessages, []string{`service "app" declares ` + "`pull_policy: build`" + ` but has no build section, its image can't be built`})
+
+	_, err = Load(buildConfigDetails(`
+name: service-pull-policy
+services:
+  web:
+    image: web
+    pull_policy: sometimes
+`, nil), func(o *Options) {
+		o.SkipValidation = true
+	})
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "web": invalid pull policy "sometimes", expected one of always, never, missing or build`)
 }
 
-func TestLoadSSHWithKeysValuesInBuildConfig(t *testing.T) {
-	actual, err := loadYAML(`
-name: load-ssh-with-keys-values-in-build-config
+func TestServiceStopSignal(t *testing.T) {
+	project, err := Load(buildConfigDetails(`
+name: service-stop-signal
+services:
+  web:
+    image: web
+    stop_signal: term
+  app:
+    image: app
+    init: true
+    stop_signal: "9"
+  worker:
+    image: worker
+    init: false
+    stop_signal: SIGRTMIN+3
+`, nil))
+	assert.NilError(t, err)
+	for name, expected := range map[string]string{"web": "SIGTERM", "app": "9", "worker": "SIGRTMIN+3"} {
+		s, err := project.GetService(name)
+		assert.NilError(t, err)
+		assert.Equal(t, s.StopSignal, expected)
+	}
+	assert.DeepEqual(t, project.WarningMessages, []string{`service "app" declares both ` + "`init: true` and `stop_signal: 9`" +
+		`, the signal is sent to the init process which forwards it to the service command`})
+
+	marshalled, err := project.MarshalYAML()
+	assert.NilError(t, err)
+	reloaded, err := Load(buildConfigDetails(string(marshalled), nil))
+	assert.NilError(t, err)
+	for _, service := range project.Services {
+		s, err := reloaded.GetService(service.Name)
+		assert.NilError(t, err)
+		assert.Equal(t, s.StopSignal, service.StopSignal)
+		assert.DeepEqual(t, s.Init, service.Init)
+	}
+
+	_, err = Load(buildConfigDetails(`
+name: service-stop-signal
+services:
+  web:
+    image: web
+    stop_signal: SIGSTOPPED
+`, nil))
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "web": invalid signal "SIGSTOPPED"`)
+}
+
+func TestLoadPruneUnusedResources(t *testing.T) {
+	yaml := `
+name: prune-unused-resources
+services:
+  web:
+    image: web
+    networks: [front]
+    secrets: [token]
+  db:
+    image: db
+    profiles: [backend]
+    networks: [back]
+    volumes:
+      - data:/var/lib/db
+networks:
+  front: {}
+  back: {}
+volumes:
+  data: {}
+secrets:
+  token:
+    file: ./token
+`
+	project, err := Load(buildConfigDetails(yaml, nil), WithPruneUnusedResources)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.NetworkNames(), []string{"front"})
+	assert.Check(t, project.VolumeNames() == nil)
+	assert.DeepEqual(t, project.SecretNames(), []string{"token"})
+	assert.DeepEqual(t, project.Warnings(), []string{
+		`network "back" is not used by any enabled service, it has been pruned`,
+		`volume "data" is not used by any enabled service, it has been pruned`,
+	})
+
+	project, err = Load(buildConfigDetails(yaml, nil), WithPruneUnusedResources, WithProfiles([]string{"backend"}))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.NetworkNames(), []string{"back", "front"})
+	assert.DeepEqual(t, project.VolumeNames(), []string{"data"})
+	assert.Check(t, project.Warnings() == nil)
+
+	project, err = Load(buildConfigDetails(yaml, nil))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.NetworkNames(), []string{"back", "default", "front"})
+	assert.DeepEqual(t, project.VolumeNames(), []string{"data"})
+}
+
+func TestMarshalPreserveServiceOrder(t *testing.T) {
+	configDetails := types.ConfigDetails{
+		Environment: map[string]string{},
+		ConfigFiles: []types.ConfigFile{
+			{Filename: "compose.yaml", Content: []byte(`
+name: preserve-service-order
+services:
+  web:
+    image: web
+  db:
+    image: db
+  cache:
+    image: cache
+`)},
+			{Filename: "override.yaml", Content: []byte(`
+services:
+  db:
+    environment:
+      DEBUG: "1"
+  admin:
+    image: admin
+`)},
+		},
+	}
+	project, err := Load(configDetails)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.ServicesOrder, []string{"web", "db", "cache", "admin"})
+
+	serviceKeys := func(b []byte) []string {
+		doc, err := LoadDocument(b)
+		assert.NilError(t, err)
+		services := doc.Lookup("services")
+		var keys []string
+		for i := 0; i+1 < len(services.Content); i += 2 {
+			keys = append(keys, services.Content[i].Value)
+		}
+		return keys
+	}
+
+	b, err := project.MarshalYAML()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, serviceKeys(b), []string{"admin", "cache", "db", "web"})
+
+	project.Services = append(project.Services, types.ServiceConfig{Name: "added", Image: "added"})
+	b, err = project.MarshalYAML(types.PreserveServiceOrder)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, serviceKeys(b), []string{"web", "db", "cache", "admin", "added"})
+
+	reloaded, err := Load(types.ConfigDetails{
+		Environment: map[string]string{},
+		ConfigFiles: []types.ConfigFile{{Filename: "compose.yaml", Content: b}},
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, reloaded.ServicesOrder, []string{"web", "db", "cache", "admin", "added"})
+	db, err := reloaded.GetService("db")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, db.Environment, types.MappingWithEquals{"DEBUG": strPtr("1")})
+}
+
+func TestProjectHashRoundTrip(t *testing.T) {
+	project, err := Load(buildConfigDetails(`
+name: project-hash
+services:
+  web:
+    build: ./web
+    ports:
+      - 8080:80
+    volumes:
+      - ./data:/data
+    env_file: example1.env
+  db:
+    image: postgres
+    environment:
+      - POSTGRES_PASSWORD=secret
+`, nil))
+	assert.NilError(t, err)
+	hash, err := project.Hash()
+	assert.NilError(t, err)
+
+	for i := 0; i < 2; i++ {
+		b, err := project.MarshalYAML()
+		assert.NilError(t, err)
+		project, err = Load(buildConfigDetails(string(b), nil))
+		assert.NilError(t, err)
+		rehash, err := project.Hash()
+		assert.NilError(t, err)
+		assert.Equal(t, rehash, hash)
+	}
+}
+
+func TestLoadCPUAttributes(t *testing.T) {
+	project, err := Load(buildConfigDetails(`
+name: cpu-attributes
+services:
+  windows:
+    image: mcr.microsoft.com/windows/nanoserver
+    platform: windows/amd64
+    cpu_count: 2
+    cpu_percent: 50
+  linux:
+    image: busybox
+    cpuset: 0-3,5
+  mixed:
+    image: busybox
+    cpu_count: 2
+    cpuset: "1"
+`, nil))
+	assert.NilError(t, err)
+	windows, err := project.GetService("windows")
+	assert.NilError(t, err)
+	assert.Equal(t, windows.CPUCount, int64(2))
+	assert.Equal(t, windows.CPUPercent, float32(50))
+	linux, err := project.GetService("linux")
+	assert.NilError(t, err)
+	assert.Equal(t, linux.CPUSet, "0-3,5")
+	assert.DeepEqual(t, project.WarningMessages, []string{`service "mixed" declares ` + "`cpu_count`" +
+		`, only supported by Windows containers, along with ` + "`cpuset`" + `, only supported by Linux containers`})
+
+	marshalled, err := project.MarshalYAML()
+	assert.NilError(t, err)
+	reloaded, err := Load(buildConfigDetails(string(marshalled), nil))
+	assert.NilError(t, err)
+	for _, service := range project.Services {
+		s, err := reloaded.GetService(service.Name)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, s, service)
+	}
+
+	_, err = Load(buildConfigDetails(`
+name: cpu-attributes
+services:
+  linux:
+    image: busybox
+    cpuset: 0-3;5
+`, nil))
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "linux": invalid cpuset "0-3;5"`)
+}
+
+func TestLoadTmpfs(t *testing.T) {
+	project, err := Load(buildConfigDetails(`
+name: load-tmpfs
+services:
+  short:
+    image: busybox
+    read_only: true
+    tmpfs:
+      - /run:size=64m,mode=1777
+      - /tmp
+  long:
+    image: busybox
+    read_only: true
+    x-tmpfs:
+      - target: /run
+        size: 64m
+        mode: 0o1777
+      - target: /cache
+        size: 1024
+  readonly:
+    image: busybox
+    read_only: true
+  volume:
+    image: busybox
+    read_only: true
+    volumes:
+      - type: tmpfs
+        target: /run
+`, nil))
+	assert.NilError(t, err)
+	short, err := project.GetService("short")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, short.Tmpfs, types.StringList{"/run:size=64m,mode=1777", "/tmp"})
+	long, err := project.GetService("long")
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(long.Tmpfs, 0))
+	mounts, err := long.TmpfsMounts()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, mounts, []types.TmpfsMount{
+		{Target: "/run", Size: 64 * 1024 * 1024, Mode: 0o1777},
+		{Target: "/cache", Size: 1024},
+	})
+	shortMounts, err := short.TmpfsMounts()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, shortMounts[0], mounts[0])
+
+	assert.DeepEqual(t, project.WarningMessages, []string{`service "readonly" declares ` + "`read_only: true`" +
+		` without any tmpfs mount, its containers can only write to volumes`})
+
+	marshalled, err := project.MarshalYAML()
+	assert.NilError(t, err)
+	reloaded, err := Load(buildConfigDetails(string(marshalled), nil))
+	assert.NilError(t, err)
+	for _, service := range project.Services {
+		s, err := reloaded.GetService(service.Name)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, s.Tmpfs, service.Tmpfs)
+		assert.DeepEqual(t, s.Extensions, service.Extensions)
+	}
+
+	_, err = Load(buildConfigDetails(`
+name: load-tmpfs
+services:
+  test:
+    image: busybox
+    tmpfs:
+      - /run:size=lots
+`, nil))
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "test": invalid tmpfs "/run:size=lots", size must be a number of bytes, like 64m`)
+
+	_, err = Load(buildConfigDetails(`
+name: load-tmpfs
+services:
+  test:
+    image: busybox
+    x-tmpfs:
+      - target: /run
+        size: lots
+`, nil))
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "test": tmpfs /run: invalid size "lots"`)
+
+	_, err = loadYAML(`
+name: load-tmpfs
+services:
+  test:
+    image: busybox
+    tmpfs:
+      - target: /run
+`)
+	assert.ErrorContains(t, err, "services.test.tmpfs")
+}
+
+func TestEmptyList(t *testing.T) {
+	_, err := loadYAML(`
+name: empty-list
 services:
   test:
+    image: nginx:latest
+    ports: []
+`)
+	assert.NilError(t, err)
+}
+
+func TestLoadServiceWithEnvFile(t *testing.T) {
+	file, err := os.CreateTemp("", "test-compose-go")
+	assert.NilError(t, err)
+	defer os.Remove(file.Name())
+
+	_, err = file.Write([]byte("HALLO=$TEST"))
+	assert.NilError(t, err)
+
+	p := &types.Project{
+		Environment: map[string]string{
+			"TEST": "YES",
+		},
+		Services: []types.ServiceConfig{
+			{
+				Name:    "Test",
+				EnvFile: []types.EnvFile{{Path: file.Name(), Required: true}},
+			},
+		},
+	}
+	err = p.ResolveServicesEnvironment(false)
+	assert.NilError(t, err)
+	service, err := p.GetService("Test")
+	assert.NilError(t, err)
+	assert.Equal(t, "YES", *service.Environment["HALLO"])
+}
+
+func TestLoadServiceWithOptionalEnvFile(t *testing.T) {
+	p, err := loadYAML(`
+name: load-optional-env-file
+services:
+  test:
+    image: busybox
+    env_file:
+      - ./example1.env
+      - path: ./testdata/missing.env
+        required: false
+    environment:
+      FOO: from_service
+`)
+	assert.NilError(t, err)
+	service, err := p.GetService("test")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, service.EnvFile, []types.EnvFile{
+		{Path: "./example1.env", Required: true},
+		{Path: "./testdata/missing.env", Required: false},
+	})
+	assert.Equal(t, *service.Environment["FOO"], "from_service")
+	assert.Equal(t, *service.Environment["BAR"], "bar_from_env_file")
+
+	_, err = loadYAML(`
+name: load-required-env-file
+services:
+  test:
+    image: busybox
+    env_file:
+      - path: ./testdata/missing.env
+`)
+	assert.ErrorContains(t, err, "Failed to load")
+}
+
+func TestLoadInterpolatedEnvFile(t *testing.T) {
+	p, err := loadYAMLWithEnv(`
+name: load-interpolated-env-file
+services:
+  short:
+    image: busybox
+    env_file: testdata/envfile/${ENVIRONMENT}.env
+  long:
+    image: busybox
+    env_file:
+      - path: testdata/envfile/${STAGE:-prod}.env
+        required: true
+`, map[string]string{"ENVIRONMENT": "dev"})
+	assert.NilError(t, err)
+	short, err := p.GetService("short")
+	assert.NilError(t, err)
+	assert.Equal(t, short.EnvFile[0].Path, "testdata/envfile/dev.env")
+	assert.Equal(t, *short.Environment["STAGE"], "dev")
+	long, err := p.GetService("long")
+	assert.NilError(t, err)
+	assert.Equal(t, *long.Environment["STAGE"], "prod")
+
+	_, err = loadYAMLWithEnv(`
+name: load-interpolated-env-file
+services:
+  test:
+    image: busybox
+    env_file:
+      - testdata/envfile/base.env
+      - testdata/envfile/${ENVIRONMENT}.env
+`, map[string]string{})
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "test" env_file "testdata/envfile/${ENVIRONMENT}.env" uses variable ENVIRONMENT which is only declared by an env_file, `+
+		"env_file paths are interpolated from the project environment")
+
+	p, err = loadYAMLWithEnv(`
+name: load-interpolated-env-file
+services:
+  optional:
+    image: busybox
+    env_file:
+      - testdata/envfile/base.env
+      - path: testdata/envfile/${ENVIRONMENT}.env
+        required: false
+  blank:
+    image: busybox
+    env_file:
+      - testdata/envfile/base.env
+      - testdata/envfile/${ENVIRONMENT:-}dev.env
+      - testdata/envfile/${UNSET}prod.env
+`, map[string]string{})
+	assert.NilError(t, err)
+	optional, err := p.GetService("optional")
+	assert.NilError(t, err)
+	assert.Equal(t, *optional.Environment["ENVIRONMENT"], "prod")
+	blank, err := p.GetService("blank")
+	assert.NilError(t, err)
+	assert.Equal(t, *blank.Environment["STAGE"], "prod")
+}
+
+func TestPortsRoundTrip(t *testing.T) {
+	p, err := loadYAML(`
+name: ports-round-trip
+services:
+  web:
+    image: nginx
+    ports:
+      - name: web
+        mode: host
+        host_ip: "::1"
+        target: 80
+        published: "8080-8090"
+        protocol: udp
+        app_protocol: http
+        x-foo: bar
+      - "[::1]:9000-9001:90-91/tcp"
+`)
+	assert.NilError(t, err)
+	expected := []types.ServicePortConfig{
+		{
+			Name:        "web",
+			Mode:        "host",
+			HostIP:      "::1",
+			Target:      80,
+			Published:   "8080-8090",
+			Protocol:    "udp",
+			AppProtocol: "http",
+			Extensions:  types.Extensions{"x-foo": "bar"},
+		},
+		{Mode: "ingress", HostIP: "::1", Target: 90, Published: "9000", Protocol: "tcp"},
+		{Mode: "ingress", HostIP: "::1", Target: 91, Published: "9001", Protocol: "tcp"},
+	}
+	assert.DeepEqual(t, p.Services[0].Ports, expected)
+
+	b, err := p.MarshalYAML()
+	assert.NilError(t, err)
+	reloaded, err := loadYAML(string(b))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, reloaded.Services[0].Ports, expected)
+}
+
+func TestLoadUndefinedAnchor(t *testing.T) {
+	_, err := Load(types.ConfigDetails{
+		ConfigFiles: []types.ConfigFile{
+			{
+				Filename: "base.yaml",
+				Content: []byte(`
+name: load-undefined-anchor
+x-defaults: &defaults
+  image: busybox
+services:
+  foo:
+    <<: *defaults
+`),
+			},
+			{
+				Filename: "override.yaml",
+				Content: []byte(`
+services:
+  bar:
+    <<: *defaults
+`),
+			},
+		},
+	})
+	assert.Error(t, err, `override.yaml: undefined anchor "defaults", YAML anchors are only shared with included compose files: invalid compose project`)
+}
+
+func TestLoadDependencyCycle(t *testing.T) {
+	yaml := `
+name: load-dependency-cycle
+services:
+  a:
+    image: busybox
+    depends_on: [b]
+  b:
+    image: busybox
+    depends_on: [a]
+`
+	_, err := Load(buildConfigDetails(yaml, nil))
+	assert.Error(t, err, "cycle detected: a -> b -> a: invalid compose project")
+
+	_, err = Load(buildConfigDetails(yaml, nil), func(options *Options) {
+		options.SkipConsistencyCheck = true
+	})
+	assert.NilError(t, err)
+}
+
+func TestLoadWithFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"project/compose.yaml": {Data: []byte(`
+name: virtual
+services:
+  foo:
+    extends:
+      file: base.yaml
+      service: base
+    env_file: foo.env
+    build: ./foo
+`)},
+		"project/base.yaml": {Data: []byte(`
+services:
+  base:
+    image: busybox
+    environment:
+      BASE: "true"
+`)},
+		"project/foo.env":        {Data: []byte("FOO=$TEST")},
+		"project/foo/Dockerfile": {Data: []byte("FROM busybox")},
+	}
+	p, err := Load(types.ConfigDetails{
+		WorkingDir:  "/project",
+		ConfigFiles: []types.ConfigFile{{Filename: "/project/compose.yaml"}},
+		Environment: map[string]string{"TEST": "virtual"},
+	}, WithFS(fsys), func(options *Options) {
+		options.ResolvePaths = true
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, p.WorkingDir, "/project")
+	foo, err := p.GetService("foo")
+	assert.NilError(t, err)
+	assert.Equal(t, foo.Image, "busybox")
+	assert.Equal(t, foo.Build.Context, filepath.Join("/project", "foo"))
+	assert.DeepEqual(t, foo.Environment, types.MappingWithEquals{
+		"BASE": strPtr("true"),
+		"FOO":  strPtr("virtual"),
+	})
+}
+
+func TestLoadServiceWithVolumes(t *testing.T) {
+	m := map[string]interface{}{
+		"volumes": []interface{}{
+			"source:/path 1/",
+			map[string]interface{}{
+				"target": "/path 2/",
+			},
+		},
+		"configs": []interface{}{
+			map[string]interface{}{
+				"target": "/path 3/",
+			},
+		},
+		"secrets": []interface{}{
+			map[string]interface{}{
+				"target": "/path 4/",
+			},
+		},
+	}
+	s, err := LoadService("Test Name", m, ".", nil, true, false)
+	assert.NilError(t, err)
+	assert.Equal(t, len(s.Volumes), 2)
+	assert.Equal(t, "/path 1", s.Volumes[0].Target)
+	assert.Equal(t, "/path 2", s.Volumes[1].Target)
+	assert.Equal(t, len(s.Configs), 1)
+	assert.Equal(t, "/path 3", s.Configs[0].Target)
+	assert.Equal(t, len(s.Secrets), 1)
+	assert.Equal(t, "/path 4", s.Secrets[0].Target)
+}
+
+func TestLoadNoSSHInBuildConfig(t *testing.T) {
+	actual, err := loadYAML(`
+name: load-no-ssh-in-build-config
+services:
+  test:
+    build:
+      context: .
+`)
+	assert.NilError(t, err)
+	svc, err := actual.GetService("test")
+	assert.NilError(t, err)
+	assert.Check(t, svc.Build.SSH == nil)
+}
+
+func TestLoadSSHWithoutValueInBuildConfig(t *testing.T) {
+	_, err := loadYAML(`
+name: load-ssh-without-value-in-build-config
+services:
+  test:
+    build:
+      context: .
+      ssh:
+`)
+	assert.ErrorContains(t, err, "services.test.build.ssh must be a mapping")
+}
+
+func TestLoadSSHWithDefaultValueInBuildConfig(t *testing.T) {
+	actual, err := loadYAML(`
+name: load-ssh-with-default-value-in-build-config
+services:
+  test:
+    build:
+      context: .
+      ssh: [default]
+`)
+	assert.NilError(t, err)
+	svc, err := actual.GetService("test")
+	assert.NilError(t, err)
+	sshValue, err := svc.Build.SSH.Get("default")
+	assert.NilError(t, err)
+	assert.Equal(t, "", sshValue)
+}
+
+func TestLoadSSHWithKeyValueInBuildConfig(t *testing.T) {
+	actual, err := loadYAML(`
+name: load-ssh-with-key-value-in-build-config
+services:
+  test:
+    build:
+      context: .
+      ssh: 
+        key1: value1
+`)
+	assert.NilError(t, err)
+	svc, err := actual.GetService("test")
+	assert.NilError(t, err)
+	sshValue, err := svc.Build.SSH.Get("key1")
+	assert.NilError(t, err)
+	assert.Equal(t, "value1", sshValue)
+}
+
+func TestLoadSSHWithKeysValuesInBuildConfig(t *testing.T) {
+	actual, err := loadYAML(`
+name: load-ssh-with-keys-values-in-build-config
+services:
+  test:
+    build:
+      context: .
+      ssh: 
+        - key1=value1
+        - key2=value2
+`)
+	assert.NilError(t, err)
+	svc, err := actual.GetService("test")
+	assert.NilError(t, err)
+
+	sshValue, err := svc.Build.SSH.Get("key1")
+	assert.NilError(t, err)
+	assert.Equal(t, "value1", sshValue)
+
+	sshValue, err = svc.Build.SSH.Get("key2")
+	assert.NilError(t, err)
+	assert.Equal(t, "value2", sshValue)
+}
+
+func TestProjectNameInterpolation(t *testing.T) {
+	t.Run("project name simple interpolation", func(t *testing.T) {
+		yaml := `
+name: interpolated
+services:
+  web:
+    image: web
+    container_name: ${COMPOSE_PROJECT_NAME}-web
+`
+		configDetails := buildConfigDetails(yaml, map[string]string{})
+
+		actual, err := Load(configDetails)
+		assert.NilError(t, err)
+		svc, err := actual.GetService("web")
+		assert.NilError(t, err)
+		assert.Equal(t, "interpolated-web", svc.ContainerName)
+	})
+
+	t.Run("project name interpolation with override", func(t *testing.T) {
+		yaml1 := `
+name: interpolated
+services:
+  web:
+    image: web
+    container_name: ${COMPOSE_PROJECT_NAME}-web
+`
+		yaml2 := `
+name: overrided
+services:
+  db:
+    image: db
+    container_name: ${COMPOSE_PROJECT_NAME}-db
+`
+		yaml3 := `
+services:
+  proxy:
+    image: proxy
+    container_name: ${COMPOSE_PROJECT_NAME}-proxy
+`
+		configDetails := buildConfigDetailsMultipleFiles(map[string]string{}, yaml1, yaml2, yaml3)
+
+		actual, err := Load(configDetails)
+		assert.NilError(t, err)
+		svc, err := actual.GetService("web")
+		assert.NilError(t, err)
+		assert.Equal(t, "overrided-web", svc.ContainerName)
+
+		svc, err = actual.GetService("db")
+		assert.NilError(t, err)
+		assert.Equal(t, "overrided-db", svc.ContainerName)
+
+		svc, err = actual.GetService("proxy")
+		assert.NilError(t, err)
+		assert.Equal(t, "overrided-proxy", svc.ContainerName)
+	})
+
+	t.Run("project name env variable interpolation", func(t *testing.T) {
+		yaml := `
+name: interpolated
+services:
+  web:
+    image: web
+    container_name: ${COMPOSE_PROJECT_NAME}-web
+`
+		configDetails := buildConfigDetails(yaml, map[string]string{"COMPOSE_PROJECT_NAME": "env-var"})
+		actual, err := Load(configDetails)
+		assert.NilError(t, err)
+		svc, err := actual.GetService("web")
+		assert.NilError(t, err)
+		assert.Equal(t, "env-var-web", svc.ContainerName)
+	})
+}
+
+func TestInterpolatedProjectName(t *testing.T) {
+	yaml := `
+name: ${COMPOSE_PROJECT_NAME:-myapp}
+services:
+  web:
+    image: web
+    volumes:
+      - data:/data
+volumes:
+  data: {}
+`
+	testCases := []struct {
+		name     string
+		env      map[string]string
+		expected string
+	}{
+		{name: "variable set", env: map[string]string{"COMPOSE_PROJECT_NAME": "custom"}, expected: "custom"},
+		{name: "default value", env: map[string]string{}, expected: "myapp"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			project, err := Load(buildConfigDetails(yaml, tc.env))
+			assert.NilError(t, err)
+			assert.Equal(t, project.Name, tc.expected)
+			assert.Equal(t, project.Networks["default"].Name, tc.expected+"_default")
+			assert.Equal(t, project.Volumes["data"].Name, tc.expected+"_data")
+			assert.Equal(t, project.Environment[consts.ComposeProjectName], tc.expected)
+		})
+	}
+
+	t.Run("read from file", func(t *testing.T) {
+		dir := t.TempDir()
+		file := filepath.Join(dir, "compose.yaml")
+		assert.NilError(t, os.WriteFile(file, []byte(yaml), 0o644))
+		project, err := Load(types.ConfigDetails{
+			WorkingDir:  dir,
+			ConfigFiles: []types.ConfigFile{{Filename: file}},
+			Environment: map[string]string{},
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, project.Name, "myapp")
+		assert.Equal(t, project.Networks["default"].Name, "myapp_default")
+	})
+}
+
+func TestLoadWithBindMountVolume(t *testing.T) {
+	dict := `
+name: load-with-bind-mount-volume
+services:
+  web:
+    image: web
+    volumes:
+     - data:/data
+volumes:
+  data:
+    driver: local
+    driver_opts:
+      type: 'none'
+      o: 'bind'
+      device: './data'
+`
+	configDetails := buildConfigDetails(dict, nil)
+
+	project, err := Load(configDetails)
+	assert.NilError(t, err)
+	path := project.Volumes["data"].DriverOpts["device"]
+	assert.Check(t, filepath.IsAbs(path))
+}
+
+func TestLoadServiceExtension(t *testing.T) {
+	dict := `
+name: test
+services:
+  extension: # this name should be allowed
+    image: web
+    x-foo: bar
+`
+	configDetails := buildConfigDetails(dict, nil)
+
+	project, err := Load(configDetails)
+	assert.NilError(t, err)
+	assert.Equal(t, project.Services[0].Name, "extension")
+	assert.Equal(t, project.Services[0].Extensions["x-foo"], "bar")
+}
+
+func TestDeviceWriteBps(t *testing.T) {
+	p, err := loadYAML(`
+        name: test
+        services:
+          foo:
+            image: busybox
+            blkio_config:
+              device_read_bps:
+              - path: /dev/test
+                rate: 1024k
+              device_write_bps:
+              - path: /dev/test
+                rate: 1024
+`)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, p.Services, types.Services{
+		{
+			Name:        "foo",
+			Image:       "busybox",
+			Environment: types.MappingWithEquals{},
+			Scale:       1,
+			BlkioConfig: &types.BlkioConfig{
+				DeviceReadBps: []types.ThrottleDevice{
+					{
+						Path: "/dev/test",
+						Rate: types.UnitBytes(1024 * 1024),
+					},
+				},
+				DeviceWriteBps: []types.ThrottleDevice{
+					{
+						Path: "/dev/test",
+						Rate: types.UnitBytes(1024),
+					},
+				},
+			},
+		},
+	})
+
+}
+
+func TestLoadDeprecationWarnings(t *testing.T) {
+	yaml := `
+version: "3.9"
+name: deprecated
+services:
+  web:
+    image: web
+    scale: 2
+    links:
+      - db
+    volumes_from:
+      - db
+  db:
+    image: db
+networks:
+  outside:
+    external:
+      name: outside
+`
+	project, err := Load(buildConfigDetails(yaml, nil))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Warnings(), []string{
+		"filename0.yml: `version` is obsolete, it is ignored and can be removed",
+		"filename0.yml: services.web.scale is deprecated, use `deploy.replicas`",
+		"filename0.yml: networks.outside.external.name is deprecated, use `name` along with `external: true`",
+	})
+
+	project, err = Load(buildConfigDetails(yaml, nil), func(options *Options) {
+		options.SkipDeprecationWarnings = true
+	})
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(project.Warnings(), 0))
+}
+
+func TestLoadWithExtendsDeepMerge(t *testing.T) {
+	yaml := `
+name: extends-deep-merge
+services:
+  base:
+    image: busybox
+    healthcheck:
+      test: ["CMD", "true"]
+      interval: 10s
+      retries: 3
+    deploy:
+      replicas: 2
+      resources:
+        limits:
+          cpus: "0.5"
+        reservations:
+          cpus: "0.25"
+      restart_policy:
+        condition: on-failure
+        max_attempts: 3
+  child:
+    extends: base
+    healthcheck:
+      interval: 30s
+    deploy:
+      resources:
+        limits:
+          memory: 512M
+        reservations:
+          memory: 128M
+      restart_policy:
+        max_attempts: 5
+`
+	project, err := Load(buildConfigDetails(yaml, nil))
+	assert.NilError(t, err)
+	child, err := project.GetService("child")
+	assert.NilError(t, err)
+
+	interval := types.Duration(30 * time.Second)
+	retries := uint64(3)
+	assert.DeepEqual(t, child.HealthCheck, &types.HealthCheckConfig{
+		Test:     types.HealthCheckTest{"CMD", "true"},
+		Interval: &interval,
+		Retries:  &retries,
+	})
+
+	replicas := uint64(2)
+	maxAttempts := uint64(5)
+	assert.DeepEqual(t, child.Deploy, &types.DeployConfig{
+		Replicas: &replicas,
+		Resources: types.Resources{
+			Limits:       &types.Resource{NanoCPUs: "0.5", MemoryBytes: 512 * 1024 * 1024},
+			Reservations: &types.Resource{NanoCPUs: "0.25", MemoryBytes: 128 * 1024 * 1024},
+		},
+		RestartPolicy: &types.RestartPolicy{Condition: "on-failure", MaxAttempts: &maxAttempts},
+	})
+
+	base, err := project.GetService("base")
+	assert.NilError(t, err)
+	assert.Equal(t, base.Deploy.Resources.Limits.MemoryBytes, types.UnitBytes(0))
+	assert.Equal(t, *base.Deploy.RestartPolicy.MaxAttempts, uint64(3))
+}
+
+func TestLoadWithStrictUnknownFields(t *testing.T) {
+	b, err := os.ReadFile("full-example.yml")
+	assert.NilError(t, err)
+	_, err = Load(buildConfigDetails(string(b), map[string]string{"BAR": "this is a secret"}), WithStrictUnknownFields(), func(options *Options) {
+		options.SkipNormalization = true
+		options.SkipConsistencyCheck = true
+	})
+	assert.NilError(t, err)
+
+	_, err = Load(buildConfigDetails(`
+name: strict
+services:
+  foo:
+    image: busybox
+networks:
+  "front net": {}
+`, nil), WithStrictUnknownFields())
+	assert.ErrorContains(t, err, "Additional property front net is not allowed")
+}
+
+func TestLoadExtensionsOnAllResources(t *testing.T) {
+	project, err := Load(buildConfigDetails(`
+name: extensions
+x-myteam-project: project
+services:
+  web:
+    image: web
+    x-myteam-service: service
+networks:
+  front:
+    x-myteam-network: network
+volumes:
+  data:
+    x-myteam-volume: volume
+configs:
+  conf:
+    file: ./config
+    x-myteam-config: config
+secrets:
+  key:
+    file: ./secret
+    x-myteam-secret: secret
+`, nil))
+	assert.NilError(t, err)
+
+	assert.DeepEqual(t, project.Extensions, types.Extensions{"x-myteam-project": "project"})
+	web, err := project.GetService("web")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, web.Extensions, types.Extensions{"x-myteam-service": "service"})
+	assert.DeepEqual(t, project.Networks["front"].Extensions, types.Extensions{"x-myteam-network": "network"})
+	assert.DeepEqual(t, project.Volumes["data"].Extensions, types.Extensions{"x-myteam-volume": "volume"})
+	assert.DeepEqual(t, project.Configs["conf"].Extensions, types.Extensions{"x-myteam-config": "config"})
+	assert.DeepEqual(t, project.Secrets["key"].Extensions, types.Extensions{"x-myteam-secret": "secret"})
+
+	v, ok, err := types.GetExtension[string](project.Secrets["key"].Extensions, "x-myteam-secret")
+	assert.NilError(t, err)
+	assert.Check(t, ok)
+	assert.Equal(t, v, "secret")
+}
+
+func TestLoadDevelopWatch(t *testing.T) {
+	yaml := `
+name: develop
+services:
+  web:
+    build: .
+    develop:
+      watch:
+        - path: ./src
+          action: sync
+          target: /app/src
+          ignore:
+            - node_modules/
+        - path: package.json
+          action: rebuild
+        - path: ./config
+          action: sync+restart
+          target: /app/config
+`
+	project, err := Load(buildConfigDetails(yaml, nil), func(options *Options) {
+		options.ResolvePaths = true
+	})
+	assert.NilError(t, err)
+	web, err := project.GetService("web")
+	assert.NilError(t, err)
+	wd, err := os.Getwd()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, web.Develop, &types.DevelopConfig{
+		Watch: []types.WatchConfig{
+			{Path: filepath.Join(wd, "src"), Action: types.WatchActionSync, Target: "/app/src", Ignore: []string{"node_modules/"}},
+			{Path: filepath.Join(wd, "package.json"), Action: types.WatchActionRebuild},
+			{Path: filepath.Join(wd, "config"), Action: types.WatchActionSyncRestart, Target: "/app/config"},
+		},
+	})
+
+	marshalled, err := project.MarshalYAML()
+	assert.NilError(t, err)
+	reloaded, err := Load(buildConfigDetails(string(marshalled), nil))
+	assert.NilError(t, err)
+	reloadedWeb, err := reloaded.GetService("web")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, reloadedWeb.Develop, web.Develop)
+
+	_, err = Load(buildConfigDetails(`
+name: develop
+services:
+  web:
+    image: web
+    develop:
+      watch:
+        - path: ./src
+          action: copy
+`, nil))
+	assert.ErrorContains(t, err, "services.web.develop.watch.0.action must be one of the following")
+
+	_, err = Load(buildConfigDetails(`
+name: develop
+services:
+  web:
+    image: web
+    develop:
+      watch:
+        - action: rebuild
+`, nil))
+	assert.ErrorContains(t, err, "path is required")
+
+	_, err = Load(buildConfigDetails(`
+name: develop
+services:
+  web:
+    image: web
+    develop:
+      watch:
+        - path: ./src
+          action: sync
+`, nil))
+	assert.Error(t, err, `service "web" develop.watch[0] requires a target for action sync: invalid compose project`)
+}
+
+func TestLoadBuildSecrets(t *testing.T) {
+	yaml := `
+name: build-secrets
+services:
+  web:
     build:
       context: .
-      ssh: 
-        - key1=value1
-        - key2=value2
-`)
+      secrets:
+        - token
+        - source: certificate
+          target: /run/secrets/cert.pem
+          uid: "103"
+          gid: "103"
+          mode: 0440
+secrets:
+  token:
+    environment: TOKEN
+  certificate:
+    file: ./cert.pem
+`
+	project, err := Load(buildConfigDetails(yaml, map[string]string{"TOKEN": "secret"}))
+	assert.NilError(t, err)
+	web, err := project.GetService("web")
+	assert.NilError(t, err)
+	expected := []types.ServiceSecretConfig{
+		{Source: "token"},
+		{Source: "certificate", Target: "/run/secrets/cert.pem", UID: "103", GID: "103", Mode: uint32Ptr(0o440)},
+	}
+	assert.DeepEqual(t, web.Build.Secrets, expected)
+
+	marshalled, err := project.MarshalYAML()
 	assert.NilError(t, err)
-	svc, err := actual.GetService("test")
+	reloaded, err := Load(buildConfigDetails(string(marshalled), map[string]string{"TOKEN": "secret"}))
+	assert.NilError(t, err)
+	reloadedWeb, err := reloaded.GetService("web")
 	assert.NilError(t, err)
+	assert.DeepEqual(t, reloadedWeb.Build.Secrets, expected)
 
-	sshValue, err := svc.Build.SSH.Get("key1")
+	_, err = Load(buildConfigDetails(`
+name: build-secrets
+services:
+  web:
+    build:
+      context: .
+      secrets:
+        - missing
+`, nil))
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "web" refers to undefined build secret missing`)
+}
+
+func TestLoadCommandForm(t *testing.T) {
+	project, err := Load(buildConfigDetails(`
+name: command
+services:
+  shell:
+    image: alpine
+    entrypoint: /entrypoint.sh --verbose
+    command: sh -c "echo hi && echo 'bye'"
+  exec:
+    image: alpine
+    command: ["sh", "-c", "echo hi"]
+`, nil))
 	assert.NilError(t, err)
-	assert.Equal(t, "value1", sshValue)
+	shell, err := project.GetService("shell")
+	assert.NilError(t, err)
+	assert.Equal(t, shell.CommandForm, types.CommandFormShell)
+	assert.DeepEqual(t, shell.CommandArgs(), []string{"sh", "-c", "echo hi && echo 'bye'"})
+	assert.Equal(t, shell.EntrypointForm, types.CommandFormShell)
+	assert.DeepEqual(t, shell.EntrypointArgs(), []string{"/entrypoint.sh", "--verbose"})
 
-	sshValue, err = svc.Build.SSH.Get("key2")
+	exec, err := project.GetService("exec")
 	assert.NilError(t, err)
-	assert.Equal(t, "value2", sshValue)
+	assert.Equal(t, exec.CommandForm, types.CommandFormExec)
+	assert.DeepEqual(t, exec.CommandArgs(), []string{"sh", "-c", "echo hi"})
+	assert.Equal(t, exec.EntrypointForm, types.CommandForm(""))
+	assert.Check(t, exec.EntrypointArgs() == nil)
 }
 
-func TestProjectNameInterpolation(t *testing.T) {
-	t.Run("project name simple interpolation", func(t *testing.T) {
-		yaml := `
-name: interpolated
+func TestLoadAnnotations(t *testing.T) {
+	project, err := Load(buildConfigDetails(`
+name: annotations
 services:
-  web:
+  map:
     image: web
-    container_name: ${COMPOSE_PROJECT_NAME}-web
-`
-		configDetails := buildConfigDetails(yaml, map[string]string{})
+    annotations:
+      com.example.foo: bar
+    labels:
+      com.example.foo: label
+  list:
+    image: web
+    annotations:
+      - com.example.foo=bar
+      - com.example.empty=
+    labels:
+      - com.example.label=true
+`, nil))
+	assert.NilError(t, err)
+	m, err := project.GetService("map")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, m.Annotations, types.Labels{"com.example.foo": "bar"})
+	assert.DeepEqual(t, m.Labels, types.Labels{"com.example.foo": "label"})
+	list, err := project.GetService("list")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, list.Annotations, types.Labels{"com.example.foo": "bar", "com.example.empty": ""})
+	assert.DeepEqual(t, list.Labels, types.Labels{"com.example.label": "true"})
 
-		actual, err := Load(configDetails)
-		assert.NilError(t, err)
-		svc, err := actual.GetService("web")
+	marshalled, err := project.MarshalYAML()
+	assert.NilError(t, err)
+	reloaded, err := Load(buildConfigDetails(string(marshalled), nil))
+	assert.NilError(t, err)
+	for _, service := range project.Services {
+		s, err := reloaded.GetService(service.Name)
 		assert.NilError(t, err)
-		assert.Equal(t, "interpolated-web", svc.ContainerName)
-	})
+		assert.DeepEqual(t, s.Annotations, service.Annotations)
+		assert.DeepEqual(t, s.Labels, service.Labels)
+	}
 
-	t.Run("project name interpolation with override", func(t *testing.T) {
-		yaml1 := `
-name: interpolated
+	_, err = Load(buildConfigDetails(`
+name: annotations
 services:
   web:
     image: web
-    container_name: ${COMPOSE_PROJECT_NAME}-web
-`
-		yaml2 := `
-name: overrided
+    annotations:
+      - "=bar"
+`, nil))
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "web" declares invalid annotation key ""`)
+}
+
+func TestLoadDependsOnRequired(t *testing.T) {
+	project, err := Load(buildConfigDetails(`
+name: depends-on-required
 services:
+  web:
+    image: web
+    depends_on:
+      db:
+        condition: service_healthy
+      cache:
+        condition: service_started
+        required: false
+      metrics:
+        condition: service_started
+        required: true
   db:
     image: db
-    container_name: ${COMPOSE_PROJECT_NAME}-db
-`
-		yaml3 := `
-services:
-  proxy:
-    image: proxy
-    container_name: ${COMPOSE_PROJECT_NAME}-proxy
-`
-		configDetails := buildConfigDetailsMultipleFiles(map[string]string{}, yaml1, yaml2, yaml3)
+  metrics:
+    image: metrics
+`, nil))
+	assert.NilError(t, err)
+	web, err := project.GetService("web")
+	assert.NilError(t, err)
+	assert.Check(t, web.DependsOn["db"].Required == nil)
+	assert.Check(t, web.DependsOn["db"].IsRequired())
+	assert.Check(t, !web.DependsOn["cache"].IsRequired())
+	assert.Check(t, web.DependsOn["metrics"].IsRequired())
+	assert.DeepEqual(t, project.WarningMessages, []string{`service "web" depends on undefined service cache, which is ignored as it is not required`})
 
-		actual, err := Load(configDetails)
-		assert.NilError(t, err)
-		svc, err := actual.GetService("web")
-		assert.NilError(t, err)
-		assert.Equal(t, "overrided-web", svc.ContainerName)
+	marshalled, err := project.MarshalYAML()
+	assert.NilError(t, err)
+	reloaded, err := Load(buildConfigDetails(string(marshalled), nil))
+	assert.NilError(t, err)
+	reloadedWeb, err := reloaded.GetService("web")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, reloadedWeb.DependsOn, web.DependsOn)
 
-		svc, err = actual.GetService("db")
-		assert.NilError(t, err)
-		assert.Equal(t, "overrided-db", svc.ContainerName)
+	_, err = Load(buildConfigDetails(`
+name: depends-on-required
+services:
+  web:
+    image: web
+    depends_on:
+      cache:
+        condition: service_started
+        required: true
+`, nil))
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "web" depends on undefined service cache`)
+}
+
+func TestLoadRestartPolicy(t *testing.T) {
+	project, err := Load(buildConfigDetails(`
+name: restart
+services:
+  web:
+    image: web
+    restart: on-failure:3
+`, nil))
+	assert.NilError(t, err)
+	web, err := project.GetService("web")
+	assert.NilError(t, err)
+	policy, err := types.ParseRestartPolicy(web.Restart)
+	assert.NilError(t, err)
+	assert.Equal(t, policy.Policy, types.RestartPolicyOnFailure)
+	assert.Equal(t, *policy.MaxRetries, 3)
 
-		svc, err = actual.GetService("proxy")
-		assert.NilError(t, err)
-		assert.Equal(t, "overrided-proxy", svc.ContainerName)
-	})
+	marshalled, err := project.MarshalYAML()
+	assert.NilError(t, err)
+	assert.Check(t, strings.Contains(string(marshalled), "restart: on-failure:3"))
 
-	t.Run("project name env variable interpolation", func(t *testing.T) {
-		yaml := `
-name: interpolated
+	_, err = Load(buildConfigDetails(`
+name: restart
 services:
   web:
     image: web
-    container_name: ${COMPOSE_PROJECT_NAME}-web
-`
-		configDetails := buildConfigDetails(yaml, map[string]string{"COMPOSE_PROJECT_NAME": "env-var"})
-		actual, err := Load(configDetails)
-		assert.NilError(t, err)
-		svc, err := actual.GetService("web")
-		assert.NilError(t, err)
-		assert.Equal(t, "env-var-web", svc.ContainerName)
+    restart: on-failure:abc
+`, nil))
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "web": invalid restart policy "on-failure:abc"`)
+}
+
+func TestLoadBuildCacheOptions(t *testing.T) {
+	project, err := Load(buildConfigDetails(`
+name: cache
+services:
+  web:
+    build:
+      context: .
+      cache_from:
+        - user/app:cache
+        - type=local,src=/tmp/cache
+      cache_to:
+        - type=gha,mode=max
+`, nil))
+	assert.NilError(t, err)
+	web, err := project.GetService("web")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, web.Build.CacheFrom, types.StringList{"user/app:cache", "type=local,src=/tmp/cache"})
+	cacheFrom, err := web.Build.CacheFromOptions()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, cacheFrom, []types.CacheOptions{
+		{Type: types.CacheTypeRegistry, Params: map[string]string{"ref": "user/app:cache"}},
+		{Type: types.CacheTypeLocal, Params: map[string]string{"src": "/tmp/cache"}},
 	})
+	cacheTo, err := web.Build.CacheToOptions()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, cacheTo, []types.CacheOptions{{Type: types.CacheTypeGHA, Params: map[string]string{"mode": "max"}}})
+
+	project, err = Load(buildConfigDetails(`
+name: cache
+services:
+  web:
+    build:
+      context: .
+      cache_to:
+        - type=azblob,name=cache
+`, nil))
+	assert.NilError(t, err)
+	web, err = project.GetService("web")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, web.Build.CacheTo, types.StringList{"type=azblob,name=cache"})
+
+	_, err = Load(buildConfigDetails(`
+name: cache
+services:
+  web:
+    build:
+      context: .
+      cache_to:
+        - type=registry,mode=max
+`, nil))
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "web" build.cache_to: invalid cache "type=registry,mode=max", registry cache requires a ref`)
 }
 
-func TestLoadWithBindMountVolume(t *testing.T) {
-	dict := `
-name: load-with-bind-mount-volume
+func TestLoadUlimits(t *testing.T) {
+	yaml := `
+name: ulimits
 services:
   web:
     image: web
-    volumes:
-     - data:/data
-volumes:
-  data:
-    driver: local
-    driver_opts:
-      type: 'none'
-      o: 'bind'
-      device: './data'
+    ulimits:
+      nproc: 65535
+      nofile:
+        soft: 20000
+        hard: 40000
 `
-	configDetails := buildConfigDetails(dict, nil)
+	project, err := Load(buildConfigDetails(yaml, nil))
+	assert.NilError(t, err)
+	web, err := project.GetService("web")
+	assert.NilError(t, err)
+	expected := map[string]*types.UlimitsConfig{
+		"nproc":  {Single: 65535},
+		"nofile": {Soft: 20000, Hard: 40000},
+	}
+	assert.DeepEqual(t, web.Ulimits, expected)
 
-	project, err := Load(configDetails)
+	marshalled, err := project.MarshalYAML()
 	assert.NilError(t, err)
-	path := project.Volumes["data"].DriverOpts["device"]
-	assert.Check(t, filepath.IsAbs(path))
-}
+	reloaded, err := Load(buildConfigDetails(string(marshalled), nil))
+	assert.NilError(t, err)
+	reloadedWeb, err := reloaded.GetService("web")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, reloadedWeb.Ulimits, expected)
 
-func TestLoadServiceExtension(t *testing.T) {
-	dict := `
-name: test
+	_, err = Load(buildConfigDetails(`
+name: ulimits
 services:
-  extension: # this name should be allowed
+  web:
     image: web
-    x-foo: bar
-`
-	configDetails := buildConfigDetails(dict, nil)
+    ulimits:
+      nofile:
+        soft: 40000
+        hard: 20000
+`, nil))
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "web" ulimit nofile soft limit 40000 exceeds hard limit 20000`)
+
+	_, err = Load(buildConfigDetails(`
+name: ulimits
+services:
+  web:
+    image: web
+    ulimits:
+      nofile:
+        soft: -1
+        hard: 20000
+`, nil))
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "web" ulimit nofile soft limit unlimited exceeds hard limit 20000`)
+
+	project, err = Load(buildConfigDetails(`
+name: ulimits
+services:
+  web:
+    image: web
+    ulimits:
+      memlock:
+        soft: -1
+        hard: -1
+      nofile:
+        soft: 20000
+        hard: -1
+      nofiles: 1024
+`, nil))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.WarningMessages, []string{`service "web" declares unknown ulimit "nofiles"`})
+}
 
-	project, err := Load(configDetails)
+func TestLoadServicesByLabel(t *testing.T) {
+	project, err := Load(buildConfigDetails(`
+name: labels
+services:
+  web:
+    image: web
+    labels:
+      tier: frontend
+  admin:
+    image: admin
+    labels:
+      - tier=frontend
+      - team=ops
+  db:
+    image: db
+    labels:
+      - tier=backend
+`, nil))
 	assert.NilError(t, err)
-	assert.Equal(t, project.Services[0].Name, "extension")
-	assert.Equal(t, project.Services[0].Extensions["x-foo"], "bar")
+	var names []string
+	for _, s := range project.ServicesByLabel("tier", "frontend") {
+		names = append(names, s.Name)
+	}
+	sort.Strings(names)
+	assert.DeepEqual(t, names, []string{"admin", "web"})
+	assert.DeepEqual(t, project.ServiceLabels("admin"), types.Labels{"tier": "frontend", "team": "ops"})
 }
 
-func TestDeviceWriteBps(t *testing.T) {
-	p, err := loadYAML(`
-        name: test
-        services:
-          foo:
-            image: busybox
-            blkio_config:
-              device_read_bps:
-              - path: /dev/test
-                rate: 1024k
-              device_write_bps:
-              - path: /dev/test
-                rate: 1024
+func TestCheckVariables(t *testing.T) {
+	content := []byte(`
+name: ${NAME:?project name is required}
+services:
+  web:
+    image: ${IMAGE}
+    environment:
+      PASSWORD: ${PASSWORD?}
+      BROKEN: ${BROKEN
+    deploy:
+      replicas: ${REPLICAS:-1}
+`)
+	err := CheckVariables(content, types.Mapping{"IMAGE": "nginx"})
+	var multiErr *interp.MultiError
+	assert.Assert(t, errors.As(err, &multiErr))
+	errs := multiErr.Errors()
+	assert.Equal(t, len(errs), 3)
+	assert.Check(t, is.ErrorContains(errs[0], "required variable NAME is missing a value: project name is required"))
+	assert.Check(t, is.ErrorContains(errs[1], "invalid interpolation format for services.web.environment.BROKEN"))
+	assert.Check(t, is.ErrorContains(errs[2], "required variable PASSWORD is missing a value"))
+
+	assert.NilError(t, CheckVariables(content[:strings.Index(string(content), "      BROKEN")], types.Mapping{
+		"NAME":     "app",
+		"IMAGE":    "nginx",
+		"PASSWORD": "secret",
+	}))
+}
+
+func TestLoadSysctlsRoundTrip(t *testing.T) {
+	load := func(sysctls string) (*types.Project, error) {
+		return Load(buildConfigDetails(`
+name: sysctls
+services:
+  web:
+    image: web
+    sysctls:
+`+sysctls, nil))
+	}
+	fromList, err := load(`
+      - net.core.somaxconn=1024
+      - net.ipv4.tcp_syncookies=0
+      - kernel.shmmax=68719476736
 `)
 	assert.NilError(t, err)
-	assert.DeepEqual(t, p.Services, types.Services{
-		{
-			Name:        "foo",
-			Image:       "busybox",
-			Environment: types.MappingWithEquals{},
-			Scale:       1,
-			BlkioConfig: &types.BlkioConfig{
-				DeviceReadBps: []types.ThrottleDevice{
-					{
-						Path: "/dev/test",
-						Rate: types.UnitBytes(1024 * 1024),
-					},
-				},
-				DeviceWriteBps: []types.ThrottleDevice{
-					{
-						Path: "/dev/test",
-						Rate: types.UnitBytes(1024),
-					},
-				},
-			},
-		},
+	fromMap, err := load(`
+      net.core.somaxconn: 1024
+      net.ipv4.tcp_syncookies: 0
+      kernel.shmmax: "68719476736"
+`)
+	assert.NilError(t, err)
+	expected := types.Mapping{
+		"net.core.somaxconn":      "1024",
+		"net.ipv4.tcp_syncookies": "0",
+		"kernel.shmmax":           "68719476736",
+	}
+	assert.DeepEqual(t, fromList.Services[0].Sysctls, expected)
+	assert.DeepEqual(t, fromMap.Services[0].Sysctls, expected)
+
+	marshalled, err := fromList.MarshalYAML()
+	assert.NilError(t, err)
+	reloaded, err := Load(buildConfigDetails(string(marshalled), nil))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, reloaded.Services[0].Sysctls, expected)
+
+	_, err = load(`
+      - net.core.somaxconn = 1024
+`)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `service "web" declares invalid sysctl name "net.core.somaxconn "`)
+}
+
+func TestLoadSysctlsWarnings(t *testing.T) {
+	project, err := Load(buildConfigDetails(`
+name: sysctls
+services:
+  web:
+    image: web
+    network_mode: host
+    ipc: host
+    sysctls:
+      net.core.somaxconn: 1024
+      kernel.shmmax: 1024
+      vm.swappiness: 10
+  privileged:
+    image: web
+    privileged: true
+    sysctls:
+      vm.swappiness: 10
+`, nil))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.WarningMessages, []string{
+		"service web sets sysctl kernel.shmmax, which can't be set with `ipc: host`",
+		"service web sets sysctl net.core.somaxconn, which can't be set with `network_mode: host`",
+		"service web sets sysctl vm.swappiness, which is not namespaced and requires `privileged: true`",
+	})
+}
+
+func TestLoadExtendsCycle(t *testing.T) {
+	_, err := Load(buildConfigDetails(`
+name: extends-cycle
+services:
+  a:
+    image: a
+    extends: a
+`, nil))
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "extends cycle: a -> a")
+
+	_, err = Load(buildConfigDetails(`
+name: extends-cycle
+services:
+  a:
+    image: a
+    extends: b
+  b:
+    image: b
+    extends: a
+`, nil))
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "extends cycle: ")
+	assert.Check(t, strings.Contains(err.Error(), "a -> b -> a") || strings.Contains(err.Error(), "b -> a -> b"), err.Error())
+}
+
+func TestLoadExtendsDepth(t *testing.T) {
+	yaml := `
+name: extends-depth
+services:
+  a:
+    extends: b
+  b:
+    extends: c
+  c:
+    extends: d
+  d:
+    image: d
+    environment:
+      FROM: d
+`
+	project, err := Load(buildConfigDetails(yaml, nil), func(o *Options) {
+		o.MaxExtendsDepth = 3
 	})
+	assert.NilError(t, err)
+	a, err := project.GetService("a")
+	assert.NilError(t, err)
+	assert.Equal(t, a.Image, "d")
+	assert.DeepEqual(t, a.Environment, types.MappingWithEquals{"FROM": strPtr("d")})
 
+	_, err = Load(buildConfigDetails(yaml, nil), func(o *Options) {
+		o.MaxExtendsDepth = 2
+	})
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, "extends depth exceeds the maximum of 2: a -> b -> c -> d")
 }
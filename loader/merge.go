@@ -17,6 +17,7 @@
 package loader
 
 import (
+	"fmt"
 	"reflect"
 	"sort"
 
@@ -38,6 +39,8 @@ var serviceSpecials = &specials{
 		reflect.TypeOf([]types.ServiceSecretConfig{}):    mergeSlice(toServiceSecretConfigsMap, toServiceSecretConfigsSlice),
 		reflect.TypeOf([]types.ServiceConfigObjConfig{}): mergeSlice(toServiceConfigObjConfigsMap, toSServiceConfigObjConfigsSlice),
 		reflect.TypeOf(&types.UlimitsConfig{}):           mergeUlimitsConfig,
+		reflect.TypeOf(types.Extensions{}):               mergeServiceExtensions,
+		reflect.TypeOf(types.HostsList{}):                mergeHostsList,
 	},
 }
 
@@ -57,12 +60,38 @@ func (s *specials) Transformer(t reflect.Type) func(dst, src reflect.Value) erro
 	return nil
 }
 
-func merge(configs []*types.Config) (*types.Config, error) {
+// MergeStrategy is how a list attribute of a service is merged with the one of the service it overrides
+type MergeStrategy string
+
+const (
+	// MergeAppend appends the items of the override list to the base ones
+	MergeAppend MergeStrategy = "append"
+	// MergeReplace replaces the base list with the override one, if set
+	MergeReplace MergeStrategy = "replace"
+	// MergeByKey replaces the base items with the override items sharing the same key, like the container
+	// target of `ports` and `volumes`, and appends the other ones
+	MergeByKey MergeStrategy = "merge-by-key"
+)
+
+// MergeOptions selects the MergeStrategy used for service list attributes, by attribute name. Supported
+// attributes are `ports`, by target port and protocol, and `volumes`, by target path. Attributes which are
+// not set are merged with the default rules
+type MergeOptions map[string]MergeStrategy
+
+// merge configs in order, each one on top of the previous ones. resets, if set, lists for each config the
+// paths tagged `!reset` or `!override`, for which previous values are discarded
+func merge(configs []*types.Config, resets []resetPaths, mergeOpts MergeOptions) (*types.Config, error) {
+	if len(configs) == 0 {
+		return nil, errors.New("no compose file to merge")
+	}
 	base := configs[0]
-	for _, override := range configs[1:] {
+	for i, override := range configs[1:] {
+		if i+1 < len(resets) {
+			resets[i+1].apply(base)
+		}
 		var err error
 		base.Name = mergeNames(base.Name, override.Name)
-		base.Services, err = mergeServices(base.Services, override.Services)
+		base.Services, err = mergeServices(base.Services, override.Services, mergeOpts)
 		if err != nil {
 			return base, errors.Wrapf(err, "cannot merge services from %s", override.Filename)
 		}
@@ -90,6 +119,60 @@ func merge(configs []*types.Config) (*types.Config, error) {
 	return base, nil
 }
 
+// MergeProjects merges overlays on top of base, from left to right: each overlay takes precedence over base
+// and the overlays at its left, with the same rules as when merging compose files. As typed projects don't retain
+// YAML tags, the attributes an overlay tags `!reset` or `!override` are set by its ResetPaths: their values are
+// discarded from the projects at its left before merge. The merged project keeps the ResetPaths of all the projects.
+// The merged project is a copy, neither base nor overlays are modified.
+func MergeProjects(base *types.Project, overlays ...*types.Project) (*types.Project, error) {
+	merged := base.Clone()
+	for _, overlay := range overlays {
+		overlay := overlay.Clone()
+		config, err := merge([]*types.Config{projectToConfig(merged), projectToConfig(overlay)},
+			[]resetPaths{nil, overlay.ResetPaths}, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot merge project %s", overlay.Name)
+		}
+		merged.Name = config.Name
+		merged.Services = config.Services
+		merged.Networks = config.Networks
+		merged.Volumes = config.Volumes
+		merged.Secrets = config.Secrets
+		merged.Configs = config.Configs
+		merged.Extensions = config.Extensions
+
+		merged.DisabledServices, err = mergeServices(merged.DisabledServices, overlay.DisabledServices, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot merge services from project %s", overlay.Name)
+		}
+		if overlay.WorkingDir != "" {
+			merged.WorkingDir = overlay.WorkingDir
+		}
+		merged.ComposeFiles = append(merged.ComposeFiles, overlay.ComposeFiles...)
+		if merged.Environment == nil {
+			merged.Environment = types.Mapping{}
+		}
+		for k, v := range overlay.Environment {
+			merged.Environment[k] = v
+		}
+		merged.Profiles = unique(append(merged.Profiles, overlay.Profiles...))
+		merged.ResetPaths = append(merged.ResetPaths, overlay.ResetPaths...)
+	}
+	return merged, nil
+}
+
+func projectToConfig(p *types.Project) *types.Config {
+	return &types.Config{
+		Name:       p.Name,
+		Services:   p.Services,
+		Networks:   p.Networks,
+		Volumes:    p.Volumes,
+		Secrets:    p.Secrets,
+		Configs:    p.Configs,
+		Extensions: p.Extensions,
+	}
+}
+
 func mergeNames(base, override string) string {
 	if override != "" {
 		return override
@@ -97,16 +180,21 @@ func mergeNames(base, override string) string {
 	return base
 }
 
-func mergeServices(base, override []types.ServiceConfig) ([]types.ServiceConfig, error) {
+func mergeServices(base, override []types.ServiceConfig, mergeOpts MergeOptions) ([]types.ServiceConfig, error) {
 	baseServices := mapByName(base)
 	overrideServices := mapByName(override)
 	for name, overrideService := range overrideServices {
 		overrideService := overrideService
 		if baseService, ok := baseServices[name]; ok {
+			basePorts := append([]types.ServicePortConfig(nil), baseService.Ports...)
+			baseVolumes := append([]types.ServiceVolumeConfig(nil), baseService.Volumes...)
 			merged, err := _merge(&baseService, &overrideService)
 			if err != nil {
 				return nil, errors.Wrapf(err, "cannot merge service %s", name)
 			}
+			if err := applyMergeOptions(merged, basePorts, baseVolumes, &overrideService, mergeOpts); err != nil {
+				return nil, errors.Wrapf(err, "cannot merge service %s", name)
+			}
 			baseServices[name] = *merged
 			continue
 		}
@@ -120,6 +208,67 @@ func mergeServices(base, override []types.ServiceConfig) ([]types.ServiceConfig,
 	return services, nil
 }
 
+// applyMergeOptions overrides the default merge of the lists attributes selected by mergeOpts
+func applyMergeOptions(merged *types.ServiceConfig, basePorts []types.ServicePortConfig, baseVolumes []types.ServiceVolumeConfig,
+	override *types.ServiceConfig, mergeOpts MergeOptions) error {
+	for attribute, strategy := range mergeOpts {
+		var err error
+		switch attribute {
+		case "ports":
+			merged.Ports, err = mergeList(strategy, basePorts, override.Ports, merged.Ports, func(p types.ServicePortConfig) string {
+				protocol := p.Protocol
+				if protocol == "" {
+					// the long syntax has no default protocol, the short syntax sets tcp
+					protocol = "tcp"
+				}
+				return fmt.Sprintf("%d/%s", p.Target, protocol)
+			})
+		case "volumes":
+			merged.Volumes, err = mergeList(strategy, baseVolumes, override.Volumes, merged.Volumes, func(v types.ServiceVolumeConfig) string {
+				return v.Target
+			})
+		default:
+			err = errors.Errorf("merge strategy can't be set for attribute %q", attribute)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeList merges the base and override lists according to strategy. merged is the result of the default merge rules
+func mergeList[T any](strategy MergeStrategy, base, override, merged []T, key func(T) string) ([]T, error) {
+	switch strategy {
+	case "":
+		return merged, nil
+	case MergeAppend:
+		return append(base, override...), nil
+	case MergeReplace:
+		if override == nil {
+			return base, nil
+		}
+		return override, nil
+	case MergeByKey:
+		result := append([]T(nil), base...)
+		index := map[string]int{}
+		for i, item := range result {
+			index[key(item)] = i
+		}
+		for _, item := range override {
+			if i, ok := index[key(item)]; ok {
+				result[i] = item
+				continue
+			}
+			index[key(item)] = len(result)
+			result = append(result, item)
+		}
+		return result, nil
+	default:
+		return nil, errors.Errorf("unknown merge strategy %q", strategy)
+	}
+}
+
 func _merge(baseService *types.ServiceConfig, overrideService *types.ServiceConfig) (*types.ServiceConfig, error) {
 	if err := mergo.Merge(baseService, overrideService,
 		mergo.WithAppendSlice,
@@ -149,13 +298,14 @@ func unique(slice []string) []string {
 	if slice == nil {
 		return nil
 	}
+	// preserve order of first occurrence so that merge result is deterministic
 	uniqMap := make(map[string]struct{})
+	uniqSlice := make([]string, 0, len(slice))
 	for _, v := range slice {
+		if _, ok := uniqMap[v]; ok {
+			continue
+		}
 		uniqMap[v] = struct{}{}
-	}
-
-	uniqSlice := make([]string, 0, len(uniqMap))
-	for v := range uniqMap {
 		uniqSlice = append(uniqSlice, v)
 	}
 	return uniqSlice
@@ -338,6 +488,21 @@ func mergeUlimitsConfig(dst, src reflect.Value) error {
 	return nil
 }
 
+// mergeHostsList merges extra_hosts by host name, the addresses of a host declared by src replacing the
+// ones declared by dst
+func mergeHostsList(dst, src reflect.Value) error {
+	if src.Len() == 0 {
+		return nil
+	}
+	if dst.IsNil() {
+		dst.Set(reflect.MakeMap(dst.Type()))
+	}
+	for _, host := range src.MapKeys() {
+		dst.SetMapIndex(host, src.MapIndex(host))
+	}
+	return nil
+}
+
 func getLoggingDriver(v reflect.Value) string {
 	return v.FieldByName("Driver").String()
 }
@@ -370,10 +535,55 @@ func mergeConfigs(base, override map[string]types.ConfigObjConfig) (map[string]t
 	return base, err
 }
 
+// mergeExtensions merges extensions with the same rules as known attributes: mappings are merged recursively, by
+// key, sequences are appended, and other values are replaced. Values tagged `!reset` or `!override` in the override
+// file are discarded from base beforehand
 func mergeExtensions(base, override map[string]interface{}) (map[string]interface{}, error) {
 	if base == nil {
 		base = map[string]interface{}{}
 	}
-	err := mergo.Map(&base, &override, mergo.WithOverride)
-	return base, err
+	merged, _ := mergeExtensionValue(base, override).(map[string]interface{})
+	return merged, nil
+}
+
+func mergeExtensionValue(base, override interface{}) interface{} {
+	switch o := override.(type) {
+	case map[string]interface{}:
+		b, ok := base.(map[string]interface{})
+		if !ok {
+			return o
+		}
+		merged := make(map[string]interface{}, len(b)+len(o))
+		for k, v := range b {
+			merged[k] = v
+		}
+		for k, v := range o {
+			if bv, ok := merged[k]; ok {
+				v = mergeExtensionValue(bv, v)
+			}
+			merged[k] = v
+		}
+		return merged
+	case []interface{}:
+		b, ok := base.([]interface{})
+		if !ok {
+			return o
+		}
+		return append(append([]interface{}{}, b...), o...)
+	default:
+		return override
+	}
+}
+
+// mergeServiceExtensions merges the extensions of a service, or of one of its attributes like `build`
+func mergeServiceExtensions(dst, src reflect.Value) error {
+	if src.IsNil() {
+		return nil
+	}
+	merged, err := mergeExtensions(dst.Interface().(types.Extensions), src.Interface().(types.Extensions))
+	if err != nil {
+		return err
+	}
+	dst.Set(reflect.ValueOf(types.Extensions(merged)))
+	return nil
 }
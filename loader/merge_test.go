@@ -957,10 +957,12 @@ func TestLoadMultipleConfigs(t *testing.T) {
 				Scale:       1,
 			},
 			{
-				Name:       "foo",
-				Image:      "baz",
-				Entrypoint: types.ShellCommand{"ping"},
-				Command:    types.ShellCommand{"localhost"},
+				Name:           "foo",
+				Image:          "baz",
+				Entrypoint:     types.ShellCommand{"ping"},
+				EntrypointForm: types.CommandFormShell,
+				Command:        types.ShellCommand{"localhost"},
+				CommandForm:    types.CommandFormShell,
 				Build: &types.BuildConfig{
 					Context:    ".",
 					Dockerfile: "foo.Dockerfile",
@@ -1071,6 +1073,9 @@ func TestLoadMultipleNetworks(t *testing.T) {
 		Secrets:    types.Secrets{},
 		Configs:    types.Configs{},
 		Extensions: types.Extensions{},
+		WarningMessages: []string{
+			"override.yml: networks.hostnet.external.name is deprecated, use `name` along with `external: true`",
+		},
 	}, config)
 }
 
@@ -1342,14 +1347,14 @@ func TestMergeEnvironments(t *testing.T) {
 
 func TestMergeExtraHosts(t *testing.T) {
 	base := types.HostsList{
-		"kept":              "192.168.1.100",
-		"extra1.domain.org": "192.168.1.101",
-		"extra2.domain.org": "192.168.1.102",
+		"kept":              []string{"192.168.1.100"},
+		"extra1.domain.org": []string{"192.168.1.101"},
+		"extra2.domain.org": []string{"192.168.1.102"},
 	}
 	override := types.HostsList{
-		"extra1.domain.org": "10.0.0.1",
-		"extra2.domain.org": "10.0.0.2",
-		"added":             "10.0.0.3",
+		"extra1.domain.org": []string{"10.0.0.1"},
+		"extra2.domain.org": []string{"10.0.0.2"},
+		"added":             []string{"10.0.0.3"},
 	}
 	err := mergo.Merge(&base, &override, mergo.WithOverride)
 	assert.NilError(t, err)
@@ -1357,10 +1362,434 @@ func TestMergeExtraHosts(t *testing.T) {
 		t,
 		base,
 		types.HostsList{
-			"kept":              "192.168.1.100",
-			"extra1.domain.org": "10.0.0.1",
-			"extra2.domain.org": "10.0.0.2",
-			"added":             "10.0.0.3",
+			"kept":              []string{"192.168.1.100"},
+			"extra1.domain.org": []string{"10.0.0.1"},
+			"extra2.domain.org": []string{"10.0.0.2"},
+			"added":             []string{"10.0.0.3"},
 		},
 	)
 }
+
+func TestLoadMultipleExtraHosts(t *testing.T) {
+	project, err := loadTestProject(types.ConfigDetails{
+		Environment: map[string]string{},
+		ConfigFiles: []types.ConfigFile{
+			{Filename: "base.yml", Content: []byte(`
+name: merge-extra-hosts
+services:
+  web:
+    image: web
+    extra_hosts:
+      - kept:1.1.1.0
+      - extra1:1.1.1.1
+`)},
+			{Filename: "override.yml", Content: []byte(`
+services:
+  web:
+    extra_hosts:
+      - extra1:2.2.2.2
+      - added:3.3.3.3
+`)},
+		},
+	})
+	assert.NilError(t, err)
+	web, err := project.GetService("web")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, web.ExtraHosts, types.HostsList{
+		"kept":   []string{"1.1.1.0"},
+		"extra1": []string{"2.2.2.2"},
+		"added":  []string{"3.3.3.3"},
+	})
+}
+
+func TestMergeResetAndOverrideTags(t *testing.T) {
+	configDetails := types.ConfigDetails{
+		Environment: map[string]string{},
+		ConfigFiles: []types.ConfigFile{
+			{Filename: "base.yml", Content: []byte(`
+name: merge-reset-override
+services:
+  foo:
+    image: alpine
+    command: echo base
+    ports:
+      - "8080:80"
+      - "8443:443"
+    environment:
+      KEPT: base
+      REMOVED: base
+    build:
+      context: .
+      args:
+        FROM_BASE: base
+    labels:
+      com.example.base: "true"
+    x-base: true
+  bar:
+    image: alpine
+volumes:
+  data: {}
+`)},
+			{Filename: "override.yml", Content: []byte(`
+services:
+  foo:
+    command: !reset
+    ports: !override
+      - "9090:90"
+    environment:
+      REMOVED: !reset
+      ADDED: override
+    build:
+      args: !override
+        FROM_OVERRIDE: override
+    labels: !reset {}
+    x-base: !reset
+  bar: !reset
+volumes: !override
+  other: {}
+`)},
+		},
+	}
+	merged, err := loadTestProject(configDetails)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, merged.ServiceNames(), []string{"foo"})
+	assert.DeepEqual(t, merged.VolumeNames(), []string{"other"})
+
+	foo := merged.Services[0]
+	assert.Check(t, foo.Command == nil)
+	assert.DeepEqual(t, foo.Ports, []types.ServicePortConfig{
+		{Mode: "ingress", Target: 90, Published: "9090", Protocol: "tcp"},
+	})
+	assert.DeepEqual(t, foo.Environment, types.MappingWithEquals{
+		"KEPT":  strPtr("base"),
+		"ADDED": strPtr("override"),
+	})
+	assert.DeepEqual(t, foo.Build.Args, types.MappingWithEquals{
+		"FROM_OVERRIDE": strPtr("override"),
+	})
+	assert.Equal(t, len(foo.Labels), 0)
+	assert.Equal(t, len(foo.Extensions), 0)
+}
+
+func TestMergeNestedExtensions(t *testing.T) {
+	configDetails := types.ConfigDetails{
+		Environment: map[string]string{},
+		ConfigFiles: []types.ConfigFile{
+			{Filename: "base.yml", Content: []byte(`
+name: merge-extensions
+services:
+  foo:
+    image: alpine
+    x-metadata:
+      owner: base
+      tags: [a]
+      contact:
+        email: base@example.com
+        slack: "#base"
+x-metadata:
+  team: base
+  links:
+    docs: https://docs.example.com
+    chat: https://chat.example.com
+  replaced:
+    key: base
+  dropped: base
+`)},
+			{Filename: "override.yml", Content: []byte(`
+services:
+  foo:
+    x-metadata:
+      tags: [b]
+      contact:
+        email: override@example.com
+x-metadata:
+  links:
+    chat: https://chat.example.org
+    ci: https://ci.example.com
+  replaced: !override
+    other: override
+  dropped: !reset
+`)},
+		},
+	}
+	merged, err := loadTestProject(configDetails)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, merged.Extensions["x-metadata"], map[string]interface{}{
+		"team": "base",
+		"links": map[string]interface{}{
+			"docs": "https://docs.example.com",
+			"chat": "https://chat.example.org",
+			"ci":   "https://ci.example.com",
+		},
+		"replaced": map[string]interface{}{
+			"other": "override",
+		},
+	})
+	assert.DeepEqual(t, merged.Services[0].Extensions["x-metadata"], map[string]interface{}{
+		"owner": "base",
+		"tags":  []interface{}{"a", "b"},
+		"contact": map[string]interface{}{
+			"email": "override@example.com",
+			"slack": "#base",
+		},
+	})
+}
+
+func TestMergeProjects(t *testing.T) {
+	base := &types.Project{
+		Name:       "base",
+		WorkingDir: "/base",
+		Services: types.Services{
+			{
+				Name:   "foo",
+				Image:  "foo:base",
+				Labels: types.Labels{"base": "true"},
+				Ports:  []types.ServicePortConfig{{Target: 80, Published: "8080"}},
+			},
+		},
+		Networks:    types.Networks{"front": types.NetworkConfig{}},
+		Environment: types.Mapping{"FROM": "base", "BASE": "true"},
+	}
+	plugin := &types.Project{
+		Services: types.Services{
+			{
+				Name:   "foo",
+				Labels: types.Labels{"plugin": "true"},
+				Ports:  []types.ServicePortConfig{{Target: 443, Published: "8443"}},
+			},
+			{
+				Name:  "bar",
+				Image: "bar:plugin",
+			},
+		},
+		Volumes:     types.Volumes{"data": types.VolumeConfig{}},
+		Environment: types.Mapping{"FROM": "plugin"},
+	}
+	last := &types.Project{
+		Name: "last",
+		Services: types.Services{
+			{
+				Name:  "foo",
+				Image: "foo:last",
+			},
+		},
+	}
+
+	merged, err := MergeProjects(base, plugin, last)
+	assert.NilError(t, err)
+	assert.Equal(t, merged.Name, "last")
+	assert.Equal(t, merged.WorkingDir, "/base")
+	assert.DeepEqual(t, merged.ServiceNames(), []string{"bar", "foo"})
+	assert.DeepEqual(t, merged.NetworkNames(), []string{"front"})
+	assert.DeepEqual(t, merged.VolumeNames(), []string{"data"})
+	assert.DeepEqual(t, merged.Environment, types.Mapping{"FROM": "plugin", "BASE": "true"})
+
+	foo, err := merged.GetService("foo")
+	assert.NilError(t, err)
+	assert.Equal(t, foo.Image, "foo:last")
+	assert.DeepEqual(t, foo.Labels, types.Labels{"base": "true", "plugin": "true"})
+	assert.Equal(t, len(foo.Ports), 2)
+
+	// overlays tag attributes `!reset` or `!override` with ResetPaths
+	override := &types.Project{
+		Services: types.Services{
+			{
+				Name:  "foo",
+				Ports: []types.ServicePortConfig{{Target: 443, Published: "9443"}},
+			},
+		},
+		ResetPaths: [][]string{{"services", "foo", "ports"}, {"services", "foo", "labels"}, {"networks", "front"}},
+	}
+	merged, err = MergeProjects(base, plugin, override)
+	assert.NilError(t, err)
+	assert.Equal(t, len(merged.Networks), 0)
+	foo, err = merged.GetService("foo")
+	assert.NilError(t, err)
+	assert.Equal(t, foo.Image, "foo:base")
+	assert.Check(t, foo.Labels == nil)
+	assert.DeepEqual(t, foo.Ports, []types.ServicePortConfig{{Target: 443, Published: "9443"}})
+	assert.DeepEqual(t, merged.ResetPaths, override.ResetPaths)
+
+	// inputs are left unchanged
+	assert.Equal(t, base.Name, "base")
+	assert.Equal(t, len(base.Services), 1)
+	assert.DeepEqual(t, base.Services[0].Labels, types.Labels{"base": "true"})
+	assert.Equal(t, base.Environment["FROM"], "base")
+}
+
+func TestMergeLoadedProjectsWithResets(t *testing.T) {
+	base, err := loadTestProject(types.ConfigDetails{
+		Environment: map[string]string{},
+		ConfigFiles: []types.ConfigFile{{Filename: "base.yml", Content: []byte(`
+name: merge-resets
+services:
+  web:
+    image: web
+    ports:
+      - 8080:80
+    environment:
+      FOO: foo
+`)}},
+	})
+	assert.NilError(t, err)
+	overlay, err := loadTestProject(types.ConfigDetails{
+		Environment: map[string]string{},
+		ConfigFiles: []types.ConfigFile{{Filename: "overlay.yml", Content: []byte(`
+name: merge-resets
+services:
+  web:
+    ports: !override
+      - 9090:80
+    environment: !reset {}
+`)}},
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, overlay.ResetPaths, [][]string{{"services", "web", "ports"}, {"services", "web", "environment"}})
+
+	merged, err := MergeProjects(base, overlay)
+	assert.NilError(t, err)
+	web, err := merged.GetService("web")
+	assert.NilError(t, err)
+	assert.Equal(t, web.Image, "web")
+	assert.DeepEqual(t, web.Ports, []types.ServicePortConfig{{Mode: "ingress", Target: 80, Published: "9090", Protocol: "tcp"}})
+	assert.Equal(t, len(web.Environment), 0)
+}
+
+func TestLoadWithMergeOptions(t *testing.T) {
+	base := `
+name: merge-options
+services:
+  web:
+    image: web
+    ports:
+      - 8080:80
+      - 8443:443
+    volumes:
+      - /data:/data
+      - /logs:/logs
+`
+	override := `
+services:
+  web:
+    ports:
+      - 9090:80
+    volumes:
+      - /other-data:/data
+`
+	load := func(mergeOpts MergeOptions) (types.ServiceConfig, error) {
+		project, err := Load(types.ConfigDetails{
+			ConfigFiles: []types.ConfigFile{
+				{Filename: "base.yml", Content: []byte(base)},
+				{Filename: "override.yml", Content: []byte(override)},
+			},
+			Environment: map[string]string{},
+		}, func(o *Options) {
+			o.SkipNormalization = true
+			o.MergeOptions = mergeOpts
+		})
+		if err != nil {
+			return types.ServiceConfig{}, err
+		}
+		return project.GetService("web")
+	}
+	port := func(published string, target uint32) types.ServicePortConfig {
+		return types.ServicePortConfig{Mode: "ingress", Protocol: "tcp", Published: published, Target: target}
+	}
+	bind := func(source, target string) types.ServiceVolumeConfig {
+		return types.ServiceVolumeConfig{Type: types.VolumeTypeBind, Source: source, Target: target, Bind: &types.ServiceVolumeBind{CreateHostPath: true}}
+	}
+
+	web, err := load(nil)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, web.Ports, []types.ServicePortConfig{port("8080", 80), port("9090", 80), port("8443", 443)})
+	assert.DeepEqual(t, web.Volumes, []types.ServiceVolumeConfig{bind("/other-data", "/data"), bind("/logs", "/logs")})
+
+	web, err = load(MergeOptions{"ports": MergeAppend, "volumes": MergeAppend})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, web.Ports, []types.ServicePortConfig{port("8080", 80), port("8443", 443), port("9090", 80)})
+	assert.DeepEqual(t, web.Volumes, []types.ServiceVolumeConfig{bind("/data", "/data"), bind("/logs", "/logs"), bind("/other-data", "/data")})
+
+	web, err = load(MergeOptions{"ports": MergeReplace, "volumes": MergeReplace})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, web.Ports, []types.ServicePortConfig{port("9090", 80)})
+	assert.DeepEqual(t, web.Volumes, []types.ServiceVolumeConfig{bind("/other-data", "/data")})
+
+	web, err = load(MergeOptions{"ports": MergeByKey, "volumes": MergeByKey})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, web.Ports, []types.ServicePortConfig{port("9090", 80), port("8443", 443)})
+	assert.DeepEqual(t, web.Volumes, []types.ServiceVolumeConfig{bind("/other-data", "/data"), bind("/logs", "/logs")})
+
+	override = `
+services:
+  web:
+    ports:
+      - target: 80
+        published: "9090"
+`
+	web, err = load(MergeOptions{"ports": MergeByKey})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, web.Ports, []types.ServicePortConfig{{Published: "9090", Target: 80}, port("8443", 443)})
+
+	_, err = load(MergeOptions{"ports": "union"})
+	assert.ErrorContains(t, err, `unknown merge strategy "union"`)
+	_, err = load(MergeOptions{"dns": MergeAppend})
+	assert.ErrorContains(t, err, `merge strategy can't be set for attribute "dns"`)
+}
+
+func TestMergeLabelsListAndMapForms(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		base     string
+		override string
+	}{
+		{
+			name: "map base, list override",
+			base: `
+    labels:
+      com.example.kept: base
+      com.example.replaced: base`,
+			override: `
+    labels:
+      - com.example.replaced=override
+      - com.example.added=override
+      - com.example.empty`,
+		},
+		{
+			name: "list base, map override",
+			base: `
+    labels:
+      - com.example.kept=base
+      - com.example.replaced=base`,
+			override: `
+    labels:
+      com.example.replaced: override
+      com.example.added: override
+      com.example.empty: ""`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			project, err := loadTestProject(types.ConfigDetails{
+				Environment: map[string]string{},
+				ConfigFiles: []types.ConfigFile{
+					{Filename: "base.yml", Content: []byte(`
+name: merge-labels
+services:
+  web:
+    image: web` + tc.base + "\n")},
+					{Filename: "override.yml", Content: []byte(`
+services:
+  web:` + tc.override + "\n")},
+				},
+			})
+			assert.NilError(t, err)
+			web, err := project.GetService("web")
+			assert.NilError(t, err)
+			assert.DeepEqual(t, web.Labels, types.Labels{
+				"com.example.kept":     "base",
+				"com.example.replaced": "override",
+				"com.example.added":    "override",
+				"com.example.empty":    "",
+			})
+		})
+	}
+}
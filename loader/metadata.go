@@ -0,0 +1,89 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectMetadata is a summary of a compose file, as returned by LoadMetadata
+type ProjectMetadata struct {
+	// Name is the top-level `name`, which is not interpolated
+	Name string
+	// Services are sorted by name
+	Services []ServiceMetadata
+	// Includes lists the paths of the compose files declared by the `include` section
+	Includes []string
+}
+
+// ServiceMetadata is the name and profiles of a service
+type ServiceMetadata struct {
+	Name     string
+	Profiles []string
+}
+
+// metadataDocument only declares the attributes read by LoadMetadata, others are skipped by the decoder
+type metadataDocument struct {
+	Name     string `yaml:"name"`
+	Services map[string]*struct {
+		Profiles []string `yaml:"profiles"`
+	} `yaml:"services"`
+	Include []interface{} `yaml:"include"`
+}
+
+// LoadMetadata reads the project name, the services names and profiles, and the included files of a compose
+// file. This is much cheaper than Load, as the content is neither interpolated, validated nor merged with
+// included files, which are not read
+func LoadMetadata(content []byte) (*ProjectMetadata, error) {
+	var doc metadataDocument
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+	metadata := &ProjectMetadata{
+		Name: doc.Name,
+	}
+	for name, s := range doc.Services {
+		service := ServiceMetadata{Name: name}
+		if s != nil {
+			service.Profiles = s.Profiles
+		}
+		metadata.Services = append(metadata.Services, service)
+	}
+	sort.Slice(metadata.Services, func(i, j int) bool {
+		return metadata.Services[i].Name < metadata.Services[j].Name
+	})
+	for _, include := range doc.Include {
+		switch include := include.(type) {
+		case string:
+			metadata.Includes = append(metadata.Includes, include)
+		case map[string]interface{}:
+			switch path := include["path"].(type) {
+			case string:
+				metadata.Includes = append(metadata.Includes, path)
+			case []interface{}:
+				for _, p := range path {
+					if p, ok := p.(string); ok {
+						metadata.Includes = append(metadata.Includes, p)
+					}
+				}
+			}
+		}
+	}
+	return metadata, nil
+}
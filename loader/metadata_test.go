@@ -0,0 +1,65 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestLoadMetadata(t *testing.T) {
+	metadata, err := LoadMetadata([]byte(`
+name: metadata
+include:
+  - db.yaml
+  - path:
+      - cache.yaml
+      - cache.override.yaml
+    env_file: cache.env
+services:
+  web:
+    image: ${IMAGE}
+    profiles: [frontend, debug]
+  worker:
+  api:
+    build: .
+`))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, metadata, &ProjectMetadata{
+		Name: "metadata",
+		Services: []ServiceMetadata{
+			{Name: "api"},
+			{Name: "web", Profiles: []string{"frontend", "debug"}},
+			{Name: "worker"},
+		},
+		Includes: []string{"db.yaml", "cache.yaml", "cache.override.yaml"},
+	})
+
+	_, err = LoadMetadata([]byte("services: ["))
+	assert.ErrorContains(t, err, "yaml:")
+}
+
+func BenchmarkLoadMetadata(b *testing.B) {
+	yaml := []byte(generateServices(500))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := LoadMetadata(yaml); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -18,46 +18,119 @@ package loader
 
 import (
 	"fmt"
-	"os"
+	"io/fs"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/compose-spec/compose-go/errdefs"
 	"github.com/compose-spec/compose-go/types"
+	"github.com/compose-spec/compose-go/utils"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 )
 
+// NormalizeOption configures Normalize
+type NormalizeOption func(*normalizeOptions)
+
+type normalizeOptions struct {
+	fsys                  fs.FS
+	withoutDefaultNetwork bool
+	managedLabels         bool
+	managedLabelsPrefix   string
+	extraLabels           types.Labels
+	omitUnsetBuildArgs    bool
+	imageResolver         func(ref string) (string, error)
+	externalResolver      func(kind, composeName string) (string, error)
+}
+
+// WithoutDefaultNetwork makes Normalize skip the implicit "default" network, and leave services which
+// don't declare networks without any
+func WithoutDefaultNetwork() NormalizeOption {
+	return func(o *normalizeOptions) {
+		o.withoutDefaultNetwork = true
+	}
+}
+
+// WithManagedLabels makes Normalize label services, networks and volumes managed by the project, which are not
+// external, with the project name, working directory and resource name, like `<prefix>.project`,
+// `<prefix>.project.working_dir` and `<prefix>.service`, and with extra labels. Labels declared by the
+// compose model take precedence over injected ones
+func WithManagedLabels(prefix string, extra types.Labels) NormalizeOption {
+	return func(o *normalizeOptions) {
+		o.managedLabels = true
+		o.managedLabelsPrefix = prefix
+		o.extraLabels = extra
+	}
+}
+
+// WithOmitUnsetBuildArgs makes Normalize resolve `build.args` like Docker does. An arg declared without a value
+// gets its value from the project environment, which is empty if the variable is set to an empty string, and
+// is omitted if the variable is not set. By default, such an arg is kept without a value
+func WithOmitUnsetBuildArgs() NormalizeOption {
+	return func(o *normalizeOptions) {
+		o.omitUnsetBuildArgs = true
+	}
+}
+
+// WithImageResolver makes Normalize rewrite the image of each service, and the `docker-image://` additional
+// build contexts, with the reference returned by resolver, like to use a registry mirror or pin a digest
+func WithImageResolver(resolver func(ref string) (string, error)) NormalizeOption {
+	return func(o *normalizeOptions) {
+		o.imageResolver = resolver
+	}
+}
+
+// WithExternalResourceResolver makes Normalize set the name of each external network, volume, secret and config
+// to the one returned by resolver, called with the resource kind, like `network`, and its key in the compose
+// file. An empty name keeps the declared one
+func WithExternalResourceResolver(resolver func(kind, composeName string) (realName string, err error)) NormalizeOption {
+	return func(o *normalizeOptions) {
+		o.externalResolver = resolver
+	}
+}
+
 // Normalize compose project by moving deprecated attributes to their canonical position and injecting implicit defaults
-func Normalize(project *types.Project, resolvePaths bool) error {
-	absWorkingDir, err := filepath.Abs(project.WorkingDir)
-	if err != nil {
-		return err
+func Normalize(project *types.Project, resolvePaths bool, options ...NormalizeOption) error {
+	opts := normalizeOptions{}
+	for _, option := range options {
+		option(&opts)
 	}
-	project.WorkingDir = absWorkingDir
+	return normalize(project, resolvePaths, opts)
+}
 
-	absComposeFiles, err := absComposeFiles(project.ComposeFiles)
-	if err != nil {
-		return err
+func normalize(project *types.Project, resolvePaths bool, opts normalizeOptions) error {
+	fsys := opts.fsys
+	// paths within a virtual filesystem can't be made absolute
+	if fsys == nil {
+		absWorkingDir, err := filepath.Abs(project.WorkingDir)
+		if err != nil {
+			return err
+		}
+		project.WorkingDir = absWorkingDir
+
+		absComposeFiles, err := absComposeFiles(project.ComposeFiles)
+		if err != nil {
+			return err
+		}
+		project.ComposeFiles = absComposeFiles
 	}
-	project.ComposeFiles = absComposeFiles
 
 	if project.Networks == nil {
 		project.Networks = make(map[string]types.NetworkConfig)
 	}
 
 	// If not declared explicitly, Compose model involves an implicit "default" network
-	if _, ok := project.Networks["default"]; !ok {
+	if _, ok := project.Networks["default"]; !ok && !opts.withoutDefaultNetwork {
 		project.Networks["default"] = types.NetworkConfig{}
 	}
 
-	err = relocateExternalName(project)
+	err := relocateExternalName(project)
 	if err != nil {
 		return err
 	}
 
 	for i, s := range project.Services {
-		if len(s.Networks) == 0 && s.NetworkMode == "" {
+		if len(s.Networks) == 0 && s.NetworkMode == "" && !opts.withoutDefaultNetwork {
 			// Service without explicit network attachment are implicitly exposed on default network
 			s.Networks = map[string]*types.ServiceNetworkConfig{"default": nil}
 		}
@@ -75,57 +148,50 @@ func Normalize(project *types.Project, resolvePaths bool) error {
 			if s.Build.Dockerfile == "" && s.Build.DockerfileInline == "" {
 				s.Build.Dockerfile = "Dockerfile"
 			}
-			localContext := absPath(project.WorkingDir, s.Build.Context)
-			if _, err := os.Stat(localContext); err == nil {
-				if resolvePaths {
-					s.Build.Context = localContext
+			// remote contexts are left untouched, as is the dockerfile which is relative to the context
+			if !isRemoteContext(s.Build.Context) {
+				localContext := absPath(project.WorkingDir, s.Build.Context)
+				if _, err := utils.Stat(fsys, localContext); err == nil {
+					if resolvePaths {
+						s.Build.Context = localContext
+					}
+					// } else {
+					// might be a remote context with a syntax not detected by isRemoteContext. Unfortunately supported
+					// "remote" syntax is highly ambiguous in moby/moby and not defined by compose-spec, so let's assume
+					// runtime will check
 				}
-				// } else {
-				// might be a remote http/git context. Unfortunately supported "remote" syntax is highly ambiguous
-				// in moby/moby and not defined by compose-spec, so let's assume runtime will check
 			}
 			s.Build.Args = s.Build.Args.Resolve(fn)
+			if opts.omitUnsetBuildArgs {
+				s.Build.Args = s.Build.Args.RemoveEmpty()
+			}
 		}
+		// missing files which are not required are kept, they're skipped when resolving the environment
 		for j, f := range s.EnvFile {
-			s.EnvFile[j] = absPath(project.WorkingDir, f)
+			s.EnvFile[j].Path = absPath(project.WorkingDir, f.Path)
 		}
 		s.Environment = s.Environment.Resolve(fn)
 
+		if s.Develop != nil && resolvePaths {
+			for j, watch := range s.Develop.Watch {
+				s.Develop.Watch[j].Path = absPath(project.WorkingDir, watch.Path)
+			}
+		}
+
 		if s.Extends != nil && s.Extends.File != "" {
 			s.Extends.File = absPath(project.WorkingDir, s.Extends.File)
 		}
 
-		for _, link := range s.Links {
-			parts := strings.Split(link, ":")
-			if len(parts) == 2 {
-				link = parts[0]
+		for _, dep := range s.DependencyEdges() {
+			if dep.Kind == types.DependencyDependsOn {
+				continue
 			}
-			s.DependsOn = setIfMissing(s.DependsOn, link, types.ServiceDependency{
+			s.DependsOn = setIfMissing(s.DependsOn, dep.To, types.ServiceDependency{
 				Condition: types.ServiceConditionStarted,
-				Restart:   true,
+				Restart:   dep.Kind != types.DependencyVolumesFrom,
 			})
 		}
 
-		for _, namespace := range []string{s.NetworkMode, s.Ipc, s.Pid, s.Uts, s.Cgroup} {
-			if strings.HasPrefix(namespace, types.ServicePrefix) {
-				name := namespace[len(types.ServicePrefix):]
-				s.DependsOn = setIfMissing(s.DependsOn, name, types.ServiceDependency{
-					Condition: types.ServiceConditionStarted,
-					Restart:   true,
-				})
-			}
-		}
-
-		for _, vol := range s.VolumesFrom {
-			if !strings.HasPrefix(vol, types.ContainerPrefix) {
-				spec := strings.Split(vol, ":")
-				s.DependsOn = setIfMissing(s.DependsOn, spec[0], types.ServiceDependency{
-					Condition: types.ServiceConditionStarted,
-					Restart:   false,
-				})
-			}
-		}
-
 		err := relocateLogDriver(&s)
 		if err != nil {
 			return err
@@ -141,9 +207,18 @@ func Normalize(project *types.Project, resolvePaths bool) error {
 			return err
 		}
 
-		err = relocateScale(&s)
-		if err != nil {
-			return err
+		relocateScale(&s, &project.WarningMessages)
+
+		relocateResources(&s, &project.WarningMessages)
+
+		normalizeHealthCheck(&s)
+		setDefaultTargets(&s)
+
+		if opts.imageResolver != nil {
+			err = resolveImages(&s, opts.imageResolver)
+			if err != nil {
+				return err
+			}
 		}
 
 		project.Services[i] = s
@@ -159,9 +234,59 @@ func Normalize(project *types.Project, resolvePaths bool) error {
 
 	setNameFromKey(project)
 
+	if opts.externalResolver != nil {
+		if err := resolveExternalNames(project, opts.externalResolver); err != nil {
+			return err
+		}
+	}
+
+	if opts.managedLabels {
+		injectManagedLabels(project, opts.managedLabelsPrefix, opts.extraLabels)
+	}
+
 	return nil
 }
 
+// injectManagedLabels adds labels to project resources, unless already declared
+func injectManagedLabels(project *types.Project, prefix string, extra types.Labels) {
+	inject := func(labels types.Labels, kind string, name string) types.Labels {
+		injected := types.Labels{
+			prefix + ".project": project.Name,
+			prefix + "." + kind: name,
+		}
+		if kind == "service" {
+			injected[prefix+".project.working_dir"] = project.WorkingDir
+		}
+		for k, v := range extra {
+			injected[k] = v
+		}
+		for k, v := range injected {
+			if _, ok := labels[k]; !ok {
+				labels = labels.Add(k, v)
+			}
+		}
+		return labels
+	}
+
+	for i, s := range project.Services {
+		project.Services[i].Labels = inject(s.Labels, "service", s.Name)
+	}
+	for name, n := range project.Networks {
+		if n.External.External {
+			continue
+		}
+		n.Labels = inject(n.Labels, "network", name)
+		project.Networks[name] = n
+	}
+	for name, v := range project.Volumes {
+		if v.External.External {
+			continue
+		}
+		v.Labels = inject(v.Labels, "volume", name)
+		project.Volumes[name] = v
+	}
+}
+
 // setIfMissing adds a ServiceDependency for service if not already defined
 func setIfMissing(d types.DependsOnConfig, service string, dep types.ServiceDependency) types.DependsOnConfig {
 	if d == nil {
@@ -173,21 +298,184 @@ func setIfMissing(d types.DependsOnConfig, service string, dep types.ServiceDepe
 	return d
 }
 
-func relocateScale(s *types.ServiceConfig) error {
+// relocateScale maps `scale` to `deploy.replicas`. When both are set with distinct values, `deploy.replicas` is used
+// and a warning is reported. A scale of 1, the default, is silently overridden by `deploy.replicas`
+func relocateScale(s *types.ServiceConfig, warnings *[]string) {
 	scale := uint64(s.Scale)
+	if s.Deploy != nil && s.Deploy.Replicas != nil {
+		replicas := *s.Deploy.Replicas
+		if scale != 1 && scale != replicas {
+			*warnings = append(*warnings, fmt.Sprintf("service %q declares both `scale: %d` and `deploy.replicas: %d`, `deploy.replicas` is used",
+				s.Name, s.Scale, replicas))
+		}
+		s.Scale = int(replicas)
+		return
+	}
 	if scale > 1 {
-		logrus.Warn("`scale` is deprecated. Use the `deploy.replicas` element")
 		if s.Deploy == nil {
 			s.Deploy = &types.DeployConfig{}
 		}
-		if s.Deploy.Replicas != nil && *s.Deploy.Replicas != scale {
-			return errors.Wrap(errdefs.ErrInvalid, "can't use both 'scale' (deprecated) and 'deploy.replicas'")
-		}
 		s.Deploy.Replicas = &scale
 	}
+}
+
+// setDefaultTargets sets the target of configs and secrets mounted without one, which is `/<config_name>`
+// for a config and `/run/secrets/<secret_name>` for a secret
+func setDefaultTargets(s *types.ServiceConfig) {
+	for i, config := range s.Configs {
+		if config.Target == "" {
+			s.Configs[i].Target = "/" + config.Source
+		}
+	}
+	for i, secret := range s.Secrets {
+		if secret.Target == "" {
+			s.Secrets[i].Target = "/run/secrets/" + secret.Source
+		}
+	}
+}
+
+// dockerImageContext is the prefix of an additional build context which is an image
+const dockerImageContext = "docker-image://"
+
+// resolveImages rewrites the image references of a service with resolver
+func resolveImages(s *types.ServiceConfig, resolver func(ref string) (string, error)) error {
+	if s.Image != "" {
+		image, err := resolver(s.Image)
+		if err != nil {
+			return errors.Wrapf(err, "service %q: failed to resolve image %s", s.Name, s.Image)
+		}
+		s.Image = image
+	}
+	if s.Build == nil {
+		return nil
+	}
+	for name, buildContext := range s.Build.AdditionalContexts {
+		if buildContext == nil || !strings.HasPrefix(*buildContext, dockerImageContext) {
+			continue
+		}
+		ref := strings.TrimPrefix(*buildContext, dockerImageContext)
+		image, err := resolver(ref)
+		if err != nil {
+			return errors.Wrapf(err, "service %q: failed to resolve image %s for build context %s", s.Name, ref, name)
+		}
+		resolved := dockerImageContext + image
+		s.Build.AdditionalContexts[name] = &resolved
+	}
+	return nil
+}
+
+// resolveExternalNames sets the name of the external resources of a project with resolver, in kind then key order
+func resolveExternalNames(project *types.Project, resolver func(kind, composeName string) (string, error)) error {
+	resolve := func(kind, key string, external bool, name *string) error {
+		if !external {
+			return nil
+		}
+		resolved, err := resolver(kind, key)
+		if err != nil {
+			return errors.Wrapf(err, "failed to resolve the name of external %s %q", kind, key)
+		}
+		if resolved != "" {
+			*name = resolved
+		}
+		return nil
+	}
+	for _, key := range project.NetworkNames() {
+		n := project.Networks[key]
+		if err := resolve("network", key, n.External.External, &n.Name); err != nil {
+			return err
+		}
+		project.Networks[key] = n
+	}
+	for _, key := range project.VolumeNames() {
+		v := project.Volumes[key]
+		if err := resolve("volume", key, v.External.External, &v.Name); err != nil {
+			return err
+		}
+		project.Volumes[key] = v
+	}
+	for _, key := range project.SecretNames() {
+		s := project.Secrets[key]
+		if err := resolve("secret", key, s.External.External, &s.Name); err != nil {
+			return err
+		}
+		project.Secrets[key] = s
+	}
+	for _, key := range project.ConfigNames() {
+		c := project.Configs[key]
+		if err := resolve("config", key, c.External.External, &c.Name); err != nil {
+			return err
+		}
+		project.Configs[key] = c
+	}
 	return nil
 }
 
+// normalizeHealthCheck makes `test: ["NONE"]` and `disable: true`, which both disable the image healthcheck,
+// share the same representation: Disable set and no Test
+func normalizeHealthCheck(s *types.ServiceConfig) {
+	if s.HealthCheck == nil {
+		return
+	}
+	if len(s.HealthCheck.Test) > 0 && s.HealthCheck.Test[0] == "NONE" {
+		s.HealthCheck.Disable = true
+	}
+	if s.HealthCheck.Disable {
+		s.HealthCheck.Test = nil
+	}
+}
+
+// relocateResources maps the service level `mem_limit`, `mem_reservation` and `cpus` to `deploy.resources`.
+// When both are set with distinct values, `deploy.resources` is used and a warning is reported.
+// `cpu_shares` and `memswap_limit` have no equivalent and are left as is
+func relocateResources(s *types.ServiceConfig, warnings *[]string) {
+	if s.MemLimit == 0 && s.MemReservation == 0 && s.CPUS == 0 {
+		return
+	}
+	if s.Deploy == nil {
+		s.Deploy = &types.DeployConfig{}
+	}
+	resources := &s.Deploy.Resources
+	conflict := func(attribute string, value interface{}, deployAttribute string, deployValue interface{}) {
+		*warnings = append(*warnings, fmt.Sprintf("service %q declares both `%s: %v` and `%s: %v`, `%s` is used",
+			s.Name, attribute, value, deployAttribute, deployValue, deployAttribute))
+	}
+	if s.MemLimit != 0 {
+		if resources.Limits == nil {
+			resources.Limits = &types.Resource{}
+		}
+		switch resources.Limits.MemoryBytes {
+		case 0:
+			resources.Limits.MemoryBytes = s.MemLimit
+		case s.MemLimit:
+		default:
+			conflict("mem_limit", int64(s.MemLimit), "deploy.resources.limits.memory", int64(resources.Limits.MemoryBytes))
+		}
+	}
+	if s.CPUS != 0 {
+		if resources.Limits == nil {
+			resources.Limits = &types.Resource{}
+		}
+		cpus := strconv.FormatFloat(float64(s.CPUS), 'f', -1, 32)
+		if resources.Limits.NanoCPUs == "" {
+			resources.Limits.NanoCPUs = cpus
+		} else if limit, err := strconv.ParseFloat(resources.Limits.NanoCPUs, 32); err != nil || float32(limit) != s.CPUS {
+			conflict("cpus", cpus, "deploy.resources.limits.cpus", resources.Limits.NanoCPUs)
+		}
+	}
+	if s.MemReservation != 0 {
+		if resources.Reservations == nil {
+			resources.Reservations = &types.Resource{}
+		}
+		switch resources.Reservations.MemoryBytes {
+		case 0:
+			resources.Reservations.MemoryBytes = s.MemReservation
+		case s.MemReservation:
+		default:
+			conflict("mem_reservation", int64(s.MemReservation), "deploy.resources.reservations.memory", int64(resources.Reservations.MemoryBytes))
+		}
+	}
+}
+
 func absComposeFiles(composeFiles []string) ([]string, error) {
 	absComposeFiles := make([]string, len(composeFiles))
 	for i, composeFile := range composeFiles {
@@ -276,7 +564,6 @@ func relocateExternalName(project *types.Project) error {
 
 func relocateLogOpt(s *types.ServiceConfig) error {
 	if len(s.LogOpt) != 0 {
-		logrus.Warn("`log_opts` is deprecated. Use the `logging` element")
 		if s.Logging == nil {
 			s.Logging = &types.LoggingConfig{}
 		}
@@ -293,7 +580,6 @@ func relocateLogOpt(s *types.ServiceConfig) error {
 
 func relocateLogDriver(s *types.ServiceConfig) error {
 	if s.LogDriver != "" {
-		logrus.Warn("`log_driver` is deprecated. Use the `logging` element")
 		if s.Logging == nil {
 			s.Logging = &types.LoggingConfig{}
 		}
@@ -308,7 +594,6 @@ func relocateLogDriver(s *types.ServiceConfig) error {
 
 func relocateDockerfile(s *types.ServiceConfig) error {
 	if s.Dockerfile != "" {
-		logrus.Warn("`dockerfile` is deprecated. Use the `build` element")
 		if s.Build == nil {
 			s.Build = &types.BuildConfig{}
 		}
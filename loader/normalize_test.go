@@ -20,9 +20,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"testing"
+	"testing/fstest"
 
 	"github.com/compose-spec/compose-go/types"
+	"gopkg.in/yaml.v3"
 	"gotest.tools/v3/assert"
 )
 
@@ -88,6 +91,44 @@ networks:
 	assert.Equal(t, expected, string(marshal))
 }
 
+func TestNormalizeWithoutDefaultNetwork(t *testing.T) {
+	project := types.Project{
+		Name: "myProject",
+		Networks: types.Networks{
+			"mynet": types.NetworkConfig{},
+		},
+		Services: []types.ServiceConfig{
+			{
+				Name:  "foo",
+				Image: "foo",
+			},
+			{
+				Name:     "bar",
+				Image:    "bar",
+				Networks: map[string]*types.ServiceNetworkConfig{"mynet": nil},
+			},
+		},
+	}
+
+	expected := `name: myProject
+services:
+  bar:
+    image: bar
+    networks:
+      mynet: null
+  foo:
+    image: foo
+networks:
+  mynet:
+    name: myProject_mynet
+`
+	err := Normalize(&project, false, WithoutDefaultNetwork())
+	assert.NilError(t, err)
+	marshal, err := project.MarshalYAML()
+	assert.NilError(t, err)
+	assert.Equal(t, expected, string(marshal))
+}
+
 func TestNormalizeResolvePathsBuildContextPaths(t *testing.T) {
 	wd, _ := os.Getwd()
 	project := types.Project{
@@ -124,6 +165,43 @@ networks:
 	assert.Equal(t, expected, string(marshal))
 }
 
+func TestNormalizeResolvePathsRemoteBuildContext(t *testing.T) {
+	contexts := []string{
+		"https://github.com/docker/compose.git#main",
+		"http://example.com/context.tar.gz",
+		"git://github.com/docker/compose.git",
+		"ssh://git@github.com/docker/compose.git",
+		"github.com/docker/compose",
+		"git@github.com:docker/compose.git",
+	}
+	// a local directory with the same name as the remote context must not be picked
+	fsys := fstest.MapFS{
+		"project/github.com/docker/compose/Dockerfile": &fstest.MapFile{},
+	}
+	for _, context := range contexts {
+		t.Run(context, func(t *testing.T) {
+			project := types.Project{
+				Name:       "myProject",
+				WorkingDir: "project",
+				Services: []types.ServiceConfig{
+					{
+						Name: "foo",
+						Build: &types.BuildConfig{
+							Context:    context,
+							Dockerfile: "build/Dockerfile",
+						},
+					},
+				},
+			}
+			err := normalize(&project, true, normalizeOptions{fsys: fsys})
+			assert.NilError(t, err)
+			assert.Equal(t, project.Services[0].Build.Context, context)
+			assert.Equal(t, project.Services[0].Build.Dockerfile, "build/Dockerfile")
+			assert.Equal(t, resolveBuildContextPath("/base", context), context)
+		})
+	}
+}
+
 func TestNormalizeAbsolutePaths(t *testing.T) {
 	project := types.Project{
 		Name:         "myProject",
@@ -245,3 +323,431 @@ networks:
 	assert.NilError(t, err)
 	assert.Equal(t, expected, string(marshal))
 }
+
+func TestNormalizeEnvFilePaths(t *testing.T) {
+	workingDir, err := filepath.Abs("testdata")
+	assert.NilError(t, err)
+	project, err := Load(types.ConfigDetails{
+		WorkingDir: "testdata",
+		ConfigFiles: []types.ConfigFile{{Filename: "testdata/compose.yaml", Content: []byte(`
+name: env-file-paths
+services:
+  short:
+    image: busybox
+    env_file: subdir/extra.env
+  long:
+    image: busybox
+    env_file:
+      - path: subdir/extra.env
+      - path: ./missing.env
+        required: false
+`)}},
+		Environment: map[string]string{},
+	}, func(options *Options) {
+		options.ResolvePaths = true
+	})
+	assert.NilError(t, err)
+
+	short, err := project.GetService("short")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, short.EnvFile, []types.EnvFile{
+		{Path: filepath.Join(workingDir, "subdir", "extra.env"), Required: true},
+	})
+
+	long, err := project.GetService("long")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, long.EnvFile, []types.EnvFile{
+		{Path: filepath.Join(workingDir, "subdir", "extra.env"), Required: true},
+		{Path: filepath.Join(workingDir, "missing.env"), Required: false},
+	})
+	assert.DeepEqual(t, long.Environment, short.Environment)
+}
+
+func TestNormalizeWithManagedLabels(t *testing.T) {
+	project := types.Project{
+		Name:       "myproject",
+		WorkingDir: "/work",
+		Services: types.Services{
+			{
+				Name:   "web",
+				Labels: types.Labels{"acme.service": "frontend"},
+			},
+		},
+		Networks: types.Networks{
+			"front":    {},
+			"external": {External: types.External{External: true}},
+		},
+		Volumes: types.Volumes{
+			"data": {Labels: types.Labels{"team": "storage"}},
+		},
+	}
+	err := Normalize(&project, false, WithManagedLabels("acme", types.Labels{"team": "platform"}))
+	assert.NilError(t, err)
+
+	assert.DeepEqual(t, project.Services[0].Labels, types.Labels{
+		"acme.project":             "myproject",
+		"acme.project.working_dir": "/work",
+		"acme.service":             "frontend",
+		"team":                     "platform",
+	})
+	assert.DeepEqual(t, project.Networks["front"].Labels, types.Labels{
+		"acme.project": "myproject",
+		"acme.network": "front",
+		"team":         "platform",
+	})
+	assert.DeepEqual(t, project.Networks["default"].Labels, types.Labels{
+		"acme.project": "myproject",
+		"acme.network": "default",
+		"team":         "platform",
+	})
+	assert.Check(t, project.Networks["external"].Labels == nil)
+	assert.DeepEqual(t, project.Volumes["data"].Labels, types.Labels{
+		"acme.project": "myproject",
+		"acme.volume":  "data",
+		"team":         "storage",
+	})
+}
+
+func TestNormalizeLegacyResources(t *testing.T) {
+	project, err := loadYAMLWithEnv(`
+name: legacy-resources
+services:
+  web:
+    image: web
+    mem_limit: 512m
+    mem_reservation: 128m
+    cpus: 1.5
+    cpu_shares: 512
+    deploy:
+      replicas: 2
+      resources:
+        limits:
+          cpus: "1.5"
+          pids: 100
+`, nil)
+	assert.NilError(t, err)
+	err = Normalize(project, false)
+	assert.NilError(t, err)
+
+	web := project.Services[0]
+	replicas := uint64(2)
+	assert.DeepEqual(t, web.Deploy, &types.DeployConfig{
+		Replicas: &replicas,
+		Resources: types.Resources{
+			Limits:       &types.Resource{NanoCPUs: "1.5", MemoryBytes: 512 * 1024 * 1024, PIds: 100},
+			Reservations: &types.Resource{MemoryBytes: 128 * 1024 * 1024},
+		},
+	})
+	assert.Equal(t, web.CPUShares, int64(512))
+	assert.Equal(t, len(project.WarningMessages), 0)
+
+	project, err = loadYAMLWithEnv(`
+name: legacy-resources
+services:
+  web:
+    image: web
+    mem_limit: 512m
+    deploy:
+      resources:
+        limits:
+          memory: 1g
+`, nil)
+	assert.NilError(t, err)
+	err = Normalize(project, false)
+	assert.NilError(t, err)
+	assert.Equal(t, project.Services[0].Deploy.Resources.Limits.MemoryBytes, types.UnitBytes(1024*1024*1024))
+	assert.DeepEqual(t, project.WarningMessages, []string{
+		"service \"web\" declares both `mem_limit: 536870912` and `deploy.resources.limits.memory: 1073741824`, `deploy.resources.limits.memory` is used",
+	})
+}
+
+func TestNormalizeScaleAndReplicas(t *testing.T) {
+	project, err := Load(buildConfigDetails(`
+name: scale
+services:
+  web:
+    image: web
+    scale: 2
+    deploy:
+      replicas: 3
+  worker:
+    image: worker
+    scale: 0
+    deploy:
+      replicas: 2
+  db:
+    image: db
+    deploy:
+      replicas: 2
+`, nil), func(options *Options) {
+		options.SkipDeprecationWarnings = true
+	})
+	assert.NilError(t, err)
+	for name, replicas := range map[string]int{"web": 3, "worker": 2, "db": 2} {
+		s, err := project.GetService(name)
+		assert.NilError(t, err)
+		assert.Equal(t, *s.Deploy.Replicas, uint64(replicas), name)
+		assert.Equal(t, s.Scale, replicas, name)
+	}
+	// services are normalized in no specific order
+	warnings := append([]string{}, project.WarningMessages...)
+	sort.Strings(warnings)
+	assert.DeepEqual(t, warnings, []string{
+		"service \"web\" declares both `scale: 2` and `deploy.replicas: 3`, `deploy.replicas` is used",
+		"service \"worker\" declares both `scale: 0` and `deploy.replicas: 2`, `deploy.replicas` is used",
+	})
+
+	// the conflict is only reported once
+	expanded, err := project.WithExpandedReplicas()
+	assert.NilError(t, err)
+	assert.Equal(t, len(expanded.Services), 7)
+	assert.DeepEqual(t, expanded.WarningMessages, project.WarningMessages)
+}
+
+func TestNormalizeHealthCheckDisable(t *testing.T) {
+	project, err := loadYAMLWithEnv(`
+name: healthcheck
+services:
+  disable:
+    image: web
+    healthcheck:
+      disable: true
+  none:
+    image: web
+    healthcheck:
+      test: ["NONE"]
+  check:
+    image: web
+    healthcheck:
+      test: ["CMD", "true"]
+`, nil)
+	assert.NilError(t, err)
+	err = Normalize(project, false)
+	assert.NilError(t, err)
+
+	disabled := &types.HealthCheckConfig{Disable: true}
+	disable, err := project.GetService("disable")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, disable.HealthCheck, disabled)
+	none, err := project.GetService("none")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, none.HealthCheck, disabled)
+	check, err := project.GetService("check")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, check.HealthCheck, &types.HealthCheckConfig{Test: types.HealthCheckTest{"CMD", "true"}})
+
+	marshalled, err := yaml.Marshal(none.HealthCheck)
+	assert.NilError(t, err)
+	assert.Equal(t, string(marshalled), "disable: true\n")
+}
+
+func TestNormalizeOmitUnsetBuildArgs(t *testing.T) {
+	yaml := `
+name: build-args
+services:
+  web:
+    build:
+      context: .
+      args:
+        SET: null
+        EMPTY: null
+        UNSET: null
+        EXPLICIT: value
+`
+	env := map[string]string{"SET": "from-env", "EMPTY": ""}
+
+	project, err := loadYAMLWithEnv(yaml, env)
+	assert.NilError(t, err)
+	err = Normalize(project, false)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Services[0].Build.Args, types.MappingWithEquals{
+		"SET":      strPtr("from-env"),
+		"EMPTY":    strPtr(""),
+		"UNSET":    nil,
+		"EXPLICIT": strPtr("value"),
+	})
+
+	project, err = loadYAMLWithEnv(yaml, env)
+	assert.NilError(t, err)
+	err = Normalize(project, false, WithOmitUnsetBuildArgs())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.Services[0].Build.Args, types.MappingWithEquals{
+		"SET":      strPtr("from-env"),
+		"EMPTY":    strPtr(""),
+		"EXPLICIT": strPtr("value"),
+	})
+
+	loaded, err := Load(buildConfigDetails(yaml, env), func(o *Options) {
+		o.OmitUnsetBuildArgs = true
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, loaded.Services[0].Build.Args, project.Services[0].Build.Args)
+}
+
+func TestNormalizeWithImageResolver(t *testing.T) {
+	yaml := `
+name: mirror
+services:
+  web:
+    image: nginx:1.25
+    build:
+      context: .
+      additional_contexts:
+        base: docker-image://alpine:3.18
+        src: ./src
+  db:
+    image: postgres
+`
+	mirror := func(ref string) (string, error) {
+		if ref == "invalid" {
+			return "", fmt.Errorf("not mirrored")
+		}
+		return "registry.internal/" + ref, nil
+	}
+	project, err := Load(buildConfigDetails(yaml, nil), func(o *Options) {
+		o.ImageResolver = mirror
+	})
+	assert.NilError(t, err)
+	web, err := project.GetService("web")
+	assert.NilError(t, err)
+	assert.Equal(t, web.Image, "registry.internal/nginx:1.25")
+	assert.DeepEqual(t, web.Build.AdditionalContexts, types.MappingWithEquals{
+		"base": strPtr("docker-image://registry.internal/alpine:3.18"),
+		"src":  strPtr("./src"),
+	})
+	db, err := project.GetService("db")
+	assert.NilError(t, err)
+	assert.Equal(t, db.Image, "registry.internal/postgres")
+
+	_, err = Load(buildConfigDetails(`
+name: mirror
+services:
+  web:
+    image: invalid
+`, nil), func(o *Options) {
+		o.ImageResolver = mirror
+	})
+	assert.Error(t, err, `service "web": failed to resolve image invalid: not mirrored`)
+}
+
+func TestNormalizeWithExternalResourceResolver(t *testing.T) {
+	project, err := Load(buildConfigDetails(`
+name: external
+services:
+  web:
+    image: web
+    networks: [front, back]
+    volumes:
+      - data:/data
+      - cache:/cache
+    secrets: [token]
+    configs: [app]
+networks:
+  front:
+    external: true
+  back: {}
+volumes:
+  data:
+    external: true
+    name: shared_data
+  cache: {}
+secrets:
+  token:
+    external: true
+configs:
+  app:
+    external: true
+`, nil), func(o *Options) {
+		o.ExternalResourceResolver = func(kind, composeName string) (string, error) {
+			if kind == "config" {
+				return "", nil
+			}
+			return fmt.Sprintf("prod_%s_%s", kind, composeName), nil
+		}
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, project.Networks["front"].Name, "prod_network_front")
+	assert.Equal(t, project.Networks["back"].Name, "external_back")
+	assert.Equal(t, project.Volumes["data"].Name, "prod_volume_data")
+	assert.Equal(t, project.Volumes["cache"].Name, "external_cache")
+	assert.Equal(t, project.Secrets["token"].Name, "prod_secret_token")
+	assert.Equal(t, project.Configs["app"].Name, "app")
+
+	project = &types.Project{
+		Name:     "external",
+		Networks: types.Networks{"front": {External: types.External{External: true}}},
+	}
+	err = Normalize(project, false, WithExternalResourceResolver(func(kind, composeName string) (string, error) {
+		return "", fmt.Errorf("unknown %s", composeName)
+	}))
+	assert.Error(t, err, `failed to resolve the name of external network "front": unknown front`)
+}
+
+func TestNormalizeConfigsAndSecretsTarget(t *testing.T) {
+	project, err := Load(buildConfigDetails(`
+name: targets
+services:
+  web:
+    image: web
+    configs:
+      - app
+      - source: nginx
+        target: /etc/nginx/nginx.conf
+        uid: "101"
+        gid: "101"
+        mode: 0440
+    secrets:
+      - token
+      - source: cert
+        target: /certs/cert.pem
+configs:
+  app:
+    file: ./app.conf
+  nginx:
+    file: ./nginx.conf
+secrets:
+  token:
+    environment: TOKEN
+  cert:
+    file: ./cert.pem
+`, map[string]string{"TOKEN": "secret"}))
+	assert.NilError(t, err)
+	web, err := project.GetService("web")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, web.Configs, []types.ServiceConfigObjConfig{
+		{Source: "app", Target: "/app"},
+		{Source: "nginx", Target: "/etc/nginx/nginx.conf", UID: "101", GID: "101", Mode: uint32Ptr(0o440)},
+	})
+	assert.DeepEqual(t, web.Secrets, []types.ServiceSecretConfig{
+		{Source: "token", Target: "/run/secrets/token"},
+		{Source: "cert", Target: "/certs/cert.pem"},
+	})
+
+	_, err = Load(buildConfigDetails(`
+name: targets
+services:
+  web:
+    image: web
+    configs:
+      - source: app
+        uid: root
+configs:
+  app:
+    file: ./app.conf
+`, nil))
+	assert.Error(t, err, `service "web" config app has invalid uid "root": invalid compose project`)
+
+	_, err = Load(buildConfigDetails(`
+name: targets
+services:
+  web:
+    image: web
+    secrets:
+      - source: token
+        mode: 01777
+secrets:
+  token:
+    environment: TOKEN
+`, map[string]string{"TOKEN": "secret"}))
+	assert.Error(t, err, `service "web" secret token has invalid mode 01777: invalid compose project`)
+}
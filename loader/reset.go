@@ -0,0 +1,203 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/compose-spec/compose-go/types"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// resetTag removes an attribute, including the value set by the files the compose file is merged on top of
+	resetTag = "!reset"
+	// overrideTag replaces an attribute value, rather than merging with the files the compose file is merged on top of
+	overrideTag = "!override"
+)
+
+// resetPaths lists the paths of attributes tagged `!reset` or `!override` in a compose file. Values set
+// at these paths by the files it is merged on top of are discarded before merge.
+type resetPaths [][]string
+
+// parseYAMLWithResets is like ParseYAML, but also collects paths tagged `!reset` or `!override`, and the names of
+// the services in declaration order.
+// `!reset` attributes are removed from the returned mapping.
+func parseYAMLWithResets(source []byte) (map[string]interface{}, resetPaths, []string, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(source, &node); err != nil {
+		return nil, nil, nil, err
+	}
+	forceStringKeys(&node)
+	if err := checkDuplicateKeys(&node); err != nil {
+		return nil, nil, nil, err
+	}
+	var resets resetPaths
+	collectResets(&node, []string{}, &resets)
+
+	var cfg interface{}
+	if err := node.Decode(&cfg); err != nil {
+		return nil, nil, nil, err
+	}
+	dict, err := toStringKeysMap(cfg)
+	return dict, resets, declaredServices(&node), err
+}
+
+// declaredServices returns the names of the services declared by a compose file, in declaration order
+func declaredServices(node *yaml.Node) []string {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	services := mappingValue(node, "services")
+	if services == nil || services.Kind != yaml.MappingNode {
+		return nil
+	}
+	var names []string
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		if key := services.Content[i]; key.Tag != "!!merge" {
+			names = append(names, key.Value)
+		}
+	}
+	return names
+}
+
+// collectResets records tagged attributes under path into resets. Inside sequences, path is nil
+// as items can't be targeted, so tags are only removed
+func collectResets(node *yaml.Node, path []string, resets *resetPaths) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			collectResets(n, path, resets)
+		}
+	case yaml.SequenceNode:
+		for _, n := range node.Content {
+			collectResets(n, nil, resets)
+		}
+	case yaml.MappingNode:
+		var content []*yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			var next []string
+			if path != nil {
+				next = append(append([]string{}, path...), key.Value)
+			}
+			switch value.Tag {
+			case resetTag:
+				if next != nil {
+					*resets = append(*resets, next)
+				}
+				continue
+			case overrideTag:
+				if next != nil {
+					*resets = append(*resets, next)
+				}
+				// let the decoder resolve the actual type
+				value.Tag = ""
+			}
+			collectResets(value, next, resets)
+			content = append(content, key, value)
+		}
+		node.Content = content
+	}
+}
+
+// apply discards the values set in config at the reset paths
+func (r resetPaths) apply(config *types.Config) {
+	for _, path := range r {
+		resetValue(reflect.ValueOf(config), path)
+	}
+}
+
+func resetValue(v reflect.Value, path []string) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	key, rest := path[0], path[1:]
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if strings.HasPrefix(key, "x-") {
+			if extensions := v.FieldByName("Extensions"); extensions.IsValid() {
+				resetValue(extensions, path)
+			}
+			return
+		}
+		field, ok := fieldByAttributeName(v, key)
+		if !ok {
+			return
+		}
+		if len(rest) == 0 {
+			field.Set(reflect.Zero(field.Type()))
+			return
+		}
+		resetValue(field.Addr(), rest)
+	case reflect.Map:
+		if v.IsNil() || v.Type().Key().Kind() != reflect.String {
+			return
+		}
+		k := reflect.ValueOf(key).Convert(v.Type().Key())
+		if len(rest) == 0 {
+			v.SetMapIndex(k, reflect.Value{})
+			return
+		}
+		elem := v.MapIndex(k)
+		if !elem.IsValid() {
+			return
+		}
+		// map values are not addressable, so we update a copy
+		value := reflect.New(elem.Type()).Elem()
+		value.Set(elem)
+		resetValue(value.Addr(), rest)
+		v.SetMapIndex(k, value)
+	case reflect.Slice:
+		// services are declared as a mapping, but stored as a slice
+		for i := 0; i < v.Len(); i++ {
+			elem := v.Index(i)
+			if elem.Kind() != reflect.Struct {
+				return
+			}
+			if name := elem.FieldByName("Name"); name.IsValid() && name.String() == key {
+				if len(rest) == 0 {
+					v.Set(reflect.AppendSlice(v.Slice(0, i), v.Slice(i+1, v.Len())))
+					return
+				}
+				resetValue(elem.Addr(), rest)
+				return
+			}
+		}
+	}
+}
+
+// fieldByAttributeName finds the struct field of a compose attribute, using the same rules as mapstructure
+func fieldByAttributeName(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if tag == name || (tag == "" && strings.EqualFold(f.Name, name)) {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
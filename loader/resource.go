@@ -0,0 +1,72 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ResourceLoader loads compose files referenced by `extends.file` or `include` from a non-local location,
+// like an HTTP endpoint, a git repository or a remote host over SSH. cli.WithResourceLoader also uses them to
+// read the top-level compose files
+type ResourceLoader interface {
+	// Accept returns true if the loader can load the resource at path
+	Accept(path string) bool
+	// Load returns the content of the resource at path
+	Load(ctx context.Context, path string) ([]byte, error)
+}
+
+// WithRemoteResourceLoaders registers loaders for compose files which are not on the local filesystem
+func WithRemoteResourceLoaders(loaders ...ResourceLoader) func(*Options) {
+	return func(opts *Options) {
+		opts.RemoteResourceLoaders = append(opts.RemoteResourceLoaders, loaders...)
+	}
+}
+
+// remoteResourceLoader returns the first registered loader accepting path, or nil if it's a local path
+func (o *Options) remoteResourceLoader(path string) ResourceLoader {
+	for _, loader := range o.RemoteResourceLoaders {
+		if loader.Accept(path) {
+			return loader
+		}
+	}
+	return nil
+}
+
+// loadRemoteResource reads a compose file using a registered ResourceLoader
+func loadRemoteResource(loader ResourceLoader, path string, opts *Options) ([]byte, error) {
+	ctx := opts.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	b, err := loader.Load(ctx, path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load %s", path)
+	}
+	return b, nil
+}
+
+// remoteSibling returns the location of file, a relative path, next to the remote resource at path: the last
+// element of path, after a `/` or a `:` like in `https://github.com/org/repo.git#main:compose.yaml`, is replaced
+func remoteSibling(path, file string) string {
+	file = strings.TrimPrefix(filepath.ToSlash(file), "./")
+	return path[:strings.LastIndexAny(path, "/:")+1] + file
+}
@@ -0,0 +1,150 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loader
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/compose-spec/compose-go/types"
+	"gotest.tools/v3/assert"
+)
+
+type memoryResourceLoader map[string]string
+
+func (m memoryResourceLoader) Accept(path string) bool {
+	return strings.HasPrefix(path, "https://")
+}
+
+func (m memoryResourceLoader) Load(_ context.Context, path string) ([]byte, error) {
+	content, ok := m[path]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", path, fs.ErrNotExist)
+	}
+	return []byte(content), nil
+}
+
+func TestLoadWithRemoteResourceLoaders(t *testing.T) {
+	remote := memoryResourceLoader{
+		"https://example.com/base.yaml": `
+services:
+  base:
+    image: base
+    environment:
+      FROM: base
+`,
+		"https://example.com/include.yaml": `
+services:
+  included:
+    image: included
+`,
+	}
+	project, err := Load(buildConfigDetails(`
+name: remote
+include:
+  - https://example.com/include.yaml
+services:
+  web:
+    extends:
+      file: https://example.com/base.yaml
+      service: base
+    environment:
+      FROM: web
+`, nil), WithRemoteResourceLoaders(remote))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.ServiceNames(), []string{"included", "web"})
+	web, err := project.GetService("web")
+	assert.NilError(t, err)
+	assert.Equal(t, web.Image, "base")
+	assert.DeepEqual(t, web.Environment, types.NewMappingWithEquals([]string{"FROM=web"}))
+
+	_, err = Load(buildConfigDetails(`
+name: remote
+services:
+  web:
+    extends:
+      file: https://example.com/missing.yaml
+      service: base
+`, nil), WithRemoteResourceLoaders(remote))
+	assert.ErrorContains(t, err, `cannot extend service "web" in filename0.yml: extends.file https://example.com/missing.yaml (resolved to https://example.com/missing.yaml) does not exist`)
+}
+
+func TestLoadExtendsInRemoteInclude(t *testing.T) {
+	remote := memoryResourceLoader{
+		"https://example.com/lib/compose.yaml": `
+services:
+  db:
+    extends:
+      file: ./base.yaml
+      service: base
+    environment:
+      FROM: db
+  cache:
+    extends:
+      file: missing.yaml
+      service: base
+`,
+		"https://example.com/lib/base.yaml": `
+services:
+  base:
+    image: postgres
+`,
+	}
+	_, err := Load(buildConfigDetails(`
+name: remote
+include:
+  - https://example.com/lib/compose.yaml
+services:
+  web:
+    image: nginx
+`, nil), WithRemoteResourceLoaders(remote))
+	assert.ErrorContains(t, err, `cannot extend service "cache" in https://example.com/lib/compose.yaml: extends.file https://example.com/lib/missing.yaml (resolved to https://example.com/lib/missing.yaml) does not exist`)
+
+	remote["https://example.com/lib/missing.yaml"] = `
+services:
+  base:
+    image: redis
+`
+	project, err := Load(buildConfigDetails(`
+name: remote
+include:
+  - https://example.com/lib/compose.yaml
+services:
+  web:
+    image: nginx
+`, nil), WithRemoteResourceLoaders(remote))
+	assert.NilError(t, err)
+	db, err := project.GetService("db")
+	assert.NilError(t, err)
+	assert.Equal(t, db.Image, "postgres")
+	cache, err := project.GetService("cache")
+	assert.NilError(t, err)
+	assert.Equal(t, cache.Image, "redis")
+}
+
+func TestRemoteSibling(t *testing.T) {
+	for path, expected := range map[string]string{
+		"https://example.com/lib/compose.yaml":              "https://example.com/lib/base.yaml",
+		"https://github.com/org/repo.git#main:compose.yaml": "https://github.com/org/repo.git#main:base.yaml",
+		"https://github.com/org/repo.git#main:lib/c.yaml":   "https://github.com/org/repo.git#main:lib/base.yaml",
+	} {
+		assert.Equal(t, remoteSibling(path, "./base.yaml"), expected)
+	}
+}
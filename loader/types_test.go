@@ -38,7 +38,7 @@ func TestMarshallProject(t *testing.T) {
 	assert.Check(t, is.Equal(expected, string(actual)))
 
 	// Make sure the expected still
-	_, err = Load(buildConfigDetails(expected, map[string]string{}), func(options *Options) {
+	_, err = Load(buildConfigDetails(expected, map[string]string{"BAR": "this is a secret"}), func(options *Options) {
 		options.SkipNormalization = true
 		options.SkipConsistencyCheck = true
 	})
@@ -58,7 +58,7 @@ func TestJSONMarshallProject(t *testing.T) {
 	assert.NilError(t, err)
 	assert.Check(t, is.Equal(expected, string(actual)))
 
-	_, err = Load(buildConfigDetails(expected, map[string]string{}), func(options *Options) {
+	_, err = Load(buildConfigDetails(expected, map[string]string{"BAR": "this is a secret"}), func(options *Options) {
 		options.SkipNormalization = true
 		options.SkipConsistencyCheck = true
 	})
@@ -18,41 +18,24 @@ package loader
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/compose-spec/compose-go/errdefs"
+	"github.com/compose-spec/compose-go/schema"
 	"github.com/compose-spec/compose-go/types"
 	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
 )
 
-// checkConsistency validate a compose model is consistent
-func checkConsistency(project *types.Project) error {
+// checkConsistency validate a compose model is consistent. When warnConflicts is set, mutually exclusive
+// service attributes are reported as warnings rather than errors. Warnings are added to project.WarningMessages
+func checkConsistency(project *types.Project, warnConflicts bool) error {
 	for _, s := range project.Services {
-		if s.Build == nil && s.Image == "" {
-			return errors.Wrapf(errdefs.ErrInvalid, "service %q has neither an image nor a build context specified", s.Name)
-		}
-
-		if s.Build != nil {
-			if s.Build.DockerfileInline != "" && s.Build.Dockerfile != "" {
-				return errors.Wrapf(errdefs.ErrInvalid, "service %q declares mutualy exclusive dockerfile and dockerfile_inline", s.Name)
-			}
-
-			if len(s.Build.Platforms) > 0 && s.Platform != "" {
-				var found bool
-				for _, platform := range s.Build.Platforms {
-					if platform == s.Platform {
-						found = true
-						break
-					}
-				}
-				if !found {
-					return errors.Wrapf(errdefs.ErrInvalid, "service.build.platforms MUST include service.platform %q ", s.Platform)
-				}
-			}
-		}
-
-		if s.NetworkMode != "" && len(s.Networks) > 0 {
-			return errors.Wrap(errdefs.ErrInvalid, fmt.Sprintf("service %s declares mutually exclusive `network_mode` and `networks`", s.Name))
+		if err := checkServiceConsistency(s, warnConflicts, &project.WarningMessages); err != nil {
+			return err
 		}
 		for network := range s.Networks {
 			if _, ok := project.Networks[network]; !ok {
@@ -60,27 +43,6 @@ func checkConsistency(project *types.Project) error {
 			}
 		}
 
-		if s.HealthCheck != nil && len(s.HealthCheck.Test) > 0 {
-			switch s.HealthCheck.Test[0] {
-			case "CMD", "CMD-SHELL", "NONE":
-			default:
-				return errors.New(`healthcheck.test must start either by "CMD", "CMD-SHELL" or "NONE"`)
-			}
-		}
-
-		for dependedService := range s.DependsOn {
-			if _, err := project.GetService(dependedService); err != nil {
-				return errors.Wrap(errdefs.ErrInvalid, fmt.Sprintf("service %q depends on undefined service %s", s.Name, dependedService))
-			}
-		}
-
-		if strings.HasPrefix(s.NetworkMode, types.ServicePrefix) {
-			serviceName := s.NetworkMode[len(types.ServicePrefix):]
-			if _, err := project.GetServices(serviceName); err != nil {
-				return fmt.Errorf("service %q not found for network_mode 'service:%s'", serviceName, serviceName)
-			}
-		}
-
 		for _, volume := range s.Volumes {
 			if volume.Type == types.VolumeTypeVolume && volume.Source != "" { // non anonymous volumes
 				if _, ok := project.Volumes[volume.Source]; !ok {
@@ -108,6 +70,13 @@ func checkConsistency(project *types.Project) error {
 		}
 	}
 
+	if err := checkServiceReferences(project); err != nil {
+		return err
+	}
+	if err := checkDependencyCycles(project); err != nil {
+		return err
+	}
+
 	for name, secret := range project.Secrets {
 		if secret.External.External {
 			continue
@@ -119,3 +88,574 @@ func checkConsistency(project *types.Project) error {
 
 	return nil
 }
+
+// ValidateProject validates a project after it has been modified programmatically, reporting the same errors
+// Load would for the equivalent compose file. The project is marshaled to its YAML representation, which is
+// checked against the compose-spec schema, then the consistency checks Load runs after normalization are applied,
+// with the default options. Warnings, like port conflicts between services, are added to project.WarningMessages
+func ValidateProject(project *types.Project) error {
+	b, err := project.MarshalYAML()
+	if err != nil {
+		return err
+	}
+	var dict map[string]interface{}
+	if err := yaml.Unmarshal(b, &dict); err != nil {
+		return err
+	}
+	if dict == nil {
+		dict = map[string]interface{}{}
+	}
+	if err := schema.Validate(dict); err != nil {
+		return schemaLoadError("", b, err)
+	}
+	if err := checkConsistency(project, false); err != nil {
+		return err
+	}
+	if err := checkEnvironmentNames(project, false); err != nil {
+		return err
+	}
+	project.WarningMessages = append(project.WarningMessages, checkPortConflicts(project.Services)...)
+	return nil
+}
+
+// ValidateService validates a service in isolation, as it would be by Load after normalization. The service is
+// checked against the compose-spec schema and by the consistency checks Load runs on each service, including
+// published ports, volume mounts and environment variable names. Networks, volumes and other resources the
+// service refers to are project-level and are not required to exist. Warnings, which Load would report in
+// Project.WarningMessages, are returned
+func ValidateService(s types.ServiceConfig) ([]string, error) {
+	name := s.Name
+	if name == "" {
+		name = "service"
+	}
+	b, err := yaml.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	var dict interface{}
+	if err := yaml.Unmarshal(b, &dict); err != nil {
+		return nil, err
+	}
+	if dict == nil {
+		dict = map[string]interface{}{}
+	}
+	if err := schema.Validate(map[string]interface{}{
+		"services": map[string]interface{}{name: dict},
+	}); err != nil {
+		return nil, errors.Wrap(errdefs.ErrInvalid, err.Error())
+	}
+
+	var warnings []string
+	if err := checkServiceConsistency(s, false, &warnings); err != nil {
+		return nil, err
+	}
+	// same as Load, invalid environment variable names are only reported as warnings
+	if msg := invalidEnvironmentNames(s); msg != "" {
+		warnings = append(warnings, msg)
+	}
+	return warnings, nil
+}
+
+// knownUlimits are the resource limits supported by the container runtime, see setrlimit(2)
+var knownUlimits = map[string]bool{
+	"as":         true,
+	"core":       true,
+	"cpu":        true,
+	"data":       true,
+	"fsize":      true,
+	"locks":      true,
+	"memlock":    true,
+	"msgqueue":   true,
+	"nice":       true,
+	"nofile":     true,
+	"nproc":      true,
+	"rss":        true,
+	"rtprio":     true,
+	"rttime":     true,
+	"sigpending": true,
+	"stack":      true,
+}
+
+// checkServiceConsistency validates the attributes of a service which don't refer to other project resources.
+// Attributes which are valid but unlikely to work as expected are reported by appending to warnings
+func checkServiceConsistency(s types.ServiceConfig, warnConflicts bool, warnings *[]string) error {
+	if s.Build == nil && s.Image == "" {
+		return errors.Wrapf(errdefs.ErrInvalid, "service %q has neither an image nor a build context specified", s.Name)
+	}
+
+	if s.Build != nil {
+		if s.Build.DockerfileInline != "" && s.Build.Dockerfile != "" {
+			return errors.Wrapf(errdefs.ErrInvalid, "service %q declares mutualy exclusive dockerfile and dockerfile_inline", s.Name)
+		}
+
+		if len(s.Build.Platforms) > 0 && s.Platform != "" {
+			var found bool
+			for _, platform := range s.Build.Platforms {
+				if platform == s.Platform {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return errors.Wrapf(errdefs.ErrInvalid, "service.build.platforms MUST include service.platform %q ", s.Platform)
+			}
+		}
+
+		if _, err := s.Build.CacheFromOptions(); err != nil {
+			return errors.Wrapf(errdefs.ErrInvalid, "service %q build.cache_from: %s", s.Name, err)
+		}
+		if _, err := s.Build.CacheToOptions(); err != nil {
+			return errors.Wrapf(errdefs.ErrInvalid, "service %q build.cache_to: %s", s.Name, err)
+		}
+	}
+
+	published := map[string]bool{}
+	for _, port := range s.Ports {
+		if port.Published == "" {
+			continue
+		}
+		protocol := port.Protocol
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		key := fmt.Sprintf("%s:%s/%s", port.HostIP, port.Published, protocol)
+		if published[key] {
+			*warnings = append(*warnings, fmt.Sprintf("service %q publishes port %s more than once", s.Name, strings.TrimPrefix(key, ":")))
+		}
+		published[key] = true
+	}
+
+	for _, volume := range s.Volumes {
+		if volume.Target == "" {
+			return errors.Wrapf(errdefs.ErrInvalid, "service %q declares a %s mount without a target", s.Name, volume.Type)
+		}
+		if (volume.Type == types.VolumeTypeBind || volume.Type == types.VolumeTypeNamedPipe) && volume.Source == "" {
+			return errors.Wrapf(errdefs.ErrInvalid, "service %q declares a %s mount on %s without a source", s.Name, volume.Type, volume.Target)
+		}
+	}
+
+	if err := checkSysctls(s); err != nil {
+		return err
+	}
+	*warnings = append(*warnings, sysctlWarnings(s)...)
+
+	for _, conflict := range conflictingAttributes(s) {
+		if warnConflicts {
+			*warnings = append(*warnings, conflict)
+			continue
+		}
+		return errors.Wrap(errdefs.ErrInvalid, conflict)
+	}
+	if s.Develop != nil {
+		for i, watch := range s.Develop.Watch {
+			if watch.Path == "" {
+				return errors.Wrapf(errdefs.ErrInvalid, "service %q develop.watch[%d] requires a path", s.Name, i)
+			}
+			switch watch.Action {
+			case types.WatchActionSync, types.WatchActionSyncRestart:
+				if watch.Target == "" {
+					return errors.Wrapf(errdefs.ErrInvalid, "service %q develop.watch[%d] requires a target for action %s", s.Name, i, watch.Action)
+				}
+			case types.WatchActionRebuild:
+			default:
+				return errors.Wrapf(errdefs.ErrInvalid, "service %q develop.watch[%d] has invalid action %q, must be one of %s, %s or %s",
+					s.Name, i, watch.Action, types.WatchActionRebuild, types.WatchActionSync, types.WatchActionSyncRestart)
+			}
+		}
+	}
+
+	for _, config := range s.Configs {
+		if err := checkFileReference(s.Name, "config", types.FileReferenceConfig(config)); err != nil {
+			return err
+		}
+	}
+	for _, secret := range s.Secrets {
+		if err := checkFileReference(s.Name, "secret", types.FileReferenceConfig(secret)); err != nil {
+			return err
+		}
+	}
+
+	if s.Restart != "" {
+		if _, err := types.ParseRestartPolicy(s.Restart); err != nil {
+			return errors.Wrapf(errdefs.ErrInvalid, "service %q: %s", s.Name, err)
+		}
+	}
+
+	if _, err := types.ParsePullPolicy(s.PullPolicy); err != nil {
+		return errors.Wrapf(errdefs.ErrInvalid, "service %q: %s", s.Name, err)
+	}
+	if s.PullPolicy == types.PullPolicyBuild && s.Build == nil {
+		*warnings = append(*warnings, fmt.Sprintf("service %q declares `pull_policy: build` but has no build section, its image can't be built", s.Name))
+	}
+
+	tmpfs, err := s.TmpfsMounts()
+	if err != nil {
+		return errors.Wrapf(errdefs.ErrInvalid, "service %q: %s", s.Name, err)
+	}
+	if s.ReadOnly && len(tmpfs) == 0 && !hasTmpfsVolume(s) {
+		*warnings = append(*warnings, fmt.Sprintf("service %q declares `read_only: true` without any tmpfs mount, its containers "+
+			"can only write to volumes", s.Name))
+	}
+
+	if _, err := types.ParseCPUSet(s.CPUSet); err != nil {
+		return errors.Wrapf(errdefs.ErrInvalid, "service %q: %s", s.Name, err)
+	}
+	if warning := windowsCPUWarning(s); warning != "" {
+		*warnings = append(*warnings, warning)
+	}
+
+	if s.StopSignal != "" && s.Init != nil && *s.Init {
+		*warnings = append(*warnings, fmt.Sprintf("service %q declares both `init: true` and `stop_signal: %s`, the signal is sent "+
+			"to the init process which forwards it to the service command", s.Name, s.StopSignal))
+	}
+
+	for key := range s.Annotations {
+		if key == "" || strings.ContainsAny(key, " \t\n") {
+			return errors.Wrapf(errdefs.ErrInvalid, "service %q declares invalid annotation key %q", s.Name, key)
+		}
+	}
+
+	for i, device := range s.Gpus {
+		if err := checkDeviceRequest(s.Name, fmt.Sprintf("gpus[%d]", i), device); err != nil {
+			return err
+		}
+	}
+	if s.Deploy != nil && s.Deploy.Resources.Reservations != nil {
+		for i, device := range s.Deploy.Resources.Reservations.Devices {
+			if err := checkDeviceRequest(s.Name, fmt.Sprintf("deploy.resources.reservations.devices[%d]", i), device); err != nil {
+				return err
+			}
+		}
+	}
+
+	names := make([]string, 0, len(s.Ulimits))
+	for name := range s.Ulimits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ulimit := s.Ulimits[name]
+		if !knownUlimits[name] {
+			*warnings = append(*warnings, fmt.Sprintf("service %q declares unknown ulimit %q", s.Name, name))
+		}
+		// -1 is unlimited, so it can't be exceeded
+		if ulimit != nil && ulimit.Single == 0 && ulimit.Hard != -1 && (ulimit.Soft == -1 || ulimit.Soft > ulimit.Hard) {
+			soft := strconv.Itoa(ulimit.Soft)
+			if ulimit.Soft == -1 {
+				soft = "unlimited"
+			}
+			return errors.Wrapf(errdefs.ErrInvalid, "service %q ulimit %s soft limit %s exceeds hard limit %d", s.Name, name, soft, ulimit.Hard)
+		}
+	}
+
+	if s.HealthCheck != nil && len(s.HealthCheck.Test) > 0 {
+		switch s.HealthCheck.Test[0] {
+		case "CMD", "CMD-SHELL", "NONE":
+		default:
+			return errors.New(`healthcheck.test must start either by "CMD", "CMD-SHELL" or "NONE"`)
+		}
+	}
+	return nil
+}
+
+// checkDeviceRequest makes sure a device request selects devices either by count or by IDs
+func checkDeviceRequest(service string, attribute string, device types.DeviceRequest) error {
+	if device.Count != 0 && len(device.IDs) > 0 {
+		return errors.Wrapf(errdefs.ErrInvalid, "service %q %s declares mutually exclusive `count` and `device_ids`", service, attribute)
+	}
+	return nil
+}
+
+// checkFileReference validates the mode and ownership a config or secret is mounted with
+func checkFileReference(service string, kind string, ref types.FileReferenceConfig) error {
+	if ref.Mode != nil && *ref.Mode > 0o777 {
+		return errors.Wrapf(errdefs.ErrInvalid, "service %q %s %s has invalid mode %#o", service, kind, ref.Source, *ref.Mode)
+	}
+	for _, id := range []struct{ attribute, value string }{{"uid", ref.UID}, {"gid", ref.GID}} {
+		if id.value == "" {
+			continue
+		}
+		if _, err := strconv.ParseUint(id.value, 10, 32); err != nil {
+			return errors.Wrapf(errdefs.ErrInvalid, "service %q %s %s has invalid %s %q", service, kind, ref.Source, id.attribute, id.value)
+		}
+	}
+	return nil
+}
+
+// publishedPorts is a range of host ports published by a service
+type publishedPorts struct {
+	service    string
+	hostIP     string
+	protocol   string
+	start, end uint64
+}
+
+// overlaps tells if two services can't publish both port ranges. Different protocols or host IPs don't
+// conflict, unless one of the ports is bound to all interfaces
+func (p publishedPorts) overlaps(other publishedPorts) bool {
+	if p.protocol != other.protocol {
+		return false
+	}
+	if p.hostIP != other.hostIP && !isWildcardIP(p.hostIP) && !isWildcardIP(other.hostIP) {
+		return false
+	}
+	return p.start <= other.end && other.start <= p.end
+}
+
+func isWildcardIP(ip string) bool {
+	return ip == "" || ip == "0.0.0.0" || ip == "::"
+}
+
+// checkPortConflicts returns a warning for each host port published by more than one service, which would fail
+// to bind at runtime
+func checkPortConflicts(services types.Services) []string {
+	var published []publishedPorts
+	for _, s := range services {
+		for _, port := range s.Ports {
+			if port.Published == "" {
+				continue
+			}
+			start, end, isRange := strings.Cut(port.Published, "-")
+			if !isRange {
+				end = start
+			}
+			first, err := strconv.ParseUint(start, 10, 16)
+			if err != nil {
+				continue
+			}
+			last, err := strconv.ParseUint(end, 10, 16)
+			if err != nil {
+				continue
+			}
+			protocol := port.Protocol
+			if protocol == "" {
+				protocol = "tcp"
+			}
+			published = append(published, publishedPorts{
+				service:  s.Name,
+				hostIP:   port.HostIP,
+				protocol: protocol,
+				start:    first,
+				end:      last,
+			})
+		}
+	}
+
+	var conflicts []string
+	for i, p := range published {
+		for _, other := range published[i+1:] {
+			if p.service == other.service || !p.overlaps(other) {
+				continue
+			}
+			first := p.start
+			if other.start > first {
+				first = other.start
+			}
+			port := fmt.Sprintf("%d/%s", first, p.protocol)
+			if !isWildcardIP(p.hostIP) || !isWildcardIP(other.hostIP) {
+				ip := p.hostIP
+				if isWildcardIP(ip) {
+					ip = other.hostIP
+				}
+				port = ip + ":" + port
+			}
+			services := []string{p.service, other.service}
+			sort.Strings(services)
+			conflicts = append(conflicts, fmt.Sprintf("services %q and %q both publish host port %s", services[0], services[1], port))
+		}
+	}
+	// services order depends on the compose file parsing, so conflicts are sorted for a stable report
+	sort.Strings(conflicts)
+	return conflicts
+}
+
+// checkServiceReferences reports all references to undefined services, by `depends_on`, `links`,
+// `volumes_from` or `service:` namespaces. References to containers, using `container:`, are not checked.
+// Optional `depends_on` references are added to project.WarningMessages
+func checkServiceReferences(project *types.Project) error {
+	defined := map[string]bool{}
+	for _, s := range project.Services {
+		defined[s.Name] = true
+	}
+	var dangling []string
+	for _, dep := range project.Dependencies() {
+		if defined[dep.To] {
+			continue
+		}
+		if dep.Optional {
+			project.WarningMessages = append(project.WarningMessages,
+				fmt.Sprintf("service %q depends on undefined service %s, which is ignored as it is not required", dep.From, dep.To))
+			continue
+		}
+		if dep.Kind == types.DependencyDependsOn {
+			dangling = append(dangling, fmt.Sprintf("service %q depends on undefined service %s", dep.From, dep.To))
+			continue
+		}
+		dangling = append(dangling, fmt.Sprintf("service %q refers to undefined service %s in %s", dep.From, dep.To, dep.Kind))
+	}
+	if len(dangling) > 0 {
+		return errors.Wrap(errdefs.ErrInvalid, strings.Join(dangling, ", "))
+	}
+	return nil
+}
+
+// checkDependencyCycles reports services depending on each other through `depends_on`, `links`,
+// `service:` namespaces or `volumes_from`, which could never be started
+func checkDependencyCycles(project *types.Project) error {
+	graph, err := project.DependencyGraph()
+	if err != nil {
+		return errors.Wrap(errdefs.ErrInvalid, err.Error())
+	}
+	if _, err := graph.TopologicalSort(); err != nil {
+		return errors.Wrap(errdefs.ErrInvalid, err.Error())
+	}
+	return nil
+}
+
+var posixVariableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// checkEnvironmentNames reports `environment` and `build.args` keys which aren't valid POSIX variable
+// names, and as such can't be used from a shell. Those are added to project.WarningMessages, unless strict is set
+func checkEnvironmentNames(project *types.Project, strict bool) error {
+	var invalid []string
+	for _, s := range project.Services {
+		msg := invalidEnvironmentNames(s)
+		if msg == "" {
+			continue
+		}
+		if !strict {
+			project.WarningMessages = append(project.WarningMessages, msg)
+			continue
+		}
+		invalid = append(invalid, msg)
+	}
+	if len(invalid) > 0 {
+		return errors.Wrap(errdefs.ErrInvalid, strings.Join(invalid, "\n"))
+	}
+	return nil
+}
+
+// invalidEnvironmentNames describes the `environment` and `build.args` keys of a service which aren't valid
+// POSIX variable names, or returns an empty string if there's none
+func invalidEnvironmentNames(s types.ServiceConfig) string {
+	var names []string
+	for name := range s.Environment {
+		if !posixVariableName.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	if s.Build != nil {
+		for name := range s.Build.Args {
+			if !posixVariableName.MatchString(name) {
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("service %q declares invalid environment variable names: %s", s.Name, strings.Join(names, ", "))
+}
+
+func hasTmpfsVolume(s types.ServiceConfig) bool {
+	for _, volume := range s.Volumes {
+		if volume.Type == types.VolumeTypeTmpfs {
+			return true
+		}
+	}
+	return false
+}
+
+// windowsCPUWarning reports the `cpu_count` and `cpu_percent` attributes, which only apply to Windows containers,
+// when they're used by a service which targets another platform, or which sets the Linux-only `cpuset`
+func windowsCPUWarning(s types.ServiceConfig) string {
+	var attributes []string
+	if s.CPUCount != 0 {
+		attributes = append(attributes, "`cpu_count`")
+	}
+	if s.CPUPercent != 0 {
+		attributes = append(attributes, "`cpu_percent`")
+	}
+	if len(attributes) == 0 {
+		return ""
+	}
+	switch {
+	case s.Platform != "" && !strings.HasPrefix(s.Platform, "windows"):
+		return fmt.Sprintf("service %q declares %s, only supported by Windows containers, but targets platform %s",
+			s.Name, strings.Join(attributes, " and "), s.Platform)
+	case s.CPUSet != "":
+		return fmt.Sprintf("service %q declares %s, only supported by Windows containers, along with `cpuset`, "+
+			"only supported by Linux containers", s.Name, strings.Join(attributes, " and "))
+	}
+	return ""
+}
+
+// conflictingAttributes lists the mutually exclusive attributes declared by a service
+func conflictingAttributes(s types.ServiceConfig) []string {
+	var conflicts []string
+	if s.NetworkMode != "" && len(s.Networks) > 0 {
+		conflicts = append(conflicts, fmt.Sprintf("service %s declares mutually exclusive `network_mode` and `networks`", s.Name))
+	}
+	if kind, _ := s.NetworkModeKind(); kind == types.NetworkModeHost && len(s.Ports) > 0 {
+		conflicts = append(conflicts, fmt.Sprintf("service %s declares `ports` but uses `network_mode: host`, which doesn't support port publishing", s.Name))
+	}
+	if s.ContainerName != "" && s.Deploy != nil && s.Deploy.Replicas != nil && *s.Deploy.Replicas > 1 {
+		conflicts = append(conflicts, fmt.Sprintf("service %s declares `container_name` with `deploy.replicas: %d`, but container names must be unique", s.Name, *s.Deploy.Replicas))
+	}
+	return conflicts
+}
+
+// namespacedSysctls are the `kernel.` sysctls isolated by the IPC namespace. Along with the `fs.mqueue.` ones, also
+// isolated by the IPC namespace, and the `net.` ones, isolated by the network namespace, these are the only sysctls
+// a container can set without affecting the host
+var namespacedSysctls = map[string]bool{
+	"kernel.msgmax":          true,
+	"kernel.msgmnb":          true,
+	"kernel.msgmni":          true,
+	"kernel.sem":             true,
+	"kernel.shmall":          true,
+	"kernel.shmmax":          true,
+	"kernel.shmmni":          true,
+	"kernel.shm_rmid_forced": true,
+}
+
+// checkSysctls validates the names of the sysctls set by a service, like `net.core.somaxconn = 1024` declared in
+// the list syntax
+func checkSysctls(s types.ServiceConfig) error {
+	for name := range s.Sysctls {
+		if name == "" || strings.ContainsAny(name, " \t") {
+			return errors.Wrapf(errdefs.ErrInvalid, "service %q declares invalid sysctl name %q", s.Name, name)
+		}
+	}
+	return nil
+}
+
+// sysctlWarnings lists the sysctls set by a service which the container runtime is likely to reject, as they're
+// not namespaced, or share the namespace of the host
+func sysctlWarnings(s types.ServiceConfig) []string {
+	names := make([]string, 0, len(s.Sysctls))
+	for name := range s.Sysctls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var warnings []string
+	for _, name := range names {
+		switch {
+		case strings.HasPrefix(name, "net."):
+			if kind, _ := s.NetworkModeKind(); kind == types.NetworkModeHost {
+				warnings = append(warnings, fmt.Sprintf("service %s sets sysctl %s, which can't be set with `network_mode: host`", s.Name, name))
+			}
+		case namespacedSysctls[name], strings.HasPrefix(name, "fs.mqueue."):
+			if s.Ipc == "host" {
+				warnings = append(warnings, fmt.Sprintf("service %s sets sysctl %s, which can't be set with `ipc: host`", s.Name, name))
+			}
+		default:
+			if !s.Privileged {
+				warnings = append(warnings, fmt.Sprintf("service %s sets sysctl %s, which is not namespaced and requires `privileged: true`", s.Name, name))
+			}
+		}
+	}
+	return warnings
+}
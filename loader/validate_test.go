@@ -17,10 +17,14 @@
 package loader
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
 
+	"github.com/compose-spec/compose-go/errdefs"
 	"github.com/compose-spec/compose-go/types"
 )
 
@@ -39,7 +43,7 @@ func TestValidateAnonymousVolume(t *testing.T) {
 			},
 		}),
 	}
-	err := checkConsistency(project)
+	err := checkConsistency(project, false)
 	assert.NilError(t, err)
 }
 
@@ -59,7 +63,7 @@ func TestValidateNamedVolume(t *testing.T) {
 			},
 		}),
 	}
-	err := checkConsistency(project)
+	err := checkConsistency(project, false)
 	assert.Error(t, err, `service "myservice" refers to undefined volume myVolume: invalid compose project`)
 
 	project.Volumes = types.Volumes(map[string]types.VolumeConfig{
@@ -67,7 +71,7 @@ func TestValidateNamedVolume(t *testing.T) {
 			Name: "myVolume",
 		},
 	})
-	err = checkConsistency(project)
+	err = checkConsistency(project, false)
 	assert.NilError(t, err)
 }
 
@@ -79,7 +83,7 @@ func TestValidateNoBuildNoImage(t *testing.T) {
 			},
 		}),
 	}
-	err := checkConsistency(project)
+	err := checkConsistency(project, false)
 	assert.Error(t, err, `service "myservice" has neither an image nor a build context specified: invalid compose project`)
 }
 
@@ -98,7 +102,7 @@ func TestValidateNetworkMode(t *testing.T) {
 				},
 			}),
 		}
-		err := checkConsistency(project)
+		err := checkConsistency(project, false)
 		assert.NilError(t, err)
 	})
 
@@ -116,8 +120,8 @@ func TestValidateNetworkMode(t *testing.T) {
 				},
 			}),
 		}
-		err := checkConsistency(project)
-		assert.Error(t, err, `service "nonexistentservice" not found for network_mode 'service:nonexistentservice'`)
+		err := checkConsistency(project, false)
+		assert.Error(t, err, `service "myservice2" refers to undefined service nonexistentservice in network_mode: invalid compose project`)
 	})
 
 	t.Run("network_mode container", func(t *testing.T) {
@@ -135,7 +139,7 @@ func TestValidateNetworkMode(t *testing.T) {
 				},
 			}),
 		}
-		err := checkConsistency(project)
+		err := checkConsistency(project, false)
 		assert.NilError(t, err)
 	})
 
@@ -153,7 +157,7 @@ func TestValidateNetworkMode(t *testing.T) {
 				},
 			}),
 		}
-		err := checkConsistency(project)
+		err := checkConsistency(project, false)
 		assert.Error(t, err, "service myservice1 declares mutually exclusive `network_mode` and `networks`: invalid compose project")
 	})
 }
@@ -167,7 +171,7 @@ func TestValidateSecret(t *testing.T) {
 				},
 			},
 		}
-		err := checkConsistency(project)
+		err := checkConsistency(project, false)
 		assert.NilError(t, err)
 	})
 	t.Run("secret set by environment", func(t *testing.T) {
@@ -178,7 +182,7 @@ func TestValidateSecret(t *testing.T) {
 				},
 			},
 		}
-		err := checkConsistency(project)
+		err := checkConsistency(project, false)
 		assert.NilError(t, err)
 	})
 	t.Run("external secret", func(t *testing.T) {
@@ -189,7 +193,7 @@ func TestValidateSecret(t *testing.T) {
 				},
 			},
 		}
-		err := checkConsistency(project)
+		err := checkConsistency(project, false)
 		assert.NilError(t, err)
 	})
 	t.Run("unset secret type", func(t *testing.T) {
@@ -198,7 +202,7 @@ func TestValidateSecret(t *testing.T) {
 				"foo": types.SecretConfig{},
 			},
 		}
-		err := checkConsistency(project)
+		err := checkConsistency(project, false)
 		assert.Error(t, err, "secret \"foo\" must declare either `file` or `environment`: invalid compose project")
 	})
 
@@ -223,7 +227,7 @@ func TestValidateSecret(t *testing.T) {
 				},
 			}),
 		}
-		err := checkConsistency(project)
+		err := checkConsistency(project, false)
 		assert.NilError(t, err)
 	})
 
@@ -241,9 +245,54 @@ func TestValidateSecret(t *testing.T) {
 				},
 			}),
 		}
-		err := checkConsistency(project)
+		err := checkConsistency(project, false)
 		assert.Error(t, err, `service "myservice" refers to undefined secret foo: invalid compose project`)
 	})
+
+	t.Run("build secret exist", func(t *testing.T) {
+		project := &types.Project{
+			Secrets: types.Secrets{
+				"foo": types.SecretConfig{
+					Environment: "TOKEN",
+				},
+			},
+			Services: types.Services([]types.ServiceConfig{
+				{
+					Name: "myservice",
+					Build: &types.BuildConfig{
+						Context: ".",
+						Secrets: []types.ServiceSecretConfig{
+							{
+								Source: "foo",
+							},
+						},
+					},
+				},
+			}),
+		}
+		err := checkConsistency(project, false)
+		assert.NilError(t, err)
+	})
+
+	t.Run("build secret undefined", func(t *testing.T) {
+		project := &types.Project{
+			Services: types.Services([]types.ServiceConfig{
+				{
+					Name: "myservice",
+					Build: &types.BuildConfig{
+						Context: ".",
+						Secrets: []types.ServiceSecretConfig{
+							{
+								Source: "foo",
+							},
+						},
+					},
+				},
+			}),
+		}
+		err := checkConsistency(project, false)
+		assert.Error(t, err, `service "myservice" refers to undefined build secret foo: invalid compose project`)
+	})
 }
 
 func TestValidateDependsOn(t *testing.T) {
@@ -258,6 +307,340 @@ func TestValidateDependsOn(t *testing.T) {
 			},
 		}),
 	}
-	err := checkConsistency(&project)
+	err := checkConsistency(&project, false)
 	assert.Error(t, err, `service "myservice" depends on undefined service missingservice: invalid compose project`)
 }
+
+func TestValidateServiceReferences(t *testing.T) {
+	project := types.Project{
+		Services: types.Services([]types.ServiceConfig{
+			{
+				Name:        "web",
+				Image:       "scratch",
+				DependsOn:   map[string]types.ServiceDependency{"typo": {}},
+				Links:       []string{"db:database", "cache"},
+				VolumesFrom: []string{"data:ro", "container:legacy"},
+			},
+			{
+				Name:        "db",
+				Image:       "scratch",
+				NetworkMode: "service:proxy",
+				Ipc:         "service:web",
+				Pid:         "service:agent",
+			},
+			{
+				Name:        "sidecar",
+				Image:       "scratch",
+				NetworkMode: "container:proxy",
+				Ipc:         "container:shm",
+				Pid:         "host",
+			},
+		}),
+	}
+	err := checkConsistency(&project, false)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.Error(t, err, `service "web" depends on undefined service typo, `+
+		`service "web" refers to undefined service cache in links, `+
+		`service "web" refers to undefined service data in volumes_from, `+
+		`service "db" refers to undefined service proxy in network_mode, `+
+		`service "db" refers to undefined service agent in pid: invalid compose project`)
+}
+
+func TestValidateDependencyCycle(t *testing.T) {
+	project := types.Project{
+		Services: types.Services([]types.ServiceConfig{
+			{
+				Name:      "a",
+				Image:     "scratch",
+				DependsOn: map[string]types.ServiceDependency{"b": {}},
+			},
+			{
+				Name:        "b",
+				Image:       "scratch",
+				NetworkMode: "service:c",
+			},
+			{
+				Name:        "c",
+				Image:       "scratch",
+				VolumesFrom: []string{"a:ro"},
+			},
+		}),
+	}
+	err := checkConsistency(&project, false)
+	assert.Error(t, err, "cycle detected: a -> b -> c -> a: invalid compose project")
+
+	project.Services[2].VolumesFrom = []string{"container:a"}
+	err = checkConsistency(&project, false)
+	assert.NilError(t, err)
+}
+
+func TestValidateConflictingAttributes(t *testing.T) {
+	replicas := uint64(2)
+	tests := []struct {
+		name    string
+		service types.ServiceConfig
+		err     string
+	}{
+		{
+			name: "ports with network_mode host",
+			service: types.ServiceConfig{
+				Name:        "myservice",
+				Image:       "scratch",
+				NetworkMode: "host",
+				Ports:       []types.ServicePortConfig{{Target: 80, Published: "8080"}},
+			},
+			err: "service myservice declares `ports` but uses `network_mode: host`, which doesn't support port publishing: invalid compose project",
+		},
+		{
+			name: "container_name with replicas",
+			service: types.ServiceConfig{
+				Name:          "myservice",
+				Image:         "scratch",
+				ContainerName: "mycontainer",
+				Deploy:        &types.DeployConfig{Replicas: &replicas},
+			},
+			err: "service myservice declares `container_name` with `deploy.replicas: 2`, but container names must be unique: invalid compose project",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project := &types.Project{
+				Services: types.Services{tt.service},
+			}
+			err := checkConsistency(project, false)
+			assert.Error(t, err, tt.err)
+
+			err = checkConsistency(project, true)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, project.WarningMessages, []string{strings.TrimSuffix(tt.err, ": invalid compose project")})
+		})
+	}
+}
+
+func TestValidateEnvironmentNames(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services{
+			{
+				Name:  "myservice",
+				Image: "scratch",
+				Environment: types.NewMappingWithEquals([]string{
+					"VALID_NAME=1", "_ALSO_VALID=2", "with-dash=3", "1STARTS_WITH_DIGIT=4",
+				}),
+				Build: &types.BuildConfig{
+					Context: ".",
+					Args:    types.NewMappingWithEquals([]string{"GOOD_ARG=1", "bad.arg=2"}),
+				},
+			},
+			{
+				Name:        "other",
+				Image:       "scratch",
+				Environment: types.NewMappingWithEquals([]string{"OK=1"}),
+			},
+		},
+	}
+	err := checkEnvironmentNames(project, true)
+	assert.Error(t, err, `service "myservice" declares invalid environment variable names: 1STARTS_WITH_DIGIT, bad.arg, with-dash: invalid compose project`)
+
+	err = checkEnvironmentNames(project, false)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.WarningMessages, []string{
+		`service "myservice" declares invalid environment variable names: 1STARTS_WITH_DIGIT, bad.arg, with-dash`,
+	})
+}
+
+func TestValidateServicePorts(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services{
+			{
+				Name:  "myservice",
+				Image: "scratch",
+				Ports: []types.ServicePortConfig{
+					{Target: 80, Published: "8080"},
+					{Target: 8080, Published: "8080", Protocol: "tcp"},
+					{Target: 8080, Published: "8080", Protocol: "udp"},
+				},
+			},
+		},
+	}
+	err := checkConsistency(project, false)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.WarningMessages, []string{`service "myservice" publishes port 8080/tcp more than once`})
+}
+
+func TestValidateService(t *testing.T) {
+	for _, s := range services("/working/dir", "/home") {
+		// full example is only meant to cover all attributes, some of which are mutually exclusive
+		s.NetworkMode = ""
+		s.ContainerName = ""
+		_, err := ValidateService(s)
+		assert.NilError(t, err, s.Name)
+	}
+
+	warnings, err := ValidateService(types.ServiceConfig{
+		Name:     "myservice",
+		Image:    "scratch",
+		Networks: map[string]*types.ServiceNetworkConfig{"undeclared": nil},
+	})
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(warnings, 0))
+
+	_, err = ValidateService(types.ServiceConfig{
+		Name:    "myservice",
+		Image:   "scratch",
+		Volumes: []types.ServiceVolumeConfig{{Type: types.VolumeTypeBind, Target: "/data"}},
+	})
+	assert.Error(t, err, `service "myservice" declares a bind mount on /data without a source: invalid compose project`)
+
+	warnings, err = ValidateService(types.ServiceConfig{
+		Name:        "myservice",
+		Image:       "scratch",
+		StopSignal:  "SIGTERM",
+		Environment: types.NewMappingWithEquals([]string{"with-dash=1"}),
+		Ports: []types.ServicePortConfig{
+			{Target: 80, Published: "8080"},
+			{Target: 8080, Published: "8080", Protocol: "tcp"},
+		},
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, warnings, []string{
+		`service "myservice" publishes port 8080/tcp more than once`,
+		`service "myservice" declares invalid environment variable names: with-dash`,
+	})
+
+	_, err = ValidateService(types.ServiceConfig{
+		Name:   "myservice",
+		Image:  "scratch",
+		Cgroup: "shared",
+	})
+	assert.ErrorContains(t, err, "services.myservice.cgroup must be one of the following")
+
+	_, err = ValidateService(types.ServiceConfig{Name: "myservice"})
+	assert.Error(t, err, `service "myservice" has neither an image nor a build context specified: invalid compose project`)
+}
+
+func TestValidateProject(t *testing.T) {
+	project, err := Load(buildConfigDetails(`
+name: validate
+services:
+  web:
+    image: web
+    ports:
+      - 8080:80
+`, nil))
+	assert.NilError(t, err)
+	assert.NilError(t, ValidateProject(project))
+
+	_, loadErr := Load(buildConfigDetails(`
+name: validate
+services:
+  web:
+    image: web
+    cgroup: shared
+`, nil))
+	assert.Assert(t, loadErr != nil)
+	project.Services[0].Cgroup = "shared"
+	err = ValidateProject(project)
+	assert.Error(t, err, loadErr.Error())
+	var validationErr *LoadError
+	assert.Assert(t, errors.As(err, &validationErr))
+	assert.Equal(t, validationErr.Path, "services.web.cgroup")
+
+	project.Services[0].Cgroup = ""
+	project.Services = append(project.Services, types.ServiceConfig{
+		Name:  "admin",
+		Image: "admin",
+		Ports: []types.ServicePortConfig{{Target: 80, Published: "8080", Protocol: "tcp"}},
+	})
+	assert.NilError(t, ValidateProject(project))
+	assert.DeepEqual(t, project.WarningMessages, []string{`services "admin" and "web" both publish host port 8080/tcp`})
+
+	project.Services = project.Services[:1]
+	project.Services[0].DependsOn = types.DependsOnConfig{"db": {Condition: types.ServiceConditionStarted}}
+	err = ValidateProject(project)
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.Error(t, err, `service "web" depends on undefined service db: invalid compose project`)
+}
+
+func TestValidatePortConflicts(t *testing.T) {
+	tests := []struct {
+		name    string
+		web     []types.ServicePortConfig
+		other   []types.ServicePortConfig
+		warning string
+	}{
+		{
+			name:    "same port",
+			web:     []types.ServicePortConfig{{Target: 80, Published: "8080", Protocol: "tcp"}},
+			other:   []types.ServicePortConfig{{Target: 8000, Published: "8080", Protocol: "tcp"}},
+			warning: `services "other" and "web" both publish host port 8080/tcp`,
+		},
+		{
+			name:  "different protocols",
+			web:   []types.ServicePortConfig{{Target: 53, Published: "53", Protocol: "tcp"}},
+			other: []types.ServicePortConfig{{Target: 53, Published: "53", Protocol: "udp"}},
+		},
+		{
+			name:    "range",
+			web:     []types.ServicePortConfig{{Target: 80, Published: "8000-8010", Protocol: "tcp"}},
+			other:   []types.ServicePortConfig{{Target: 80, Published: "8005"}},
+			warning: `services "other" and "web" both publish host port 8005/tcp`,
+		},
+		{
+			name:  "disjoint ranges",
+			web:   []types.ServicePortConfig{{Target: 80, Published: "8000-8010", Protocol: "tcp"}},
+			other: []types.ServicePortConfig{{Target: 80, Published: "8011-8020", Protocol: "tcp"}},
+		},
+		{
+			name:  "different host IPs",
+			web:   []types.ServicePortConfig{{Target: 80, Published: "8080", HostIP: "127.0.0.1", Protocol: "tcp"}},
+			other: []types.ServicePortConfig{{Target: 80, Published: "8080", HostIP: "192.168.1.10", Protocol: "tcp"}},
+		},
+		{
+			name:    "host IP and all interfaces",
+			web:     []types.ServicePortConfig{{Target: 80, Published: "8080", HostIP: "127.0.0.1", Protocol: "tcp"}},
+			other:   []types.ServicePortConfig{{Target: 80, Published: "8080", HostIP: "0.0.0.0", Protocol: "tcp"}},
+			warning: `services "other" and "web" both publish host port 127.0.0.1:8080/tcp`,
+		},
+		{
+			name:  "not published",
+			web:   []types.ServicePortConfig{{Target: 80, Protocol: "tcp"}},
+			other: []types.ServicePortConfig{{Target: 80, Protocol: "tcp"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := checkPortConflicts(types.Services{
+				{Name: "web", Ports: tt.web},
+				{Name: "other", Ports: tt.other},
+			})
+			if tt.warning == "" {
+				assert.Check(t, is.Len(warnings, 0))
+				return
+			}
+			assert.DeepEqual(t, warnings, []string{tt.warning})
+		})
+	}
+}
+
+func TestLoadPortConflictsWithProfiles(t *testing.T) {
+	yaml := `
+name: port-conflicts
+services:
+  web:
+    image: web
+    ports:
+      - 8080:80
+  debug:
+    image: debug
+    profiles: [debug]
+    ports:
+      - 8080:80
+`
+	project, err := Load(buildConfigDetails(yaml, nil))
+	assert.NilError(t, err)
+	assert.Check(t, is.Len(project.WarningMessages, 0))
+
+	project, err = Load(buildConfigDetails(yaml, nil), WithProfiles([]string{"debug"}))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, project.WarningMessages, []string{`services "debug" and "web" both publish host port 8080/tcp`})
+}
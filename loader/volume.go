@@ -27,7 +27,8 @@ import (
 
 const endOfSpec = rune(0)
 
-// ParseVolume parses a volume spec without any knowledge of the target platform
+// ParseVolume parses a volume spec without any knowledge of the target platform. The short syntax is fully
+// expanded into the long syntax, with options only set on the mount type they apply to
 func ParseVolume(spec string) (types.ServiceVolumeConfig, error) {
 	volume := types.ServiceVolumeConfig{}
 
@@ -36,17 +37,20 @@ func ParseVolume(spec string) (types.ServiceVolumeConfig, error) {
 		return volume, errors.New("invalid empty volume spec")
 	case 1, 2:
 		volume.Target = spec
-		volume.Type = types.VolumeTypeVolume
+		populateType(&volume)
 		return volume, nil
 	}
 
 	var buffer []rune
+	var options []string
 	for _, char := range spec + string(endOfSpec) {
 		switch {
 		case isWindowsDrive(buffer, char):
 			buffer = append(buffer, char)
 		case char == ':' || char == endOfSpec:
-			if err := populateFieldFromBuffer(char, buffer, &volume); err != nil {
+			var err error
+			options, err = populateFieldFromBuffer(char, buffer, &volume)
+			if err != nil {
 				populateType(&volume)
 				return volume, errors.Wrapf(err, "invalid spec: %s", spec)
 			}
@@ -57,6 +61,7 @@ func ParseVolume(spec string) (types.ServiceVolumeConfig, error) {
 	}
 
 	populateType(&volume)
+	populateOptions(&volume, options)
 	return volume, nil
 }
 
@@ -64,40 +69,50 @@ func isWindowsDrive(buffer []rune, char rune) bool {
 	return char == ':' && len(buffer) == 1 && unicode.IsLetter(buffer[0])
 }
 
-func populateFieldFromBuffer(char rune, buffer []rune, volume *types.ServiceVolumeConfig) error {
+// populateFieldFromBuffer sets the volume source or target from a section of the spec, or returns the
+// options it declares
+func populateFieldFromBuffer(char rune, buffer []rune, volume *types.ServiceVolumeConfig) ([]string, error) {
 	strBuffer := string(buffer)
 	switch {
 	case len(buffer) == 0:
-		return errors.New("empty section between colons")
+		return nil, errors.New("empty section between colons")
 	// Anonymous volume
 	case volume.Source == "" && char == endOfSpec:
 		volume.Target = strBuffer
-		return nil
+		return nil, nil
 	case volume.Source == "":
 		volume.Source = strBuffer
-		return nil
+		return nil, nil
 	case volume.Target == "":
 		volume.Target = strBuffer
-		return nil
+		return nil, nil
 	case char == ':':
-		return errors.New("too many colons")
+		return nil, errors.New("too many colons")
 	}
-	for _, option := range strings.Split(strBuffer, ",") {
+	return strings.Split(strBuffer, ","), nil
+}
+
+// populateOptions applies the options of a volume spec once the volume type is known
+func populateOptions(volume *types.ServiceVolumeConfig, options []string) {
+	for _, option := range options {
 		switch option {
 		case "ro":
 			volume.ReadOnly = true
 		case "rw":
 			volume.ReadOnly = false
 		case "nocopy":
-			volume.Volume = &types.ServiceVolumeVolume{NoCopy: true}
+			if volume.Type == types.VolumeTypeVolume {
+				volume.Volume.NoCopy = true
+			}
+		case types.ConsistencyCached, types.ConsistencyConsistent, types.ConsistencyDelegated:
+			volume.Consistency = option
 		default:
-			if isBindOption(option) {
+			if isBindOption(option) && volume.Type == types.VolumeTypeBind {
 				setBindOption(volume, option)
 			}
 			// ignore unknown options
 		}
 	}
-	return nil
 }
 
 var Propagations = []string{
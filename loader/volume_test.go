@@ -51,7 +51,7 @@ func TestParseVolumeTooManyColons(t *testing.T) {
 func TestParseVolumeShortVolumes(t *testing.T) {
 	for _, path := range []string{".", "/a"} {
 		volume, err := ParseVolume(path)
-		expected := types.ServiceVolumeConfig{Type: "volume", Target: path}
+		expected := types.ServiceVolumeConfig{Type: "volume", Target: path, Volume: &types.ServiceVolumeVolume{}}
 		assert.NilError(t, err)
 		assert.Check(t, is.DeepEqual(expected, volume))
 	}
@@ -177,6 +177,58 @@ func TestParseVolumeWithVolumeOptions(t *testing.T) {
 	assert.Check(t, is.DeepEqual(expected, volume))
 }
 
+func TestParseVolumeExpandsShortSyntax(t *testing.T) {
+	for _, tt := range []struct {
+		spec     string
+		expected types.ServiceVolumeConfig
+	}{
+		{
+			spec: "./data:/var/lib:ro,z",
+			expected: types.ServiceVolumeConfig{
+				Type:     "bind",
+				Source:   "./data",
+				Target:   "/var/lib",
+				ReadOnly: true,
+				Bind:     &types.ServiceVolumeBind{SELinux: "z", CreateHostPath: true},
+			},
+		},
+		{
+			spec: "./data:/var/lib:nocopy,cached",
+			expected: types.ServiceVolumeConfig{
+				Type:        "bind",
+				Source:      "./data",
+				Target:      "/var/lib",
+				Consistency: "cached",
+				Bind:        &types.ServiceVolumeBind{CreateHostPath: true},
+			},
+		},
+		{
+			spec: "data:/var/lib:ro,z,rshared,nocopy",
+			expected: types.ServiceVolumeConfig{
+				Type:     "volume",
+				Source:   "data",
+				Target:   "/var/lib",
+				ReadOnly: true,
+				Volume:   &types.ServiceVolumeVolume{NoCopy: true},
+			},
+		},
+		{
+			spec: "/var/lib",
+			expected: types.ServiceVolumeConfig{
+				Type:   "volume",
+				Target: "/var/lib",
+				Volume: &types.ServiceVolumeVolume{},
+			},
+		},
+	} {
+		t.Run(tt.spec, func(t *testing.T) {
+			volume, err := ParseVolume(tt.spec)
+			assert.NilError(t, err)
+			assert.Check(t, is.DeepEqual(tt.expected, volume))
+		})
+	}
+}
+
 func TestParseVolumeWithReadOnly(t *testing.T) {
 	for _, path := range []string{"./foo", "/home/user"} {
 		volume, err := ParseVolume(path + ":/target:ro")
@@ -49,6 +49,7 @@ func withVersionServices(workingDir, homeDir string) []types.ServiceConfig {
 
 			Image:       "busybox:1.31.0-uclibc",
 			Command:     []string{"top"},
+			CommandForm: types.CommandFormShell,
 			Environment: types.MappingWithEquals{},
 			Volumes: []types.ServiceVolumeConfig{
 				{Target: "/data", Type: "volume", Volume: &types.ServiceVolumeVolume{}},
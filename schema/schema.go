@@ -17,10 +17,13 @@
 package schema
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/opencontainers/go-digest"
 	"github.com/xeipuuv/gojsonschema"
 
 	// Enable support for embedded static resources
@@ -56,9 +59,89 @@ func init() {
 //go:embed compose-spec.json
 var Schema string
 
+// JSON returns the compose-spec JSON schema used to validate the configuration, for use by other validators
+func JSON() ([]byte, error) {
+	return []byte(Schema), nil
+}
+
+// Version identifies the revision of the compose-spec JSON schema, as the schema doesn't declare a version number.
+// This is the digest of the schema, like `sha256:...`, so a copy can be checked to be in sync with the loader
+func Version() string {
+	return digest.FromString(Schema).String()
+}
+
 // Validate uses the jsonschema to validate the configuration
 func Validate(config map[string]interface{}) error {
-	schemaLoader := gojsonschema.NewStringLoader(Schema)
+	return validate(gojsonschema.NewStringLoader(Schema), config)
+}
+
+var (
+	strictSchema     []byte
+	strictSchemaErr  error
+	strictSchemaOnce sync.Once
+)
+
+// ValidateStrict is like Validate, but also rejects the attributes the schema doesn't declare for objects which
+// would otherwise accept any, like `external`. Extension attributes prefixed by `x-` are still permitted
+func ValidateStrict(config map[string]interface{}) error {
+	strictSchemaOnce.Do(func() {
+		var s map[string]interface{}
+		if strictSchemaErr = json.Unmarshal([]byte(Schema), &s); strictSchemaErr != nil {
+			return
+		}
+		disallowAdditionalProperties(s)
+		strictSchema, strictSchemaErr = json.Marshal(s)
+	})
+	if strictSchemaErr != nil {
+		return strictSchemaErr
+	}
+	return validate(gojsonschema.NewBytesLoader(strictSchema), config)
+}
+
+// disallowAdditionalProperties sets `additionalProperties: false` on object definitions which don't set it
+func disallowAdditionalProperties(node interface{}) {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		_, hasProperties := node["properties"]
+		_, hasPatternProperties := node["patternProperties"]
+		if _, ok := node["additionalProperties"]; !ok && hasObjectType(node["type"]) && (hasProperties || hasPatternProperties) {
+			node["additionalProperties"] = false
+			if hasProperties {
+				patterns, _ := node["patternProperties"].(map[string]interface{})
+				if patterns == nil {
+					patterns = map[string]interface{}{}
+					node["patternProperties"] = patterns
+				}
+				if _, ok := patterns["^x-"]; !ok {
+					patterns["^x-"] = map[string]interface{}{}
+				}
+			}
+		}
+		for _, child := range node {
+			disallowAdditionalProperties(child)
+		}
+	case []interface{}:
+		for _, child := range node {
+			disallowAdditionalProperties(child)
+		}
+	}
+}
+
+func hasObjectType(t interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		return t == "object"
+	case []interface{}:
+		for _, item := range t {
+			if item == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func validate(schemaLoader gojsonschema.JSONLoader, config map[string]interface{}) error {
 	dataLoader := gojsonschema.NewGoLoader(config)
 
 	result, err := gojsonschema.Validate(schemaLoader, dataLoader)
@@ -129,6 +212,11 @@ func (err validationError) Error() string {
 	return fmt.Sprintf("%s %s", err.parent.Field(), description)
 }
 
+// Field returns the dotted path of the invalid attribute, like `services.web.ports.2`
+func (err validationError) Field() string {
+	return err.parent.Field()
+}
+
 func getMostSpecificError(errors []gojsonschema.ResultError) validationError {
 	mostSpecificError := 0
 	for i, err := range errors {
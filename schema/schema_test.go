@@ -17,6 +17,8 @@
 package schema
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 
 	"gotest.tools/v3/assert"
@@ -36,6 +38,19 @@ func TestValidate(t *testing.T) {
 	assert.NilError(t, Validate(config))
 }
 
+func TestJSON(t *testing.T) {
+	b, err := JSON()
+	assert.NilError(t, err)
+	var s dict
+	assert.NilError(t, json.Unmarshal(b, &s))
+	assert.Equal(t, s["title"], "Compose Specification")
+}
+
+func TestVersion(t *testing.T) {
+	assert.Check(t, strings.HasPrefix(Version(), "sha256:"))
+	assert.Equal(t, Version(), Version())
+}
+
 func TestValidateUndefinedTopLevelOption(t *testing.T) {
 	config := dict{
 		"helicopters": dict{
@@ -90,6 +105,33 @@ func TestValidateAllowsXFields(t *testing.T) {
 	assert.NilError(t, Validate(config))
 }
 
+func TestValidateStrict(t *testing.T) {
+	config := dict{
+		"services": dict{
+			"foo": dict{
+				"image": "busybox",
+				"x-foo": "bar",
+			},
+		},
+		"secrets": dict{
+			"bar": dict{
+				"external": dict{"name": "bar", "x-foo": "bar"},
+			},
+		},
+		"x-foo": "bar",
+	}
+	assert.NilError(t, Validate(config))
+	assert.NilError(t, ValidateStrict(config))
+
+	config["secrets"] = dict{
+		"bar": dict{
+			"external": dict{"nmae": "bar"},
+		},
+	}
+	assert.NilError(t, Validate(config))
+	assert.ErrorContains(t, ValidateStrict(config), "secrets.bar.external Additional property nmae is not allowed")
+}
+
 func TestValidateSecretConfigNames(t *testing.T) {
 	config := dict{
 		"configs": dict{
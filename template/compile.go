@@ -0,0 +1,198 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package template
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CompiledTemplate is a template parsed by Compile, which can be substituted repeatedly without parsing it again
+type CompiledTemplate struct {
+	template string
+	parts    []templatePart
+}
+
+// templatePart is either a literal string or, when expr is set, an expression to be evaluated
+type templatePart struct {
+	literal string
+	expr    *expression
+}
+
+// expression is a parsed `$VAR` or `${...}` expression
+type expression struct {
+	// name is the variable name, or the prefix of a `${prefix:reference}` expression
+	name     string
+	modifier string
+	// value is the default or presence value of the variable, or the error message when it's required
+	value *CompiledTemplate
+	// reference is set for `${prefix:reference}` expressions
+	reference *CompiledTemplate
+}
+
+// Compile parses the `${...}` structure of template once, so it can be substituted with many mappings.
+// Substituting a CompiledTemplate gives the same result as Substitute, an InvalidTemplateError is returned
+// by Compile if template is malformed
+func Compile(template string) (*CompiledTemplate, error) {
+	t := &CompiledTemplate{template: template}
+	pos := 0
+	for pos < len(template) {
+		loc := defaultPattern.FindStringIndex(template[pos:])
+		if loc == nil {
+			break
+		}
+		start := pos + loc[0]
+		substring := template[start : pos+loc[1]]
+		if closingBraceIndex := getFirstBraceClosingIndex(substring); closingBraceIndex > -1 {
+			substring = substring[:closingBraceIndex+1]
+		}
+		t.appendLiteral(template[pos:start])
+		pos = start + len(substring)
+
+		groups := matchGroups(defaultPattern.FindStringSubmatch(substring), defaultPattern)
+		if escaped := groups["escaped"]; escaped != "" {
+			t.appendLiteral(escaped)
+			continue
+		}
+		if named := groups["named"]; named != "" {
+			t.parts = append(t.parts, templatePart{expr: &expression{name: named}})
+			continue
+		}
+		braced := groups["braced"]
+		if braced == "" {
+			return nil, &InvalidTemplateError{Template: template}
+		}
+		expr, err := compileExpression(braced)
+		if err != nil {
+			return nil, err
+		}
+		t.parts = append(t.parts, templatePart{expr: expr})
+	}
+	t.appendLiteral(template[pos:])
+	return t, nil
+}
+
+func compileExpression(substitution string) (*expression, error) {
+	if prefix, reference, ok := cutReference(substitution); ok {
+		compiled, err := Compile(reference)
+		if err != nil {
+			return nil, err
+		}
+		return &expression{name: prefix, reference: compiled}, nil
+	}
+	name, modifier, value, ok := cutModifier(substitution)
+	if !ok {
+		return &expression{name: substitution}, nil
+	}
+	compiled, err := Compile(value)
+	if err != nil {
+		return nil, err
+	}
+	return &expression{name: name, modifier: modifier, value: compiled}, nil
+}
+
+func (t *CompiledTemplate) appendLiteral(s string) {
+	if s == "" {
+		return
+	}
+	if n := len(t.parts); n > 0 && t.parts[n-1].expr == nil {
+		t.parts[n-1].literal += s
+		return
+	}
+	t.parts = append(t.parts, templatePart{literal: s})
+}
+
+// String returns the source of the template
+func (t *CompiledTemplate) String() string {
+	return t.template
+}
+
+// Substitute variables in the template with their values, like Substitute does
+func (t *CompiledTemplate) Substitute(mapping Mapping) (string, error) {
+	if len(t.parts) == 1 && t.parts[0].expr == nil {
+		return t.parts[0].literal, nil
+	}
+	var b strings.Builder
+	for _, part := range t.parts {
+		if part.expr == nil {
+			b.WriteString(part.literal)
+			continue
+		}
+		value, err := part.expr.evaluate(t.template, mapping)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(value)
+	}
+	return b.String(), nil
+}
+
+func (e *expression) evaluate(template string, mapping Mapping) (string, error) {
+	if e.reference != nil {
+		// nested variables in the reference are substituted before it's resolved
+		reference, err := e.reference.Substitute(mapping)
+		if err != nil {
+			return "", err
+		}
+		value, ok := mapping(e.name + ":" + reference)
+		if !ok {
+			return "", &InvalidTemplateError{Template: template}
+		}
+		return value, nil
+	}
+
+	var value string
+	if e.value != nil {
+		v, err := e.value.Substitute(mapping)
+		if err != nil {
+			return "", err
+		}
+		value = v
+	}
+	current, ok := mapping(e.name)
+	switch e.modifier {
+	case ":-":
+		if !ok || current == "" {
+			return value, nil
+		}
+	case "-":
+		if !ok {
+			return value, nil
+		}
+	case ":+":
+		if ok && current != "" {
+			return value, nil
+		}
+	case "+":
+		if ok {
+			return value, nil
+		}
+	case ":?", "?":
+		if !ok || (e.modifier == ":?" && current == "") {
+			return "", &InvalidTemplateError{
+				Template: fmt.Sprintf("required variable %s is missing a value: %s", e.name, value),
+			}
+		}
+	default:
+		if !ok {
+			logrus.Warnf("The %q variable is not set. Defaulting to a blank string.", e.name)
+		}
+	}
+	return current, nil
+}
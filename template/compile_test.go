@@ -0,0 +1,120 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package template
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCompiledTemplateSubstitute(t *testing.T) {
+	templates := []string{
+		"",
+		"no variables",
+		"$$FOO and $${BAR}",
+		"$FOO-$BAR",
+		"${FOO}${UNSET}",
+		"ok ${UNSET:-default} ${BAR:-empty} ${BAR-unset} ${FOO:-foo}",
+		"ok ${FOO:+set} ${BAR:+non-empty} ${BAR+set} ${UNSET+set}",
+		"ok ${UNSET:-${FOO}} ${UNSET:-${UNSET2:-${FOO}}} tail",
+		"ok ${FOO:?required} ${BAR?required}",
+		"ok ${UNSET:-a-b:c?d} ${FOO}",
+		"${secret:db/${FOO}}",
+	}
+	mapping := func(name string) (string, bool) {
+		if name == "secret:db/first" {
+			return "s3cr3t", true
+		}
+		return defaultMapping(name)
+	}
+	for _, template := range templates {
+		t.Run(template, func(t *testing.T) {
+			expected, err := Substitute(template, mapping)
+			assert.NilError(t, err)
+			compiled, err := Compile(template)
+			assert.NilError(t, err)
+			actual, err := compiled.Substitute(mapping)
+			assert.NilError(t, err)
+			assert.Equal(t, actual, expected)
+
+			// a compiled template can be used with another mapping
+			other := func(name string) (string, bool) {
+				return "other-" + name, true
+			}
+			expected, err = Substitute(template, other)
+			assert.NilError(t, err)
+			actual, err = compiled.Substitute(other)
+			assert.NilError(t, err)
+			assert.Equal(t, actual, expected)
+		})
+	}
+}
+
+func TestCompiledTemplateErrors(t *testing.T) {
+	for _, template := range []string{"${", "${}", "${ }", "${ foo}", "${foo }", "${foo!}", "${U:-${}}"} {
+		_, err := Compile(template)
+		assert.ErrorType(t, err, reflect.TypeOf(&InvalidTemplateError{}), template)
+	}
+
+	compiled, err := Compile("not ok ${UNSET_VAR:?Mandatory Variable ${FOO}}")
+	assert.NilError(t, err)
+	_, err = compiled.Substitute(defaultMapping)
+	assert.Error(t, err, "Invalid template: \"required variable UNSET_VAR is missing a value: Mandatory Variable first\"")
+
+	compiled, err = Compile("${secret:db/password}")
+	assert.NilError(t, err)
+	_, err = compiled.Substitute(defaultMapping)
+	assert.ErrorType(t, err, reflect.TypeOf(&InvalidTemplateError{}))
+}
+
+var benchmarkTemplate = "postgres://${DB_USER:-admin}:${DB_PASSWORD:?password is required}@${DB_HOST}:${DB_PORT:-5432}/${DB_NAME:-${APP:-app}}"
+
+func benchmarkMapping(i int) Mapping {
+	env := map[string]string{
+		"DB_USER":     "user",
+		"DB_PASSWORD": fmt.Sprintf("password%d", i),
+		"DB_HOST":     "localhost",
+	}
+	return func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+}
+
+func BenchmarkSubstitute(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := Substitute(benchmarkTemplate, benchmarkMapping(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompiledTemplateSubstitute(b *testing.B) {
+	compiled, err := Compile(benchmarkTemplate)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := compiled.Substitute(benchmarkMapping(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
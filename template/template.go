@@ -28,7 +28,9 @@ import (
 var delimiter = "\\$"
 var substitutionNamed = "[_a-z][_a-z0-9]*"
 
-var substitutionBraced = "[_a-z][_a-z0-9]*(?::?[-+?](.*}|[^}]*))?"
+var substitutionBraced = "[_a-z][_a-z0-9]*:[^-+?}].*|[_a-z][_a-z0-9]*(?::?[-+?](.*}|[^}]*))?"
+
+var prefixedReference = regexp.MustCompile("(?i)^([_a-z][_a-z0-9]*):([^-+?].*)$")
 
 var patternString = fmt.Sprintf(
 	"%s(?i:(?P<escaped>%s)|(?P<named>%s)|{(?:(?P<braced>%s)}|(?P<invalid>)))",
@@ -53,6 +55,10 @@ func (e InvalidTemplateError) Error() string {
 // and the absence of a value.
 type Mapping func(string) (string, bool)
 
+// Resolver is a user-supplied function which resolves the reference of a `${prefix:reference}`
+// expression, like `db/password` in `${secret:db/password}`
+type Resolver func(reference string) (string, error)
+
 // SubstituteFunc is a user-supplied function that apply substitution.
 // Returns the value as a string, a bool indicating if the function could apply
 // the substitution and an error.
@@ -99,6 +105,32 @@ func SubstituteWith(template string, mapping Mapping, pattern *regexp.Regexp, su
 		}
 
 		if braced {
+			if prefix, reference, ok := cutReference(substitution); ok {
+				// nested variables in the reference are substituted before it's resolved
+				reference, err := SubstituteWith(reference, mapping, pattern)
+				if err != nil {
+					if returnErr == nil {
+						returnErr = err
+					}
+					return ""
+				}
+				value, ok := mapping(prefix + ":" + reference)
+				if !ok {
+					if returnErr == nil {
+						returnErr = &InvalidTemplateError{Template: template}
+					}
+					return ""
+				}
+				interpolatedNested, err := SubstituteWith(rest, mapping, pattern)
+				if err != nil {
+					if returnErr == nil {
+						returnErr = err
+					}
+					return ""
+				}
+				return value + interpolatedNested
+			}
+
 			var (
 				value   string
 				applied bool
@@ -178,6 +210,88 @@ func Substitute(template string, mapping Mapping) (string, error) {
 	return SubstituteWith(template, mapping, defaultPattern)
 }
 
+// SubstituteSingle evaluates a single `$VAR` or `${...}` expression, including default values, alternate values and
+// required modifiers. It also reports whether the variable referenced by expr is set in mapping; when it isn't,
+// the result comes from a default value or is blank. An InvalidTemplateError is returned if expr isn't
+// exactly one expression.
+func SubstituteSingle(expr string, mapping Mapping) (string, bool, error) {
+	loc := defaultPattern.FindStringIndex(expr)
+	if loc == nil || loc[0] != 0 {
+		return "", false, &InvalidTemplateError{Template: expr}
+	}
+	end := loc[1]
+	if closingBraceIndex := getFirstBraceClosingIndex(expr); closingBraceIndex > -1 {
+		end = closingBraceIndex + 1
+	}
+	if end != len(expr) {
+		return "", false, &InvalidTemplateError{Template: expr}
+	}
+
+	groups := matchGroups(defaultPattern.FindStringSubmatch(expr), defaultPattern)
+	name := groups["named"]
+	if name == "" {
+		name = groups["braced"]
+	}
+	if name == "" {
+		return "", false, &InvalidTemplateError{Template: expr}
+	}
+	_, _, prefixed := cutReference(name)
+	if !prefixed {
+		v, _ := parseVariable(name)
+		name = v.Name
+	}
+
+	found := false
+	lookup := func(key string) (string, bool) {
+		value, ok := mapping(key)
+		if ok && (prefixed || key == name) {
+			found = true
+		}
+		return value, ok
+	}
+	value, err := Substitute(expr, lookup)
+	if err != nil {
+		return "", false, err
+	}
+	return value, found, nil
+}
+
+// SubstituteWithResolvers substitutes variables in the string with their values, like Substitute.
+// A `${prefix:reference}` expression is resolved by the Resolver registered for `prefix:`, after nested
+// variables in reference have been substituted. Expressions without a registered prefix are looked up in mapping.
+func SubstituteWithResolvers(template string, mapping Mapping, resolvers map[string]Resolver) (string, error) {
+	var resolveErr error
+	lookup := func(key string) (string, bool) {
+		if prefix, reference, ok := cutReference(key); ok {
+			if resolver, ok := resolvers[prefix+":"]; ok {
+				value, err := resolver(reference)
+				if err != nil {
+					if resolveErr == nil {
+						resolveErr = fmt.Errorf("failed to resolve %s: %w", key, err)
+					}
+					return "", false
+				}
+				return value, true
+			}
+		}
+		return mapping(key)
+	}
+	result, err := SubstituteWith(template, lookup, defaultPattern)
+	if resolveErr != nil {
+		return "", resolveErr
+	}
+	return result, err
+}
+
+// cutReference splits a `prefix:reference` expression
+func cutReference(substitution string) (string, string, bool) {
+	matches := prefixedReference.FindStringSubmatch(substitution)
+	if matches == nil {
+		return "", "", false
+	}
+	return matches[1], matches[2], true
+}
+
 // ExtractVariables returns a map of all the variables defined in the specified
 // composefile (dict representation) and their default value if any.
 func ExtractVariables(configDict map[string]interface{}, pattern *regexp.Regexp) map[string]Variable {
@@ -223,6 +337,60 @@ type Variable struct {
 	DefaultValue  string
 	PresenceValue string
 	Required      bool
+	// Offset is the byte offset of the variable reference in the input string.
+	// Only set by ExtractVariablesFromString
+	Offset int
+}
+
+// ExtractVariablesFromString returns all the variables referenced by the input string, in order of appearance,
+// including the ones nested in default or presence values, like `BAR` in `${FOO:-${BAR}}`
+func ExtractVariablesFromString(input string, pattern *regexp.Regexp) []Variable {
+	if pattern == nil {
+		pattern = defaultPattern
+	}
+	return extractVariablesAt(input, 0, pattern)
+}
+
+func extractVariablesAt(input string, offset int, pattern *regexp.Regexp) []Variable {
+	var values []Variable
+	pos := 0
+	for pos < len(input) {
+		loc := pattern.FindStringIndex(input[pos:])
+		if loc == nil {
+			break
+		}
+		start := pos + loc[0]
+		substring := input[start : pos+loc[1]]
+		if closingBraceIndex := getFirstBraceClosingIndex(substring); closingBraceIndex > -1 {
+			substring = substring[:closingBraceIndex+1]
+		}
+		pos = start + len(substring)
+
+		groups := matchGroups(pattern.FindStringSubmatch(substring), pattern)
+		if escaped := groups["escaped"]; escaped != "" {
+			continue
+		}
+		val := groups["named"]
+		if val == "" {
+			val = groups["braced"]
+		}
+		if val == "" {
+			continue
+		}
+		if prefix, reference, ok := cutReference(val); ok {
+			// not a variable, but the reference may contain some
+			values = append(values, extractVariablesAt(reference, offset+start+2+len(prefix)+1, pattern)...)
+			continue
+		}
+		v, valueIndex := parseVariable(val)
+		v.Offset = offset + start
+		values = append(values, v)
+		if valueIndex >= 0 {
+			// skip `${` to locate the nested value in input
+			values = append(values, extractVariablesAt(val[valueIndex:], v.Offset+2+valueIndex, pattern)...)
+		}
+	}
+	return values
 }
 
 func extractVariable(value interface{}, pattern *regexp.Regexp) ([]Variable, bool) {
@@ -244,36 +412,57 @@ func extractVariable(value interface{}, pattern *regexp.Regexp) ([]Variable, boo
 		if val == "" {
 			val = groups["braced"]
 		}
-		name := val
-		var defaultValue string
-		var presenceValue string
-		var required bool
-		switch {
-		case strings.Contains(val, ":?"):
-			name, _ = partition(val, ":?")
-			required = true
-		case strings.Contains(val, "?"):
-			name, _ = partition(val, "?")
-			required = true
-		case strings.Contains(val, ":-"):
-			name, defaultValue = partition(val, ":-")
-		case strings.Contains(val, "-"):
-			name, defaultValue = partition(val, "-")
-		case strings.Contains(val, ":+"):
-			name, presenceValue = partition(val, ":+")
-		case strings.Contains(val, "+"):
-			name, presenceValue = partition(val, "+")
+		if prefix, _, ok := cutReference(val); ok {
+			// not a variable, but the reference and what follows may contain some
+			for _, v := range extractVariablesAt(match[0][len("${"+prefix+":"):], 0, pattern) {
+				v.Offset = 0
+				values = append(values, v)
+			}
+			continue
 		}
-		values = append(values, Variable{
-			Name:          name,
-			DefaultValue:  defaultValue,
-			PresenceValue: presenceValue,
-			Required:      required,
-		})
+		v, _ := parseVariable(val)
+		values = append(values, v)
 	}
 	return values, len(values) > 0
 }
 
+// parseVariable parses a variable expression, without delimiters, into a Variable. It also returns the index
+// of the default or presence value in val, or -1 if there's none
+func parseVariable(val string) (Variable, int) {
+	name, sep, value, ok := cutModifier(val)
+	if !ok {
+		return Variable{Name: val}, -1
+	}
+
+	valueIndex := len(name) + len(sep)
+	v := Variable{Name: name}
+	switch sep {
+	case ":?", "?":
+		v.Required = true
+		valueIndex = -1
+	case ":-", "-":
+		v.DefaultValue = value
+	case ":+", "+":
+		v.PresenceValue = value
+	}
+	return v, valueIndex
+}
+
+// cutModifier splits a variable expression, without delimiters, around its modifier. The first modifier found
+// applies, others may belong to a nested expression
+func cutModifier(val string) (name string, modifier string, value string, found bool) {
+	sepIndex := -1
+	for _, m := range []string{":?", "?", ":-", "-", ":+", "+"} {
+		if i := strings.Index(val, m); i >= 0 && (sepIndex < 0 || i < sepIndex) {
+			modifier, sepIndex = m, i
+		}
+	}
+	if sepIndex < 0 {
+		return val, "", "", false
+	}
+	return val[:sepIndex], modifier, val[sepIndex+len(modifier):], true
+}
+
 // Soft default (fall back if unset or empty)
 func defaultWhenEmptyOrUnset(substitution string, mapping Mapping) (string, bool, error) {
 	return withDefaultWhenAbsence(substitution, mapping, true)
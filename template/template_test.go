@@ -377,6 +377,91 @@ func TestSubstituteWithCustomFunc(t *testing.T) {
 	assert.Check(t, is.ErrorContains(err, "required variable"))
 }
 
+func TestSubstituteWithResolvers(t *testing.T) {
+	resolvers := map[string]Resolver{
+		"secret:": func(reference string) (string, error) {
+			if reference == "broken" {
+				return "", fmt.Errorf("vault is sealed")
+			}
+			return "secret(" + reference + ")", nil
+		},
+		"file:": func(reference string) (string, error) {
+			return "file(" + reference + ")", nil
+		},
+	}
+
+	testCases := []struct {
+		template string
+		expected string
+	}{
+		{template: "${secret:db/password}", expected: "secret(db/password)"},
+		{template: "${file:/etc/hostname} and ${secret:api-key}", expected: "file(/etc/hostname) and secret(api-key)"},
+		{template: "${secret:${FOO}/password}", expected: "secret(first/password)"},
+		{template: "${secret:${file:${FOO}}}", expected: "secret(file(first))"},
+		{template: "${UNSET:-${secret:fallback}}", expected: "secret(fallback)"},
+		{template: "${FOO:-${secret:fallback}}", expected: "first"},
+		{template: "${FOO} $${secret:escaped}", expected: "first ${secret:escaped}"},
+	}
+	for _, tc := range testCases {
+		result, err := SubstituteWithResolvers(tc.template, defaultMapping, resolvers)
+		assert.NilError(t, err, tc.template)
+		assert.Check(t, is.Equal(tc.expected, result), tc.template)
+	}
+
+	_, err := SubstituteWithResolvers("${secret:broken}", defaultMapping, resolvers)
+	assert.ErrorContains(t, err, "failed to resolve secret:broken: vault is sealed")
+
+	_, err = SubstituteWithResolvers("${unknown:value}", defaultMapping, resolvers)
+	assert.Check(t, is.ErrorType(err, &InvalidTemplateError{}))
+
+	// without resolvers, prefixed expressions are still invalid
+	_, err = Substitute("${secret:db/password}", defaultMapping)
+	assert.Check(t, is.ErrorType(err, &InvalidTemplateError{}))
+
+	// prefixed expressions are not variables, but may reference some
+	variables := ExtractVariables(map[string]interface{}{
+		"password": "${secret:${TENANT}/password} ${SUFFIX}",
+	}, defaultPattern)
+	assert.Check(t, is.DeepEqual(map[string]Variable{
+		"TENANT": {Name: "TENANT"},
+		"SUFFIX": {Name: "SUFFIX"},
+	}, variables))
+}
+
+func TestSubstituteSingle(t *testing.T) {
+	testCases := []struct {
+		expr        string
+		expected    string
+		substituted bool
+	}{
+		{expr: "$FOO", expected: "first", substituted: true},
+		{expr: "${FOO}", expected: "first", substituted: true},
+		{expr: "${BAR}", expected: "", substituted: true},
+		{expr: "${UNSET}", expected: "", substituted: false},
+		{expr: "${UNSET:-default}", expected: "default", substituted: false},
+		{expr: "${BAR:-default}", expected: "default", substituted: true},
+		{expr: "${BAR-default}", expected: "", substituted: true},
+		{expr: "${FOO:+alternate}", expected: "alternate", substituted: true},
+		{expr: "${UNSET+alternate}", expected: "", substituted: false},
+		{expr: "${UNSET:-${FOO}}", expected: "first", substituted: false},
+		{expr: "${FOO?required}", expected: "first", substituted: true},
+	}
+	for _, tc := range testCases {
+		result, substituted, err := SubstituteSingle(tc.expr, defaultMapping)
+		assert.NilError(t, err, tc.expr)
+		assert.Check(t, is.Equal(tc.expected, result), tc.expr)
+		assert.Check(t, is.Equal(tc.substituted, substituted), tc.expr)
+	}
+
+	_, _, err := SubstituteSingle("${UNSET:?must be set}", defaultMapping)
+	assert.ErrorContains(t, err, "must be set")
+
+	for _, expr := range []string{"", "FOO", "$$FOO", "${FOO} ${BAR}", "prefix ${FOO}", "${FOO}suffix", "${"} {
+		_, _, err := SubstituteSingle(expr, defaultMapping)
+		assert.Check(t, is.ErrorType(err, &InvalidTemplateError{}), expr)
+	}
+}
+
 // TestPrecedence tests is the precedence on '-' and '?' is of the first match
 func TestPrecedence(t *testing.T) {
 
@@ -541,6 +626,64 @@ func TestExtractVariables(t *testing.T) {
 	}
 }
 
+func TestExtractVariablesFromString(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected []Variable
+	}{
+		{
+			name:  "no-variables",
+			input: "foo",
+		},
+		{
+			name:  "escaped",
+			input: "$$foo",
+		},
+		{
+			name:  "named-and-braced",
+			input: "$foo and ${bar}",
+			expected: []Variable{
+				{Name: "foo", Offset: 0},
+				{Name: "bar", Offset: 9},
+			},
+		},
+		{
+			name:  "modifiers",
+			input: "${foo:-x} ${bar?err} ${baz:+y}",
+			expected: []Variable{
+				{Name: "foo", DefaultValue: "x", Offset: 0},
+				{Name: "bar", Required: true, Offset: 10},
+				{Name: "baz", PresenceValue: "y", Offset: 21},
+			},
+		},
+		{
+			name:  "nested",
+			input: "x=${FOO:-${BAR}} ${BAZ}",
+			expected: []Variable{
+				{Name: "FOO", DefaultValue: "${BAR}", Offset: 2},
+				{Name: "BAR", Offset: 9},
+				{Name: "BAZ", Offset: 17},
+			},
+		},
+		{
+			name:  "nested-required",
+			input: "${FOO-${BAR:?missing}}",
+			expected: []Variable{
+				{Name: "FOO", DefaultValue: "${BAR:?missing}", Offset: 0},
+				{Name: "BAR", Required: true, Offset: 6},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			actual := ExtractVariablesFromString(tc.input, nil)
+			assert.Check(t, is.DeepEqual(actual, tc.expected))
+		})
+	}
+}
+
 func TestSubstitutionFunctionChoice(t *testing.T) {
 	testcases := []struct {
 		name   string
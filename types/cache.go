@@ -0,0 +1,120 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package types
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// CacheTypeRegistry stores the build cache in an image registry, at `ref`
+	CacheTypeRegistry = "registry"
+	// CacheTypeLocal stores the build cache in a local directory, `src` to import from and `dest` to export to
+	CacheTypeLocal = "local"
+	// CacheTypeGHA stores the build cache in the GitHub Actions cache
+	CacheTypeGHA = "gha"
+	// CacheTypeInline embeds the build cache into the built image
+	CacheTypeInline = "inline"
+	// CacheTypeS3 stores the build cache in an AWS S3 bucket
+	CacheTypeS3 = "s3"
+)
+
+// CacheOptions is the parsed form of a `build.cache_from` or `build.cache_to` entry, either an image reference or
+// a comma separated list of `key=value` parameters like `type=local,src=path/to/cache`
+type CacheOptions struct {
+	Type string
+	// Params are the parameters of the cache, other than `type`
+	Params map[string]string
+}
+
+// ParseCacheOptions parses a `build.cache_from` or `build.cache_to` entry. An image reference is parsed as a
+// registry cache, as is an entry without a `type`. A registry cache requires a `ref`. Other types, like `local` or
+// types supported by a specific builder such as `azblob`, are not validated
+func ParseCacheOptions(cache string) (CacheOptions, error) {
+	if !strings.Contains(cache, "=") {
+		return CacheOptions{Type: CacheTypeRegistry, Params: map[string]string{"ref": cache}}, nil
+	}
+	r := csv.NewReader(strings.NewReader(cache))
+	fields, err := r.Read()
+	if err != nil {
+		return CacheOptions{}, fmt.Errorf("invalid cache %q: %w", cache, err)
+	}
+	o := CacheOptions{Params: map[string]string{}}
+	for _, field := range fields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || key == "" {
+			return CacheOptions{}, fmt.Errorf("invalid cache %q, %q is not a key=value parameter", cache, field)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "type" {
+			o.Type = value
+			continue
+		}
+		o.Params[key] = value
+	}
+	if o.Type == "" {
+		o.Type = CacheTypeRegistry
+	}
+	if o.Type == CacheTypeRegistry && o.Params["ref"] == "" {
+		return CacheOptions{}, fmt.Errorf("invalid cache %q, %s cache requires a ref", cache, CacheTypeRegistry)
+	}
+	return o, nil
+}
+
+// String returns the `key=value` form of the cache, with `type` first and the other parameters sorted by key
+func (o CacheOptions) String() string {
+	keys := make([]string, 0, len(o.Params))
+	for key := range o.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fields := []string{"type=" + o.Type}
+	for _, key := range keys {
+		fields = append(fields, key+"="+o.Params[key])
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write(fields)
+	w.Flush()
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// CacheFromOptions parses the `cache_from` entries of the build
+func (b BuildConfig) CacheFromOptions() ([]CacheOptions, error) {
+	return parseCacheOptions(b.CacheFrom)
+}
+
+// CacheToOptions parses the `cache_to` entries of the build
+func (b BuildConfig) CacheToOptions() ([]CacheOptions, error) {
+	return parseCacheOptions(b.CacheTo)
+}
+
+func parseCacheOptions(entries []string) ([]CacheOptions, error) {
+	var caches []CacheOptions
+	for _, entry := range entries {
+		o, err := ParseCacheOptions(entry)
+		if err != nil {
+			return nil, err
+		}
+		caches = append(caches, o)
+	}
+	return caches, nil
+}
@@ -0,0 +1,92 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseCacheOptions(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected CacheOptions
+		str      string
+		err      string
+	}{
+		{
+			value:    "registry.example.com/app:cache",
+			expected: CacheOptions{Type: CacheTypeRegistry, Params: map[string]string{"ref": "registry.example.com/app:cache"}},
+			str:      "type=registry,ref=registry.example.com/app:cache",
+		},
+		{
+			value:    "type=registry,ref=user/app:cache,mode=max",
+			expected: CacheOptions{Type: CacheTypeRegistry, Params: map[string]string{"ref": "user/app:cache", "mode": "max"}},
+			str:      "type=registry,mode=max,ref=user/app:cache",
+		},
+		{
+			value:    "ref=user/app:cache",
+			expected: CacheOptions{Type: CacheTypeRegistry, Params: map[string]string{"ref": "user/app:cache"}},
+			str:      "type=registry,ref=user/app:cache",
+		},
+		{
+			value:    "type=local,src=path/to/cache",
+			expected: CacheOptions{Type: CacheTypeLocal, Params: map[string]string{"src": "path/to/cache"}},
+		},
+		{
+			value:    "type=gha,scope=main",
+			expected: CacheOptions{Type: CacheTypeGHA, Params: map[string]string{"scope": "main"}},
+		},
+		{
+			value:    "type=inline",
+			expected: CacheOptions{Type: CacheTypeInline, Params: map[string]string{}},
+		},
+		{
+			value:    `type=s3,region=eu-west-1,bucket=cache,"name=a,b"`,
+			expected: CacheOptions{Type: CacheTypeS3, Params: map[string]string{"region": "eu-west-1", "bucket": "cache", "name": "a,b"}},
+			str:      `type=s3,bucket=cache,"name=a,b",region=eu-west-1`,
+		},
+		{
+			value:    "type=azblob,name=cache,account_url=https://example.blob.core.windows.net",
+			expected: CacheOptions{Type: "azblob", Params: map[string]string{"name": "cache", "account_url": "https://example.blob.core.windows.net"}},
+			str:      "type=azblob,account_url=https://example.blob.core.windows.net,name=cache",
+		},
+		{value: "type=registry", err: `invalid cache "type=registry", registry cache requires a ref`},
+		{value: "type=local,src", err: `invalid cache "type=local,src", "src" is not a key=value parameter`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			cache, err := ParseCacheOptions(tc.value)
+			if tc.err != "" {
+				assert.Error(t, err, tc.err)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, cache, tc.expected)
+			str := tc.str
+			if str == "" {
+				str = tc.value
+			}
+			assert.Equal(t, cache.String(), str)
+
+			roundTrip, err := ParseCacheOptions(cache.String())
+			assert.NilError(t, err)
+			assert.DeepEqual(t, roundTrip, cache)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestClone(t *testing.T) {
+	replicas := uint64(2)
+	value := "value"
+	original := &Project{
+		Name: "clone",
+		Services: Services{
+			{
+				Name: "web",
+				Build: &BuildConfig{
+					Context: ".",
+					Args:    MappingWithEquals{"ARG": &value},
+				},
+				Deploy:     &DeployConfig{Replicas: &replicas},
+				Networks:   map[string]*ServiceNetworkConfig{"front": {Aliases: []string{"www"}}},
+				Ports:      []ServicePortConfig{{Target: 80, Published: "8080"}},
+				Extensions: Extensions{"x-meta": map[string]interface{}{"owner": "team"}},
+			},
+		},
+		Networks:   Networks{"front": {Labels: Labels{"tier": "front"}}},
+		Volumes:    Volumes{"data": {DriverOpts: map[string]string{"type": "tmpfs"}}},
+		Extensions: Extensions{"x-list": []interface{}{"a"}},
+	}
+	clone := original.Clone()
+	assert.DeepEqual(t, clone, original)
+
+	web := &clone.Services[0]
+	web.Name = "api"
+	other := "other"
+	*web.Build.Args["ARG"] = other
+	web.Build.Args["NEW"] = &other
+	*web.Deploy.Replicas = 5
+	web.Networks["front"].Aliases[0] = "api"
+	web.Ports[0].Published = "9090"
+	web.Extensions["x-meta"].(map[string]interface{})["owner"] = "other"
+	clone.Networks["front"].Labels["tier"] = "back"
+	clone.Volumes["data"].DriverOpts["type"] = "nfs"
+	clone.Extensions["x-list"].([]interface{})[0] = "b"
+	clone.Services = append(clone.Services, ServiceConfig{Name: "db"})
+
+	assert.Equal(t, len(original.Services), 1)
+	s := original.Services[0]
+	assert.Equal(t, s.Name, "web")
+	assert.Equal(t, *s.Build.Args["ARG"], "value")
+	assert.Equal(t, len(s.Build.Args), 1)
+	assert.Equal(t, *s.Deploy.Replicas, uint64(2))
+	assert.Equal(t, s.Networks["front"].Aliases[0], "www")
+	assert.Equal(t, s.Ports[0].Published, "8080")
+	assert.Equal(t, s.Extensions["x-meta"].(map[string]interface{})["owner"], "team")
+	assert.Equal(t, original.Networks["front"].Labels["tier"], "front")
+	assert.Equal(t, original.Volumes["data"].DriverOpts["type"], "tmpfs")
+	assert.Equal(t, original.Extensions["x-list"].([]interface{})[0], "a")
+
+	assert.Check(t, (*Project)(nil).Clone() == nil)
+}
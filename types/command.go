@@ -0,0 +1,113 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CommandForm is the form a service `command` or `entrypoint` is declared with
+type CommandForm string
+
+const (
+	// CommandFormExec is a list of arguments, passed as-is to the container runtime
+	CommandFormExec CommandForm = "exec"
+	// CommandFormShell is a string, split into arguments the way a POSIX shell splits words
+	CommandFormShell CommandForm = "shell"
+)
+
+// CommandArgs returns the arguments of the service command. A command declared in shell form has
+// been split into words by ParseShellCommand
+func (s ServiceConfig) CommandArgs() []string {
+	return append([]string(nil), s.Command...)
+}
+
+// EntrypointArgs returns the arguments of the service entrypoint. An entrypoint declared in shell form has
+// been split into words by ParseShellCommand
+func (s ServiceConfig) EntrypointArgs() []string {
+	return append([]string(nil), s.Entrypoint...)
+}
+
+// ParseShellCommand splits a command in shell form into arguments, following the POSIX shell rules for
+// quoting: words are separated by blanks, single quotes preserve every character, an unquoted backslash escapes
+// the next character, and double quotes preserve blanks while a backslash still escapes a dollar sign, backtick,
+// double quote, backslash or newline. Variables, globs, comments and operators like `;` or `|` are not
+// interpreted, they're kept as part of the words
+func ParseShellCommand(command string) (ShellCommand, error) {
+	args := ShellCommand{}
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\\':
+			inWord = true
+			if i+1 == len(command) {
+				word.WriteByte(c)
+				continue
+			}
+			i++
+			if command[i] != '\n' {
+				// backslash-newline is a line continuation
+				word.WriteByte(command[i])
+			}
+		case c == '\'':
+			inWord = true
+			end := strings.IndexByte(command[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid command %q: unterminated single quote", command)
+			}
+			word.WriteString(command[i+1 : i+1+end])
+			i += end + 1
+		case c == '"':
+			inWord = true
+			closed := false
+			for i++; i < len(command); i++ {
+				c := command[i]
+				if c == '"' {
+					closed = true
+					break
+				}
+				if c == '\\' && i+1 < len(command) && strings.IndexByte("$`\"\\\n", command[i+1]) >= 0 {
+					i++
+					if command[i] != '\n' {
+						word.WriteByte(command[i])
+					}
+					continue
+				}
+				word.WriteByte(c)
+			}
+			if !closed {
+				return nil, fmt.Errorf("invalid command %q: unterminated double quote", command)
+			}
+		default:
+			inWord = true
+			word.WriteByte(c)
+		}
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
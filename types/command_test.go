@@ -0,0 +1,70 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseShellCommand(t *testing.T) {
+	testCases := []struct {
+		command  string
+		expected ShellCommand
+		err      string
+	}{
+		{command: "", expected: ShellCommand{}},
+		{command: "  ", expected: ShellCommand{}},
+		{command: "echo hi", expected: ShellCommand{"echo", "hi"}},
+		{command: " a \t b\nc ", expected: ShellCommand{"a", "b", "c"}},
+		{command: `sh -c "echo hi"`, expected: ShellCommand{"sh", "-c", "echo hi"}},
+		{command: `sh -c 'echo "$HOME" && ls'`, expected: ShellCommand{"sh", "-c", `echo "$HOME" && ls`}},
+		{command: `echo "a\b" "\$x \"q\" \\"`, expected: ShellCommand{"echo", `a\b`, `$x "q" \`}},
+		{command: `echo 'a\b' a\ b \'`, expected: ShellCommand{"echo", `a\b`, "a b", "'"}},
+		{command: `echo "" '' x""y`, expected: ShellCommand{"echo", "", "", "xy"}},
+		{command: "echo a\\\nb", expected: ShellCommand{"echo", "ab"}},
+		{command: `echo foo;ls | grep $X # not a comment`, expected: ShellCommand{"echo", "foo;ls", "|", "grep", "$X", "#", "not", "a", "comment"}},
+		{command: `echo trailing\`, expected: ShellCommand{"echo", `trailing\`}},
+		{command: `echo "unterminated`, err: `invalid command "echo \"unterminated": unterminated double quote`},
+		{command: `echo 'unterminated`, err: `invalid command "echo 'unterminated": unterminated single quote`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.command, func(t *testing.T) {
+			args, err := ParseShellCommand(tc.command)
+			if tc.err != "" {
+				assert.Error(t, err, tc.err)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, args, tc.expected)
+		})
+	}
+}
+
+func TestCommandArgs(t *testing.T) {
+	s := ServiceConfig{
+		Command:    ShellCommand{"sh", "-c", "echo hi"},
+		Entrypoint: ShellCommand{"/entrypoint.sh"},
+	}
+	args := s.CommandArgs()
+	assert.DeepEqual(t, args, []string{"sh", "-c", "echo hi"})
+	args[0] = "bash"
+	assert.Equal(t, s.Command[0], "sh")
+	assert.DeepEqual(t, s.EntrypointArgs(), []string{"/entrypoint.sh"})
+	assert.Check(t, ServiceConfig{}.CommandArgs() == nil)
+}
@@ -65,6 +65,10 @@ type ConfigFile struct {
 	Content []byte
 	// Config if the yaml tree for this config file. Will be parsed from Content if not set
 	Config map[string]interface{}
+	// BaseDir is the directory relative paths declared by this file are resolved from, in place of the
+	// working directory. It is used as a virtual location by in-memory files: a file set with Content can be
+	// included or extended by the other config files, using its Filename relative to BaseDir
+	BaseDir string
 }
 
 // Config is a full compose file configuration and model
@@ -118,6 +122,7 @@ func (c Config) MarshalJSON() ([]byte, error) {
 	return json.Marshal(m)
 }
 
+// Get decodes the extension name into target, and reports whether the extension is set
 func (e Extensions) Get(name string, target interface{}) (bool, error) {
 	if v, ok := e[name]; ok {
 		err := mapstructure.Decode(v, target)
@@ -125,3 +130,11 @@ func (e Extensions) Get(name string, target interface{}) (bool, error) {
 	}
 	return false, nil
 }
+
+// GetExtension decodes the extension name into a value of type T, like a struct with `mapstructure` tags, and
+// reports whether the extension is set. As Go methods can't have type parameters, this is a function
+func GetExtension[T any](e Extensions, name string) (T, bool, error) {
+	var target T
+	ok, err := e.Get(name, &target)
+	return target, ok, err
+}
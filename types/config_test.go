@@ -152,3 +152,36 @@ func Test_LookupEnv(t *testing.T) {
 		})
 	}
 }
+
+func TestGetExtension(t *testing.T) {
+	type team struct {
+		Name    string
+		Oncall  []string
+		Private bool `mapstructure:"private"`
+	}
+	e := Extensions{
+		"x-myteam-owner": map[string]interface{}{
+			"name":    "infra",
+			"oncall":  []interface{}{"alice", "bob"},
+			"private": true,
+		},
+		"x-myteam-tier": "gold",
+	}
+
+	owner, ok, err := GetExtension[team](e, "x-myteam-owner")
+	assert.NilError(t, err)
+	assert.Check(t, ok)
+	assert.DeepEqual(t, owner, team{Name: "infra", Oncall: []string{"alice", "bob"}, Private: true})
+
+	tier, ok, err := GetExtension[string](e, "x-myteam-tier")
+	assert.NilError(t, err)
+	assert.Check(t, ok)
+	assert.Equal(t, tier, "gold")
+
+	_, ok, err = GetExtension[team](e, "x-myteam-missing")
+	assert.NilError(t, err)
+	assert.Check(t, !ok)
+
+	_, _, err = GetExtension[int](e, "x-myteam-tier")
+	assert.Check(t, err != nil)
+}
@@ -0,0 +1,128 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ChangeKind is the kind of a Change between two projects
+type ChangeKind string
+
+const (
+	// ChangeAdded is an attribute only set by the new project
+	ChangeAdded ChangeKind = "added"
+	// ChangeRemoved is an attribute only set by the old project
+	ChangeRemoved ChangeKind = "removed"
+	// ChangeModified is an attribute set by both projects, with distinct values
+	ChangeModified ChangeKind = "modified"
+)
+
+// Change is a difference between two projects
+type Change struct {
+	// Path is the YAML path of the changed attribute, like `services.web.ports[0]`
+	Path string
+	Kind ChangeKind
+	// Old is the value in the old project, or nil if the attribute was added
+	Old interface{}
+	// New is the value in the new project, or nil if the attribute was removed
+	New interface{}
+}
+
+// DiffProjects reports the changes from project a to project b, sorted by path. Projects are compared
+// as they are serialized to YAML, so attributes without a value are ignored.
+func DiffProjects(a, b *Project) ([]Change, error) {
+	before, err := toYAMLValue(a)
+	if err != nil {
+		return nil, err
+	}
+	after, err := toYAMLValue(b)
+	if err != nil {
+		return nil, err
+	}
+	var changes []Change
+	diffValues("", before, after, &changes)
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// toYAMLValue converts a project to generic maps and slices, as seen in its YAML serialization
+func toYAMLValue(p *Project) (interface{}, error) {
+	if p == nil {
+		return map[string]interface{}{}, nil
+	}
+	b, err := yaml.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	err = yaml.Unmarshal(b, &v)
+	return v, err
+}
+
+func diffValues(path string, before, after interface{}, changes *[]Change) {
+	switch before := before.(type) {
+	case map[string]interface{}:
+		if after, ok := after.(map[string]interface{}); ok {
+			for k, o := range before {
+				p := k
+				if path != "" {
+					p = path + "." + k
+				}
+				if n, ok := after[k]; ok {
+					diffValues(p, o, n, changes)
+				} else {
+					*changes = append(*changes, Change{Path: p, Kind: ChangeRemoved, Old: o})
+				}
+			}
+			for k, n := range after {
+				if _, ok := before[k]; !ok {
+					p := k
+					if path != "" {
+						p = path + "." + k
+					}
+					*changes = append(*changes, Change{Path: p, Kind: ChangeAdded, New: n})
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if after, ok := after.([]interface{}); ok {
+			for i := 0; i < len(before) || i < len(after); i++ {
+				p := fmt.Sprintf("%s[%d]", path, i)
+				switch {
+				case i >= len(after):
+					*changes = append(*changes, Change{Path: p, Kind: ChangeRemoved, Old: before[i]})
+				case i >= len(before):
+					*changes = append(*changes, Change{Path: p, Kind: ChangeAdded, New: after[i]})
+				default:
+					diffValues(p, before[i], after[i], changes)
+				}
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(before, after) {
+		*changes = append(*changes, Change{Path: path, Kind: ChangeModified, Old: before, New: after})
+	}
+}
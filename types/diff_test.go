@@ -0,0 +1,73 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDiffProjects(t *testing.T) {
+	before := &Project{
+		Name: "test",
+		Services: Services{
+			{
+				Name:        "web",
+				Image:       "nginx:1.24",
+				Environment: NewMappingWithEquals([]string{"MODE=dev", "DEBUG=1"}),
+				Ports:       []ServicePortConfig{{Target: 80, Published: "8080"}},
+			},
+			{Name: "worker", Image: "worker"},
+		},
+		Networks: Networks{"front": NetworkConfig{}},
+	}
+	after := &Project{
+		Name: "test",
+		Services: Services{
+			{
+				Name:        "web",
+				Image:       "nginx:1.25",
+				Environment: NewMappingWithEquals([]string{"MODE=prod", "LOG=info"}),
+				Ports:       []ServicePortConfig{{Target: 80, Published: "8080"}, {Target: 443, Published: "8443"}},
+			},
+			{Name: "db", Image: "postgres"},
+		},
+		Networks: Networks{"front": NetworkConfig{Driver: "overlay"}},
+		Volumes:  Volumes{"data": VolumeConfig{}},
+	}
+
+	changes, err := DiffProjects(before, after)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, changes, []Change{
+		{Path: "networks.front.driver", Kind: ChangeAdded, New: "overlay"},
+		{Path: "services.db", Kind: ChangeAdded, New: map[string]interface{}{"image": "postgres"}},
+		{Path: "services.web.environment.DEBUG", Kind: ChangeRemoved, Old: "1"},
+		{Path: "services.web.environment.LOG", Kind: ChangeAdded, New: "info"},
+		{Path: "services.web.environment.MODE", Kind: ChangeModified, Old: "dev", New: "prod"},
+		{Path: "services.web.image", Kind: ChangeModified, Old: "nginx:1.24", New: "nginx:1.25"},
+		{Path: "services.web.ports[1]", Kind: ChangeAdded, New: map[string]interface{}{
+			"target": 443, "published": "8443",
+		}},
+		{Path: "services.worker", Kind: ChangeRemoved, Old: map[string]interface{}{"image": "worker"}},
+		{Path: "volumes", Kind: ChangeAdded, New: map[string]interface{}{"data": map[string]interface{}{}}},
+	})
+
+	changes, err = DiffProjects(after, after)
+	assert.NilError(t, err)
+	assert.Equal(t, len(changes), 0)
+}
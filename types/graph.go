@@ -0,0 +1,271 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Graph is the dependency graph of a project's services
+type Graph struct {
+	// dependencies maps a service name to the sorted names of the services it depends on
+	dependencies map[string][]string
+}
+
+// DependencyKind is the attribute a dependency between services is declared by
+type DependencyKind string
+
+const (
+	DependencyDependsOn   DependencyKind = "depends_on"
+	DependencyLinks       DependencyKind = "links"
+	DependencyNetworkMode DependencyKind = "network_mode"
+	DependencyIpc         DependencyKind = "ipc"
+	DependencyPid         DependencyKind = "pid"
+	DependencyUts         DependencyKind = "uts"
+	DependencyCgroup      DependencyKind = "cgroup"
+	DependencyVolumesFrom DependencyKind = "volumes_from"
+)
+
+// Dependency is an edge of the dependency graph, service From depending on service To
+type Dependency struct {
+	From string
+	To   string
+	Kind DependencyKind
+	// Optional is set for a `depends_on` dependency with `required: false`, which can be undefined
+	Optional bool
+}
+
+// Dependencies lists the dependencies between the project's services, declared by `depends_on`, `links`,
+// `service:` namespaces like `network_mode` and `volumes_from`, in services order
+func (p *Project) Dependencies() []Dependency {
+	var dependencies []Dependency
+	for _, s := range p.Services {
+		dependencies = append(dependencies, s.DependencyEdges()...)
+	}
+	return dependencies
+}
+
+// DependencyEdges lists the services this service depends on, along with the attribute declaring the dependency
+func (s ServiceConfig) DependencyEdges() []Dependency {
+	var dependencies []Dependency
+	names := make([]string, 0, len(s.DependsOn))
+	for name := range s.DependsOn {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		dependencies = append(dependencies, Dependency{From: s.Name, To: name, Kind: DependencyDependsOn, Optional: !s.DependsOn[name].IsRequired()})
+	}
+	for _, link := range s.Links {
+		name, _, _ := strings.Cut(link, ":")
+		dependencies = append(dependencies, Dependency{From: s.Name, To: name, Kind: DependencyLinks})
+	}
+	if kind, target := s.NetworkModeKind(); kind == NetworkModeService {
+		dependencies = append(dependencies, Dependency{From: s.Name, To: target, Kind: DependencyNetworkMode})
+	}
+	for _, namespace := range []struct {
+		value string
+		kind  DependencyKind
+	}{
+		{s.Ipc, DependencyIpc},
+		{s.Pid, DependencyPid},
+		{s.Uts, DependencyUts},
+		{s.Cgroup, DependencyCgroup},
+	} {
+		if strings.HasPrefix(namespace.value, ServicePrefix) {
+			dependencies = append(dependencies, Dependency{From: s.Name, To: namespace.value[len(ServicePrefix):], Kind: namespace.kind})
+		}
+	}
+	for _, vol := range s.VolumesFrom {
+		if !strings.HasPrefix(vol, ContainerPrefix) {
+			name, _, _ := strings.Cut(vol, ":")
+			dependencies = append(dependencies, Dependency{From: s.Name, To: name, Kind: DependencyVolumesFrom})
+		}
+	}
+	return dependencies
+}
+
+// DependencyGraph computes the dependency graph of the project's services, based on Dependencies
+func (p *Project) DependencyGraph() (*Graph, error) {
+	g := &Graph{
+		dependencies: map[string][]string{},
+	}
+	for _, s := range p.Services {
+		g.dependencies[s.Name] = nil
+	}
+	for _, s := range p.Services {
+		deps := set{}
+		for _, dep := range s.DependencyEdges() {
+			if _, ok := g.dependencies[dep.To]; !ok && dep.Optional {
+				// an undefined optional dependency is ignored
+				continue
+			}
+			deps.append(dep.To)
+		}
+
+		dependencies := deps.toSlice()
+		sort.Strings(dependencies)
+		for _, dep := range dependencies {
+			if _, ok := g.dependencies[dep]; !ok {
+				return nil, fmt.Errorf("service %q depends on undefined service %q", s.Name, dep)
+			}
+		}
+		g.dependencies[s.Name] = dependencies
+	}
+	return g, nil
+}
+
+// Dependencies returns the names of the services the named service directly depends on
+func (g *Graph) Dependencies(name string) []string {
+	return g.dependencies[name]
+}
+
+// TopologicalSort returns the services in start order, as batches of services which only depend on
+// services from previous batches, and as such can be started in parallel. Services in a batch are sorted by name
+func (g *Graph) TopologicalSort() ([][]string, error) {
+	if err := g.checkCycles(); err != nil {
+		return nil, err
+	}
+
+	remaining := map[string]int{}
+	dependents := map[string][]string{}
+	for name, deps := range g.dependencies {
+		remaining[name] = len(deps)
+		for _, dep := range deps {
+			dependents[dep] = append(dependents[dep], name)
+		}
+	}
+
+	var batches [][]string
+	for len(remaining) > 0 {
+		var batch []string
+		for name, count := range remaining {
+			if count == 0 {
+				batch = append(batch, name)
+			}
+		}
+		sort.Strings(batch)
+		for _, name := range batch {
+			delete(remaining, name)
+			for _, dependent := range dependents[name] {
+				remaining[dependent]--
+			}
+		}
+		batches = append(batches, batch)
+	}
+	return batches, nil
+}
+
+// checkCycles returns an error with the full cycle path, like `a -> b -> a`, if the graph has a cycle
+func (g *Graph) checkCycles() error {
+	names := make([]string, 0, len(g.dependencies))
+	for name := range g.dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			for i, n := range path {
+				if n == name {
+					cycle := append(append([]string{}, path[i:]...), name)
+					return fmt.Errorf("cycle detected: %s", strings.Join(cycle, " -> "))
+				}
+			}
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range g.dependencies[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GraphDOT renders the services dependency graph in Graphviz DOT syntax, edges being labeled by the
+// dependency kind
+func (p *Project) GraphDOT() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(p.Name))
+	for _, name := range p.graphNodes() {
+		fmt.Fprintf(&b, "  %s;\n", dotQuote(name))
+	}
+	for _, dep := range p.Dependencies() {
+		fmt.Fprintf(&b, "  %s -> %s [label=%s];\n", dotQuote(dep.From), dotQuote(dep.To), dotQuote(string(dep.Kind)))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// GraphMermaid renders the services dependency graph as a Mermaid flowchart, edges being labeled by the
+// dependency kind. Nodes get a generated identifier, as service names may not be valid Mermaid identifiers
+func (p *Project) GraphMermaid() string {
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+	ids := map[string]string{}
+	for i, name := range p.graphNodes() {
+		ids[name] = fmt.Sprintf("s%d", i)
+		fmt.Fprintf(&b, "  %s[\"%s\"]\n", ids[name], strings.ReplaceAll(name, `"`, "#quot;"))
+	}
+	for _, dep := range p.Dependencies() {
+		fmt.Fprintf(&b, "  %s -->|%s| %s\n", ids[dep.From], dep.Kind, ids[dep.To])
+	}
+	return b.String()
+}
+
+// graphNodes lists the services in project order, followed by the undefined services they depend on
+func (p *Project) graphNodes() []string {
+	var nodes []string
+	seen := map[string]bool{}
+	for _, s := range p.Services {
+		nodes = append(nodes, s.Name)
+		seen[s.Name] = true
+	}
+	for _, dep := range p.Dependencies() {
+		if !seen[dep.To] {
+			nodes = append(nodes, dep.To)
+			seen[dep.To] = true
+		}
+	}
+	return nodes
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
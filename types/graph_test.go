@@ -0,0 +1,115 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDependencyGraph(t *testing.T) {
+	p := Project{
+		Services: Services{
+			{Name: "web", DependsOn: DependsOnConfig{"api": {}}, Links: []string{"cache:redis"}},
+			{Name: "api", NetworkMode: "service:db", VolumesFrom: []string{"data:ro", "container:external"}},
+			{Name: "cache"},
+			{Name: "db"},
+			{Name: "data"},
+		},
+	}
+	graph, err := p.DependencyGraph()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, graph.Dependencies("api"), []string{"data", "db"})
+
+	batches, err := graph.TopologicalSort()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, batches, [][]string{
+		{"cache", "data", "db"},
+		{"api"},
+		{"web"},
+	})
+
+	p.Services[3].DependsOn = DependsOnConfig{"web": {}}
+	graph, err = p.DependencyGraph()
+	assert.NilError(t, err)
+	_, err = graph.TopologicalSort()
+	assert.Error(t, err, "cycle detected: api -> db -> web -> api")
+
+	p.Services[3].DependsOn = DependsOnConfig{"missing": {}}
+	_, err = p.DependencyGraph()
+	assert.Error(t, err, `service "db" depends on undefined service "missing"`)
+}
+
+func TestDependencies(t *testing.T) {
+	p := &Project{
+		Services: Services{
+			{
+				Name:        "web",
+				DependsOn:   DependsOnConfig{"db": {}, "cache": {}},
+				Links:       []string{"db:database"},
+				NetworkMode: "service:proxy",
+				Ipc:         "service:proxy",
+				Pid:         "host",
+				VolumesFrom: []string{"data:ro", "container:legacy"},
+			},
+			{Name: "proxy", Pid: "service:db"},
+			{Name: "db"},
+			{Name: "cache"},
+			{Name: "data"},
+		},
+	}
+	assert.DeepEqual(t, p.Dependencies(), []Dependency{
+		{From: "web", To: "cache", Kind: DependencyDependsOn},
+		{From: "web", To: "db", Kind: DependencyDependsOn},
+		{From: "web", To: "db", Kind: DependencyLinks},
+		{From: "web", To: "proxy", Kind: DependencyNetworkMode},
+		{From: "web", To: "proxy", Kind: DependencyIpc},
+		{From: "web", To: "data", Kind: DependencyVolumesFrom},
+		{From: "proxy", To: "db", Kind: DependencyPid},
+	})
+}
+
+func TestGraphDOTAndMermaid(t *testing.T) {
+	p := &Project{
+		Name: "app",
+		Services: Services{
+			{Name: "web", DependsOn: DependsOnConfig{"db": {}}, NetworkMode: "service:proxy"},
+			{Name: "proxy"},
+			{Name: "db", VolumesFrom: []string{"data"}},
+		},
+	}
+	assert.Equal(t, p.GraphDOT(), `digraph "app" {
+  "web";
+  "proxy";
+  "db";
+  "data";
+  "web" -> "db" [label="depends_on"];
+  "web" -> "proxy" [label="network_mode"];
+  "db" -> "data" [label="volumes_from"];
+}
+`)
+	assert.Equal(t, p.GraphMermaid(), `flowchart TD
+  s0["web"]
+  s1["proxy"]
+  s2["db"]
+  s3["data"]
+  s0 -->|depends_on| s2
+  s0 -->|network_mode| s1
+  s2 -->|volumes_from| s3
+`)
+}
@@ -18,16 +18,21 @@ package types
 
 import (
 	"bytes"
+	_ "crypto/sha256" // registers the algorithm used by Hash
 	"encoding/json"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strings"
+	"sync"
 
-	"github.com/compose-spec/compose-go/dotenv"
+	"github.com/compose-spec/compose-go/errdefs"
+	"github.com/compose-spec/compose-go/schema"
 	"github.com/distribution/distribution/v3/reference"
 	godigest "github.com/opencontainers/go-digest"
-	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
 	"gopkg.in/yaml.v3"
 )
@@ -48,6 +53,22 @@ type Project struct {
 	// DisabledServices track services which have been disable as profile is not active
 	DisabledServices Services `yaml:"-" json:"-"`
 	Profiles         []string `yaml:"-" json:"-"`
+	// ServicesOrder lists the names of the services in the order they're declared by the compose files, see
+	// PreserveServiceOrder
+	ServicesOrder []string `yaml:"-" json:"-"`
+
+	// ResetPaths are the paths of attributes, like `["services", "web", "ports"]`, which values are discarded rather
+	// than merged when the project is merged on top of another one by loader.MergeProjects. Load sets the paths
+	// tagged `!reset` or `!override` by the compose files
+	ResetPaths [][]string `yaml:"-" json:"-"`
+
+	// WarningMessages collects the non-fatal issues met while transforming the project
+	WarningMessages []string `yaml:"-" json:"-"`
+}
+
+// Warnings returns the non-fatal issues met while transforming the project, like dropped dependencies
+func (p *Project) Warnings() []string {
+	return p.WarningMessages
 }
 
 // ServiceNames return names for all services in this Compose config
@@ -100,7 +121,47 @@ func (p *Project) ConfigNames() []string {
 	return names
 }
 
-// GetServices retrieve services by names, or return all services if no name specified
+// NotFoundError is returned when looking up a service the project doesn't define
+type NotFoundError struct {
+	// Name of the service which was looked up
+	Name string
+	// Available lists the names of the enabled services
+	Available []string
+	// Profiles lists the profiles enabling the service, when it's disabled as none of them is active
+	Profiles []string
+}
+
+func (e *NotFoundError) Error() string {
+	msg := fmt.Sprintf("no such service: %s", e.Name)
+	if len(e.Profiles) > 0 {
+		msg += fmt.Sprintf(", it is only enabled by profiles %s", strings.Join(e.Profiles, ", "))
+	}
+	if len(e.Available) > 0 {
+		msg += fmt.Sprintf(" (available services: %s)", strings.Join(e.Available, ", "))
+	}
+	return msg
+}
+
+// Unwrap makes NotFoundError match errdefs.ErrNotFound
+func (e *NotFoundError) Unwrap() error {
+	return errdefs.ErrNotFound
+}
+
+func (p *Project) serviceNotFound(name string) error {
+	err := &NotFoundError{
+		Name:      name,
+		Available: p.ServiceNames(),
+	}
+	for _, s := range p.DisabledServices {
+		if s.Name == name {
+			err.Profiles = s.Profiles
+		}
+	}
+	return err
+}
+
+// GetServices retrieve services by names, or return all services if no name specified. It fails with a
+// NotFoundError, and no service, if any of the names isn't an enabled service
 func (p *Project) GetServices(names ...string) (Services, error) {
 	if len(names) == 0 {
 		return p.Services, nil
@@ -115,13 +176,46 @@ func (p *Project) GetServices(names ...string) (Services, error) {
 			}
 		}
 		if serviceConfig == nil {
-			return services, fmt.Errorf("no such service: %s", name)
+			return nil, p.serviceNotFound(name)
 		}
 		services = append(services, *serviceConfig)
 	}
 	return services, nil
 }
 
+// ServicesByLabel returns the enabled services with label key set to value, in project order. Both the labels
+// declared by the compose file and the ones injected by CustomLabels are considered
+func (p *Project) ServicesByLabel(key, value string) Services {
+	var services Services
+	for _, s := range p.Services {
+		if v, ok := serviceLabels(s)[key]; ok && v == value {
+			services = append(services, s)
+		}
+	}
+	return services
+}
+
+// ServiceLabels returns the labels of the named enabled service: the labels declared by the compose file,
+// overridden by the ones injected by CustomLabels. It returns nil if there's no such service
+func (p *Project) ServiceLabels(service string) Labels {
+	s, err := p.GetService(service)
+	if err != nil {
+		return nil
+	}
+	return serviceLabels(s)
+}
+
+func serviceLabels(s ServiceConfig) Labels {
+	labels := Labels{}
+	for k, v := range s.Labels {
+		labels[k] = v
+	}
+	for k, v := range s.CustomLabels {
+		labels[k] = v
+	}
+	return labels
+}
+
 // GetDisabledService retrieve disabled service by name
 func (p Project) GetDisabledService(name string) (ServiceConfig, error) {
 	for _, config := range p.DisabledServices {
@@ -132,18 +226,24 @@ func (p Project) GetDisabledService(name string) (ServiceConfig, error) {
 	return ServiceConfig{}, fmt.Errorf("no such service: %s", name)
 }
 
-// GetService retrieve a specific service by name
+// GetService retrieve a specific service by name, or fails with a NotFoundError
 func (p *Project) GetService(name string) (ServiceConfig, error) {
 	services, err := p.GetServices(name)
 	if err != nil {
 		return ServiceConfig{}, err
 	}
-	if len(services) == 0 {
-		return ServiceConfig{}, fmt.Errorf("no such service: %s", name)
-	}
 	return services[0], nil
 }
 
+// MustGetService retrieve a specific service by name, and panics if the project doesn't define it
+func (p *Project) MustGetService(name string) ServiceConfig {
+	s, err := p.GetService(name)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
 func (p *Project) AllServices() Services {
 	var all Services
 	all = append(all, p.Services...)
@@ -178,7 +278,13 @@ func (p *Project) withServices(names []string, fn ServiceFunc, seen map[string]b
 			case IncludeDependents:
 				dependencies = append(dependencies, p.GetDependentsForService(service)...)
 			case IncludeDependencies:
-				dependencies = append(dependencies, service.GetDependencies()...)
+				for _, name := range service.GetDependencies() {
+					if _, err := p.GetService(name); err != nil && !service.DependsOn[name].IsRequired() {
+						// undefined optional dependency
+						continue
+					}
+					dependencies = append(dependencies, name)
+				}
 			case IgnoreDependencies:
 				// Noop
 			default:
@@ -272,6 +378,60 @@ func (p *Project) ApplyProfiles(profiles []string) {
 	p.Profiles = profiles
 }
 
+// ServicesWithProfiles returns the sorted names of the services, including currently disabled ones, which would be
+// enabled by selecting profiles. Services without profiles are always enabled, and `*` enables all profiles
+func (p *Project) ServicesWithProfiles(profiles []string) []string {
+	all := false
+	for _, profile := range profiles {
+		if profile == "*" {
+			all = true
+		}
+	}
+	var names []string
+	for _, service := range p.AllServices() {
+		if all || service.HasProfile(profiles) {
+			names = append(names, service.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithProfiles returns a copy of the project with only the services enabled by profiles. `depends_on` entries
+// pointing at disabled services are dropped, and reported by Warnings
+func (p *Project) WithProfiles(profiles []string) (*Project, error) {
+	newProject := *p
+	newProject.Services = append(Services{}, p.Services...)
+	newProject.DisabledServices = append(Services{}, p.DisabledServices...)
+	newProject.Profiles = append([]string{}, p.Profiles...)
+	newProject.WarningMessages = append([]string{}, p.WarningMessages...)
+	newProject.ApplyProfiles(profiles)
+
+	disabled := map[string]struct{}{}
+	for _, service := range newProject.DisabledServices {
+		disabled[service.Name] = struct{}{}
+	}
+	var dropped []string
+	for i, service := range newProject.Services {
+		var dependsOn DependsOnConfig
+		for name, dependency := range service.DependsOn {
+			if _, ok := disabled[name]; ok {
+				dropped = append(dropped,
+					fmt.Sprintf("service %q depends on service %q which is disabled by profiles, dependency dropped", service.Name, name))
+				continue
+			}
+			if dependsOn == nil {
+				dependsOn = DependsOnConfig{}
+			}
+			dependsOn[name] = dependency
+		}
+		newProject.Services[i].DependsOn = dependsOn
+	}
+	sort.Strings(dropped)
+	newProject.WarningMessages = append(newProject.WarningMessages, dropped...)
+	return &newProject, nil
+}
+
 // EnableServices ensure services are enabled and activate profiles accordingly
 func (p *Project) EnableServices(names ...string) error {
 	if len(names) == 0 {
@@ -308,6 +468,25 @@ PROFILES:
 
 // WithoutUnnecessaryResources drops networks/volumes/secrets/configs that are not referenced by active services
 func (p *Project) WithoutUnnecessaryResources() {
+	p.PruneUnusedResources()
+}
+
+// PrunedResource is a network, volume, secret or config dropped by PruneUnusedResources
+type PrunedResource struct {
+	// Kind is the kind of resource, one of `network`, `volume`, `secret` or `config`
+	Kind string
+	// Name is the key of the resource in the project
+	Name string
+}
+
+// String renders the resource like `network "back"`
+func (r PrunedResource) String() string {
+	return fmt.Sprintf("%s %q", r.Kind, r.Name)
+}
+
+// PruneUnusedResources drops networks/volumes/secrets/configs that are not referenced by active services, and
+// returns the dropped resources: networks, volumes, secrets then configs, sorted by name
+func (p *Project) PruneUnusedResources() []PrunedResource {
 	requiredNetworks := map[string]struct{}{}
 	requiredVolumes := map[string]struct{}{}
 	requiredSecrets := map[string]struct{}{}
@@ -335,37 +514,30 @@ func (p *Project) WithoutUnnecessaryResources() {
 		}
 	}
 
-	networks := Networks{}
-	for k := range requiredNetworks {
-		if value, ok := p.Networks[k]; ok {
-			networks[k] = value
-		}
-	}
-	p.Networks = networks
-
-	volumes := Volumes{}
-	for k := range requiredVolumes {
-		if value, ok := p.Volumes[k]; ok {
-			volumes[k] = value
-		}
-	}
-	p.Volumes = volumes
+	var pruned []PrunedResource
+	p.Networks = pruneResources(p.Networks, requiredNetworks, "network", &pruned)
+	p.Volumes = pruneResources(p.Volumes, requiredVolumes, "volume", &pruned)
+	p.Secrets = pruneResources(p.Secrets, requiredSecrets, "secret", &pruned)
+	p.Configs = pruneResources(p.Configs, requiredConfigs, "config", &pruned)
+	return pruned
+}
 
-	secrets := Secrets{}
-	for k := range requiredSecrets {
-		if value, ok := p.Secrets[k]; ok {
-			secrets[k] = value
+// pruneResources returns the required resources, and appends the other ones to pruned
+func pruneResources[T any](resources map[string]T, required map[string]struct{}, kind string, pruned *[]PrunedResource) map[string]T {
+	kept := map[string]T{}
+	var names []string
+	for k, value := range resources {
+		if _, ok := required[k]; ok {
+			kept[k] = value
+			continue
 		}
+		names = append(names, k)
 	}
-	p.Secrets = secrets
-
-	configs := Configs{}
-	for k := range requiredConfigs {
-		if value, ok := p.Configs[k]; ok {
-			configs[k] = value
-		}
+	sort.Strings(names)
+	for _, name := range names {
+		*pruned = append(*pruned, PrunedResource{Kind: kind, Name: name})
 	}
-	p.Configs = configs
+	return kept
 }
 
 type DependencyOption int
@@ -405,6 +577,20 @@ func (p *Project) ForServices(names []string, options ...DependencyOption) error
 	return nil
 }
 
+// WithSelectedServices returns a copy of the project restricted to the selected services, and their dependencies
+// unless IgnoreDependencies is set, only retaining the networks, volumes, secrets and configs they actually use.
+// The original project is left unchanged
+func (p *Project) WithSelectedServices(names []string, options ...DependencyOption) (*Project, error) {
+	newProject := *p
+	newProject.Services = append(Services{}, p.Services...)
+	newProject.DisabledServices = append(Services{}, p.DisabledServices...)
+	if err := newProject.ForServices(names, options...); err != nil {
+		return nil, err
+	}
+	newProject.WithoutUnnecessaryResources()
+	return &newProject, nil
+}
+
 // ResolveImages updates services images to include digest computed by a resolver function
 func (p *Project) ResolveImages(resolver func(named reference.Named) (godigest.Digest, error)) error {
 	eg := errgroup.Group{}
@@ -441,73 +627,451 @@ func (p *Project) ResolveImages(resolver func(named reference.Named) (godigest.D
 	return eg.Wait()
 }
 
-// MarshalYAML marshal Project into a yaml tree
-func (p *Project) MarshalYAML() ([]byte, error) {
+// MarshalOptions configures how MarshalYAML renders a Project
+type MarshalOptions struct {
+	// PreserveServiceOrder renders services in the order they're declared by the compose files, rather than
+	// sorted by name
+	PreserveServiceOrder bool
+}
+
+// PreserveServiceOrder sets the MarshalOptions to render services in the order of Project.ServicesOrder. Services
+// which are not listed there, like the ones added programmatically, come last, sorted by name
+func PreserveServiceOrder(opts *MarshalOptions) {
+	opts.PreserveServiceOrder = true
+}
+
+// MarshalYAML marshal Project into a yaml tree. Services are sorted by name, unless PreserveServiceOrder is set
+func (p *Project) MarshalYAML(options ...func(*MarshalOptions)) ([]byte, error) {
+	var opts MarshalOptions
+	for _, option := range options {
+		option(&opts)
+	}
+	var v interface{} = p
+	if opts.PreserveServiceOrder {
+		var node yaml.Node
+		if err := node.Encode(p); err != nil {
+			return nil, err
+		}
+		if services := mappingValue(&node, "services"); services != nil {
+			orderMappingNode(services, p.ServicesOrder)
+		}
+		v = &node
+	}
+
 	buf := bytes.NewBuffer([]byte{})
 	encoder := yaml.NewEncoder(buf)
 	encoder.SetIndent(2)
 	// encoder.CompactSeqIndent() FIXME https://github.com/go-yaml/yaml/pull/753
-	err := encoder.Encode(p)
+	err := encoder.Encode(v)
 	if err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), nil
 }
 
-// MarshalJSON makes Config implement json.Marshaler
-func (p *Project) MarshalJSON() ([]byte, error) {
-	m := map[string]interface{}{
-		"name":     p.Name,
-		"services": p.Services,
+// orderMappingNode sorts the entries of a mapping node by the position of their key in order. Keys which are not
+// listed keep their relative order, after the listed ones
+func orderMappingNode(node *yaml.Node, order []string) {
+	position := make(map[string]int, len(order))
+	for i, key := range order {
+		if _, ok := position[key]; !ok {
+			position[key] = i
+		}
+	}
+	rank := func(key string) int {
+		if i, ok := position[key]; ok {
+			return i
+		}
+		return len(order)
+	}
+	type pair struct {
+		key, value *yaml.Node
 	}
+	pairs := make([]pair, 0, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		pairs = append(pairs, pair{key: node.Content[i], value: node.Content[i+1]})
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return rank(pairs[i].key.Value) < rank(pairs[j].key.Value)
+	})
+	node.Content = node.Content[:0]
+	for _, p := range pairs {
+		node.Content = append(node.Content, p.key, p.value)
+	}
+}
 
-	if len(p.Networks) > 0 {
-		m["networks"] = p.Networks
+// MarshalYAMLCanonical marshal Project into a canonical yaml tree: attributes are sorted in the order the
+// compose-spec schema declares them at all levels, entries of maps like services or labels are sorted alphabetically,
+// and scalars use the default quoting style.
+// The output is stable for a given Project, and as such is suitable for diffing or checksumming
+func (p *Project) MarshalYAMLCanonical() ([]byte, error) {
+	var node yaml.Node
+	if err := node.Encode(p); err != nil {
+		return nil, err
 	}
-	if len(p.Volumes) > 0 {
-		m["volumes"] = p.Volumes
+	return encodeCanonical(&node)
+}
+
+func encodeCanonical(node *yaml.Node) ([]byte, error) {
+	canonicalizeNode(node, composeSchemaRoot())
+
+	buf := bytes.NewBuffer([]byte{})
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, err
 	}
-	if len(p.Secrets) > 0 {
-		m["secrets"] = p.Secrets
+	return buf.Bytes(), nil
+}
+
+// HashOptions configures how Hash digests a Project
+type HashOptions struct {
+	// IncludePaths makes the hash depend on the project working directory, and on the absolute paths under it
+	IncludePaths bool
+}
+
+// IncludePaths sets the HashOptions to include the project working directory in the hash, so the same project
+// loaded from two directories gets distinct hashes
+func IncludePaths(opts *HashOptions) {
+	opts.IncludePaths = true
+}
+
+// Hash returns the SHA-256 digest of the canonical YAML representation of the project, like `sha256:1f2e...`.
+// Projects with the same model get the same hash, regardless of the order services and resources are declared in,
+// or how their attributes are written. Attributes which are not part of the YAML representation, like the
+// environment or the disabled services, are ignored. Unless IncludePaths is set, paths under the working directory
+// are hashed relative to it, so the hash doesn't change when the project is moved
+func (p *Project) Hash(options ...func(*HashOptions)) (string, error) {
+	var opts HashOptions
+	for _, option := range options {
+		option(&opts)
 	}
-	if len(p.Configs) > 0 {
-		m["configs"] = p.Configs
+	var node yaml.Node
+	if err := node.Encode(p); err != nil {
+		return "", err
 	}
-	for k, v := range p.Extensions {
-		m[k] = v
+	if !opts.IncludePaths && p.WorkingDir != "" {
+		relativizeNode(&node, filepath.Clean(p.WorkingDir))
 	}
-	return json.Marshal(m)
+	b, err := encodeCanonical(&node)
+	if err != nil {
+		return "", err
+	}
+	digester := godigest.Canonical.Digester()
+	if opts.IncludePaths {
+		fmt.Fprintf(digester.Hash(), "%s\n", p.WorkingDir)
+	}
+	digester.Hash().Write(b)
+	return digester.Digest().String(), nil
 }
 
-// ResolveServicesEnvironment parse env_files set for services to resolve the actual environment map for services
-func (p Project) ResolveServicesEnvironment(discardEnvFiles bool) error {
-	for i, service := range p.Services {
-		service.Environment = service.Environment.Resolve(p.Environment.Resolve)
-
-		environment := MappingWithEquals{}
-		// resolve variables based on other files we already parsed, + project's environment
-		var resolve dotenv.LookupFn = func(s string) (string, bool) {
-			v, ok := environment[s]
-			if ok && v != nil {
-				return *v, ok
+// relativizeNode rewrites scalars which are paths under dir relative to it
+func relativizeNode(node *yaml.Node, dir string) {
+	if node.Kind == yaml.ScalarNode {
+		switch {
+		case node.Value == dir:
+			node.Value = "."
+		case strings.HasPrefix(node.Value, dir+string(filepath.Separator)):
+			node.Value = "." + node.Value[len(dir):]
+		}
+	}
+	for _, child := range node.Content {
+		relativizeNode(child, dir)
+	}
+}
+
+// WriteFile writes the project as canonical YAML to path, creating parent directories as needed. Content is written
+// to a temporary file in the target directory then renamed, so path is never left with a partially written project
+func (p *Project) WriteFile(path string, perm os.FileMode) error {
+	b, err := p.MarshalYAMLCanonical()
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := writeFileAtomic(path, b, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// canonicalizeNode sorts mapping keys in the order properties are declared by the schema definition def, then
+// alphabetically for keys def doesn't declare, like map entries or extensions. A nil def sorts all keys alphabetically
+func canonicalizeNode(node *yaml.Node, def *yaml.Node) {
+	if node.Kind == yaml.DocumentNode {
+		for _, child := range node.Content {
+			canonicalizeNode(child, def)
+		}
+		return
+	}
+	def = resolveDefinition(def, node.Kind)
+	switch node.Kind {
+	case yaml.MappingNode:
+		type pair struct {
+			key, value *yaml.Node
+			index      int
+		}
+		properties := mappingValue(def, "properties")
+		pairs := make([]pair, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			pairs = append(pairs, pair{key: key, value: node.Content[i+1], index: mappingIndex(properties, key.Value)})
+		}
+		sort.SliceStable(pairs, func(i, j int) bool {
+			if pairs[i].index != pairs[j].index {
+				return pairs[i].index < pairs[j].index
 			}
-			return p.Environment.Resolve(s)
+			return pairs[i].key.Value < pairs[j].key.Value
+		})
+		node.Content = node.Content[:0]
+		for _, p := range pairs {
+			node.Content = append(node.Content, p.key, p.value)
+			canonicalizeNode(p.value, propertyDefinition(def, p.key.Value))
+		}
+	case yaml.SequenceNode:
+		items := mappingValue(def, "items")
+		for _, child := range node.Content {
+			canonicalizeNode(child, items)
 		}
+	case yaml.ScalarNode:
+		// let the encoder select quoting, so same value always renders the same way
+		node.Style = 0
+	}
+}
 
-		for _, envFile := range service.EnvFile {
-			b, err := os.ReadFile(envFile)
-			if err != nil {
-				return errors.Wrapf(err, "Failed to load %s", envFile)
+var (
+	composeSchemaOnce sync.Once
+	composeSchema     *yaml.Node
+)
+
+// composeSchemaRoot returns the root definition of the compose-spec schema, used to order canonical YAML
+func composeSchemaRoot() *yaml.Node {
+	composeSchemaOnce.Do(func() {
+		var doc yaml.Node
+		// JSON being a subset of YAML, parsing the schema as a yaml.Node preserves properties order
+		if err := yaml.Unmarshal([]byte(schema.Schema), &doc); err == nil && len(doc.Content) > 0 {
+			composeSchema = doc.Content[0]
+		}
+	})
+	return composeSchema
+}
+
+// resolveDefinition follows `$ref` and selects the `oneOf`/`anyOf` alternative of def matching a node of kind
+func resolveDefinition(def *yaml.Node, kind yaml.Kind) *yaml.Node {
+	if def == nil || def.Kind != yaml.MappingNode {
+		return nil
+	}
+	if ref := mappingValue(def, "$ref"); ref != nil {
+		name := strings.TrimPrefix(ref.Value, "#/definitions/")
+		return resolveDefinition(mappingValue(mappingValue(composeSchemaRoot(), "definitions"), name), kind)
+	}
+	for _, keyword := range []string{"oneOf", "anyOf"} {
+		alternatives := mappingValue(def, keyword)
+		if alternatives == nil {
+			continue
+		}
+		for _, alternative := range alternatives.Content {
+			if resolved := resolveDefinition(alternative, kind); resolved != nil && definitionMatches(resolved, kind) {
+				return resolved
+			}
+		}
+		return nil
+	}
+	return def
+}
+
+// definitionMatches tells if def describes nodes of kind
+func definitionMatches(def *yaml.Node, kind yaml.Kind) bool {
+	var want string
+	switch kind {
+	case yaml.MappingNode:
+		want = "object"
+	case yaml.SequenceNode:
+		want = "array"
+	default:
+		return true
+	}
+	types := mappingValue(def, "type")
+	if types == nil {
+		return false
+	}
+	if types.Kind == yaml.ScalarNode {
+		return types.Value == want
+	}
+	for _, t := range types.Content {
+		if t.Value == want {
+			return true
+		}
+	}
+	return false
+}
+
+// propertyDefinition returns the definition def declares for the value of key, either as a property, a pattern
+// property or additional properties
+func propertyDefinition(def *yaml.Node, key string) *yaml.Node {
+	if property := mappingValue(mappingValue(def, "properties"), key); property != nil {
+		return property
+	}
+	if patterns := mappingValue(def, "patternProperties"); patterns != nil {
+		for i := 0; i+1 < len(patterns.Content); i += 2 {
+			if matched, err := regexp.MatchString(patterns.Content[i].Value, key); err == nil && matched {
+				return patterns.Content[i+1]
 			}
+		}
+	}
+	return mappingValue(def, "additionalProperties")
+}
+
+// mappingValue returns the value set for key by a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// mappingIndex returns the position of key in a mapping node, or a position after all keys if key isn't set
+func mappingIndex(node *yaml.Node, key string) int {
+	if node != nil {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				return i / 2
+			}
+		}
+		return len(node.Content) / 2
+	}
+	return 0
+}
 
-			fileVars, err := dotenv.ParseWithLookup(bytes.NewBuffer(b), resolve)
+// MarshalJSON makes Project implement json.Marshaler. The JSON document has the same content and field order as
+// the YAML one: `services` is always set, while other attributes, including project `name` and the attributes of
+// services and resources, are omitted when empty. Explicitly empty `command` and `entrypoint` are kept as `[]`
+func (p *Project) MarshalJSON() ([]byte, error) {
+	var node yaml.Node
+	if err := node.Encode(p); err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer([]byte{})
+	if err := writeJSONNode(buf, &node); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalJSONCanonical is like MarshalJSON, with object keys sorted at all levels.
+// The output is stable for a given Project, and as such is suitable for diffing or checksumming
+func (p *Project) MarshalJSONCanonical() ([]byte, error) {
+	var node yaml.Node
+	if err := node.Encode(p); err != nil {
+		return nil, err
+	}
+	canonicalizeNode(&node, nil)
+	buf := bytes.NewBuffer([]byte{})
+	if err := writeJSONNode(buf, &node); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeJSONNode writes a YAML tree as JSON, preserving the order of mapping keys
+func writeJSONNode(buf *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("null")
+			return nil
+		}
+		return writeJSONNode(buf, node.Content[0])
+	case yaml.AliasNode:
+		return writeJSONNode(buf, node.Alias)
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, err := json.Marshal(node.Content[i].Value)
 			if err != nil {
 				return err
 			}
-			environment.OverrideBy(Mapping(fileVars).ToMappingWithEquals())
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := writeJSONNode(buf, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSONNode(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return err
 		}
+		b, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+	return nil
+}
+
+// ResolveServicesEnvironment parse env_files set for services to resolve the actual environment map for services
+func (p Project) ResolveServicesEnvironment(discardEnvFiles bool) error {
+	return p.ResolveServicesEnvironmentFS(nil, discardEnvFiles)
+}
 
-		service.Environment = environment.OverrideBy(service.Environment)
+// ResolveServicesEnvironmentFS is like ResolveServicesEnvironment but reads env_files from fsys,
+// or from the local filesystem if fsys is nil
+func (p Project) ResolveServicesEnvironmentFS(fsys fs.FS, discardEnvFiles bool) error {
+	for i, service := range p.Services {
+		environment, err := service.resolveEnvironment(fsys, p.Environment)
+		if err != nil {
+			return err
+		}
+		service.Environment = environment
 
 		if discardEnvFiles {
 			service.EnvFile = nil
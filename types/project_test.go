@@ -18,11 +18,16 @@ package types
 
 import (
 	_ "crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/compose-spec/compose-go/errdefs"
 	"github.com/distribution/distribution/v3/reference"
 	"github.com/opencontainers/go-digest"
 	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
 )
 
 func Test_ApplyProfiles(t *testing.T) {
@@ -49,6 +54,40 @@ func Test_ApplyProfiles(t *testing.T) {
 
 }
 
+func TestServicesWithProfiles(t *testing.T) {
+	p := makeProject()
+	assert.DeepEqual(t, p.ServicesWithProfiles(nil), []string{"service_1"})
+	assert.DeepEqual(t, p.ServicesWithProfiles([]string{"foo", "zot"}), []string{"service_1", "service_2", "service_4", "service_5"})
+	assert.DeepEqual(t, p.ServicesWithProfiles([]string{"*"}), []string{"service_1", "service_2", "service_3", "service_4", "service_5"})
+
+	// disabled services are also considered
+	p.ApplyProfiles([]string{"foo"})
+	assert.DeepEqual(t, p.ServicesWithProfiles([]string{"bar"}), []string{"service_1", "service_3"})
+}
+
+func TestWithProfiles(t *testing.T) {
+	p := makeProject()
+	p.Services[3].DependsOn = map[string]ServiceDependency{"service_3": {}, "service_5": {}}
+
+	filtered, err := p.WithProfiles([]string{"zot"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, filtered.ServiceNames(), []string{"service_1", "service_4", "service_5"})
+	assert.Equal(t, len(filtered.DisabledServices), 2)
+	assert.Equal(t, filtered.DisabledServices[0].Name, "service_2")
+	assert.Equal(t, filtered.DisabledServices[1].Name, "service_3")
+	service, err := filtered.GetService("service_4")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, service.DependsOn, DependsOnConfig{"service_5": {}})
+	assert.DeepEqual(t, filtered.Warnings(), []string{
+		`service "service_4" depends on service "service_3" which is disabled by profiles, dependency dropped`,
+	})
+
+	// original project is left untouched
+	assert.Equal(t, len(p.Services), 5)
+	assert.Equal(t, len(p.Services[3].DependsOn), 2)
+	assert.Assert(t, p.Warnings() == nil)
+}
+
 func Test_WithoutUnnecessaryResources(t *testing.T) {
 	p := makeProject()
 	p.Networks["unused"] = NetworkConfig{}
@@ -70,6 +109,32 @@ func Test_WithoutUnnecessaryResources(t *testing.T) {
 	}
 }
 
+func TestPruneUnusedResources(t *testing.T) {
+	p := makeProject()
+	p.Services[0].Networks = map[string]*ServiceNetworkConfig{"front": nil}
+	p.Services[0].Volumes = []ServiceVolumeConfig{{Type: VolumeTypeVolume, Source: "data", Target: "/data"}}
+	p.Services[1].Networks = map[string]*ServiceNetworkConfig{"back": nil}
+	p.Services[1].Secrets = []ServiceSecretConfig{{Source: "token"}}
+	p.Networks["front"] = NetworkConfig{Name: "front"}
+	p.Networks["back"] = NetworkConfig{Name: "back"}
+	p.Volumes["data"] = VolumeConfig{Name: "data"}
+	p.Volumes["cache"] = VolumeConfig{Name: "cache"}
+	p.Secrets["token"] = SecretConfig{Name: "token"}
+	p.ApplyProfiles(nil)
+
+	pruned := p.PruneUnusedResources()
+	assert.DeepEqual(t, pruned, []PrunedResource{
+		{Kind: "network", Name: "back"},
+		{Kind: "volume", Name: "cache"},
+		{Kind: "secret", Name: "token"},
+	})
+	assert.Equal(t, pruned[0].String(), `network "back"`)
+	assert.DeepEqual(t, p.NetworkNames(), []string{"front"})
+	assert.DeepEqual(t, p.VolumeNames(), []string{"data"})
+	assert.Check(t, p.SecretNames() == nil)
+	assert.Check(t, p.PruneUnusedResources() == nil)
+}
+
 func Test_NoProfiles(t *testing.T) {
 	p := makeProject()
 	p.ApplyProfiles(nil)
@@ -198,4 +263,293 @@ func TestWithServices(t *testing.T) {
 	}, IgnoreDependencies)
 	assert.NilError(t, err)
 	assert.DeepEqual(t, seen, []string{"service_1"})
+
+	optional := false
+	p.Services[0].DependsOn = map[string]ServiceDependency{"undefined": {Condition: ServiceConditionStarted, Required: &optional}}
+	seen = []string{}
+	err = p.WithServices([]string{"service_1"}, func(service ServiceConfig) error {
+		seen = append(seen, service.Name)
+		return nil
+	}, IncludeDependencies)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, seen, []string{"service_1"})
+}
+
+func TestMarshalYAMLCanonical(t *testing.T) {
+	p := Project{
+		Name: "canonical",
+		Services: Services{
+			{
+				Name:    "web",
+				Image:   "nginx",
+				Command: ShellCommand{"nginx", "-g", "daemon off;"},
+				Labels:  Labels{"zzz": "true", "aaa": "1"},
+				Ports:   []ServicePortConfig{{Target: 80, Published: "8080", Protocol: "tcp"}},
+			},
+			{
+				Name:  "db",
+				Image: "postgres",
+			},
+		},
+		Volumes:    Volumes{"data": VolumeConfig{Name: "data"}},
+		Secrets:    Secrets{"token": SecretConfig{Name: "token", File: "/token"}},
+		Extensions: Extensions{"x-foo": "bar"},
+	}
+	b, err := p.MarshalYAMLCanonical()
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), `name: canonical
+services:
+  db:
+    image: postgres
+  web:
+    command:
+      - nginx
+      - -g
+      - daemon off;
+    image: nginx
+    labels:
+      aaa: "1"
+      zzz: "true"
+    ports:
+      - target: 80
+        published: "8080"
+        protocol: tcp
+volumes:
+  data:
+    name: data
+secrets:
+  token:
+    name: token
+    file: /token
+x-foo: bar
+`)
+
+	again, err := p.MarshalYAMLCanonical()
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), string(again))
+}
+
+func TestWriteFile(t *testing.T) {
+	p := Project{
+		Name:     "write",
+		Services: Services{{Name: "web", Image: "nginx"}},
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nested", "compose.yaml")
+	assert.NilError(t, p.WriteFile(path, 0o640))
+
+	b, err := os.ReadFile(path)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "name: write\nservices:\n  web:\n    image: nginx\n")
+	info, err := os.Stat(path)
+	assert.NilError(t, err)
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(0o640))
+
+	p.Services[0].Image = "httpd"
+	assert.NilError(t, p.WriteFile(path, 0o640))
+	b, err = os.ReadFile(path)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "name: write\nservices:\n  web:\n    image: httpd\n")
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 1, "temporary file must not be left behind")
+
+	blocker := filepath.Join(dir, "file")
+	assert.NilError(t, os.WriteFile(blocker, nil, 0o600))
+	err = p.WriteFile(filepath.Join(blocker, "compose.yaml"), 0o640)
+	assert.ErrorContains(t, err, "failed to write "+filepath.Join(blocker, "compose.yaml"))
+}
+
+func TestMarshalJSON(t *testing.T) {
+	replicas := uint64(2)
+	p := Project{
+		Services: Services{
+			{
+				Name:       "web",
+				Image:      "nginx",
+				Entrypoint: ShellCommand{},
+				Labels:     Labels{"zzz": "true", "aaa": "1"},
+				Deploy:     &DeployConfig{Replicas: &replicas},
+			},
+		},
+		Networks: Networks{"front": NetworkConfig{}},
+	}
+	b, err := p.MarshalJSON()
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), `{"services":{"web":{"deploy":{"replicas":2},"entrypoint":[],"image":"nginx","labels":{"aaa":"1","zzz":"true"}}},"networks":{"front":{}}}`)
+
+	b, err = p.MarshalJSONCanonical()
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), `{"networks":{"front":{}},"services":{"web":{"deploy":{"replicas":2},"entrypoint":[],"image":"nginx","labels":{"aaa":"1","zzz":"true"}}}}`)
+}
+
+func TestServiceResolvedEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.env")
+	second := filepath.Join(dir, "second.env")
+	assert.NilError(t, os.WriteFile(first, []byte("FOO=foo_from_first\nBAR=bar_from_first\nQIX=$HOST_VAR"), 0o600))
+	assert.NilError(t, os.WriteFile(second, []byte("BAR=bar_from_second\nBAZ=${FOO}_again"), 0o600))
+
+	service := ServiceConfig{
+		Name: "test",
+		EnvFile: []EnvFile{
+			{Path: first, Required: true},
+			{Path: second, Required: true},
+			{Path: filepath.Join(dir, "missing.env"), Required: false},
+		},
+		Environment: MappingWithEquals{
+			"BAZ":      strPtr("baz_from_service"),
+			"HOST_VAR": nil,
+		},
+	}
+	environment, err := service.ResolvedEnvironment(Mapping{"HOST_VAR": "from_host"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, environment, MappingWithEquals{
+		"FOO":      strPtr("foo_from_first"),
+		"BAR":      strPtr("bar_from_second"),
+		"BAZ":      strPtr("baz_from_service"),
+		"QIX":      strPtr("from_host"),
+		"HOST_VAR": strPtr("from_host"),
+	})
+	assert.Check(t, service.Environment["HOST_VAR"] == nil, "service environment must not be modified")
+
+	service.EnvFile = []EnvFile{{Path: filepath.Join(dir, "missing.env"), Required: true}}
+	_, err = service.ResolvedEnvironment(nil)
+	assert.ErrorContains(t, err, "Failed to load")
+}
+
+func strPtr(val string) *string {
+	return &val
+}
+
+func TestWithSelectedServices(t *testing.T) {
+	p := makeProject()
+	p.Services[0].Networks = map[string]*ServiceNetworkConfig{"front": nil}
+	p.Services[1].Volumes = []ServiceVolumeConfig{{Type: VolumeTypeVolume, Source: "data", Target: "/data"}}
+	p.Services[1].Secrets = []ServiceSecretConfig{{Source: "token"}}
+	p.Services[2].Configs = []ServiceConfigObjConfig{{Source: "settings"}}
+	p.Networks = Networks{"front": NetworkConfig{}, "back": NetworkConfig{}}
+	p.Volumes = Volumes{"data": VolumeConfig{}}
+	p.Secrets = Secrets{"token": SecretConfig{}}
+	p.Configs = Configs{"settings": ConfigObjConfig{}}
+
+	selected, err := p.WithSelectedServices([]string{"service_2"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, selected.ServiceNames(), []string{"service_1", "service_2"})
+	assert.DeepEqual(t, selected.NetworkNames(), []string{"front"})
+	assert.DeepEqual(t, selected.VolumeNames(), []string{"data"})
+	assert.DeepEqual(t, selected.SecretNames(), []string{"token"})
+	assert.Equal(t, len(selected.Configs), 0)
+
+	selected, err = p.WithSelectedServices([]string{"service_2"}, IgnoreDependencies)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, selected.ServiceNames(), []string{"service_2"})
+	assert.Equal(t, len(selected.Networks), 0)
+
+	// original project is left unchanged
+	assert.Equal(t, len(p.Services), 5)
+	assert.Equal(t, len(p.Networks), 2)
+	assert.Equal(t, len(p.Configs), 1)
+}
+
+func TestGetService(t *testing.T) {
+	p := makeProject()
+	p.ApplyProfiles([]string{"foo"})
+
+	s, err := p.GetService("service_2")
+	assert.NilError(t, err)
+	assert.Equal(t, s.Name, "service_2")
+	assert.Equal(t, p.MustGetService("service_1").Name, "service_1")
+
+	_, err = p.GetService("missing")
+	assert.Check(t, errdefs.IsNotFoundError(err))
+	assert.Error(t, err, "no such service: missing (available services: service_1, service_2)")
+	var notFound *NotFoundError
+	assert.Assert(t, errors.As(err, &notFound))
+	assert.Equal(t, notFound.Name, "missing")
+
+	_, err = p.GetService("service_4")
+	assert.Error(t, err, "no such service: service_4, it is only enabled by profiles zot (available services: service_1, service_2)")
+
+	services, err := p.GetServices("service_1", "missing")
+	assert.Check(t, errdefs.IsNotFoundError(err))
+	assert.Check(t, services == nil)
+
+	assert.Assert(t, cmp.Panics(func() { p.MustGetService("missing") }))
+}
+
+func TestServicesByLabel(t *testing.T) {
+	p := &Project{
+		Services: Services{
+			{Name: "web", Labels: Labels{"tier": "frontend", "team": "a"}},
+			{Name: "api", Labels: Labels{"tier": "backend", "team": "a"}},
+			{Name: "admin", Labels: Labels{"tier": "backend"}, CustomLabels: Labels{"tier": "frontend"}},
+			{Name: "db", CustomLabels: Labels{"team": "b"}},
+		},
+		DisabledServices: Services{
+			{Name: "debug", Labels: Labels{"tier": "frontend"}},
+		},
+	}
+	names := func(services Services) []string {
+		var names []string
+		for _, s := range services {
+			names = append(names, s.Name)
+		}
+		return names
+	}
+	assert.DeepEqual(t, names(p.ServicesByLabel("tier", "frontend")), []string{"web", "admin"})
+	assert.DeepEqual(t, names(p.ServicesByLabel("tier", "backend")), []string{"api"})
+	assert.DeepEqual(t, names(p.ServicesByLabel("team", "a")), []string{"web", "api"})
+	assert.DeepEqual(t, names(p.ServicesByLabel("team", "b")), []string{"db"})
+	assert.Check(t, cmp.Len(p.ServicesByLabel("tier", "unknown"), 0))
+
+	assert.DeepEqual(t, p.ServiceLabels("admin"), Labels{"tier": "frontend"})
+	assert.DeepEqual(t, p.ServiceLabels("web"), Labels{"tier": "frontend", "team": "a"})
+	assert.Check(t, cmp.Nil(p.ServiceLabels("debug")))
+	// the service labels are left unchanged
+	assert.DeepEqual(t, p.Services[2].Labels, Labels{"tier": "backend"})
+}
+
+func TestProjectHash(t *testing.T) {
+	project := func(workingDir string, services ...ServiceConfig) *Project {
+		return &Project{
+			Name:       "hash",
+			WorkingDir: workingDir,
+			Services:   services,
+			Networks:   Networks{"front": {Name: "hash_front"}, "back": {Name: "hash_back"}},
+		}
+	}
+	web := ServiceConfig{
+		Name:  "web",
+		Image: "nginx",
+		Build: &BuildConfig{Context: filepath.Join("/src/app", "web")},
+	}
+	db := ServiceConfig{Name: "db", Image: "postgres", Environment: MappingWithEquals{"A": nil, "B": nil}}
+
+	hash, err := project("/src/app", web, db).Hash()
+	assert.NilError(t, err)
+	assert.Check(t, cmp.Regexp("^sha256:[0-9a-f]{64}$", hash))
+
+	// declaration order doesn't matter
+	same, err := project("/src/app", db, web).Hash()
+	assert.NilError(t, err)
+	assert.Equal(t, same, hash)
+
+	// paths are relative to the working directory, unless IncludePaths is set
+	moved := web
+	moved.Build = &BuildConfig{Context: filepath.Join("/tmp/app", "web")}
+	same, err = project("/tmp/app", moved, db).Hash()
+	assert.NilError(t, err)
+	assert.Equal(t, same, hash)
+	withPaths, err := project("/src/app", web, db).Hash(IncludePaths)
+	assert.NilError(t, err)
+	movedWithPaths, err := project("/tmp/app", moved, db).Hash(IncludePaths)
+	assert.NilError(t, err)
+	assert.Check(t, withPaths != movedWithPaths)
+
+	changed := db
+	changed.Image = "postgres:16"
+	other, err := project("/src/app", web, changed).Hash()
+	assert.NilError(t, err)
+	assert.Check(t, other != hash)
 }
@@ -0,0 +1,132 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package types
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/compose-spec/compose-go/errdefs"
+	"github.com/pkg/errors"
+)
+
+// WithExpandedReplicas returns a copy of the project with one service per replica of the services declaring
+// more than one, named `<service>-1`, `<service>-2`, ... Replicas don't set a `container_name`, which would
+// collide, and dependencies on an expanded service are rewired to its replicas: `depends_on` to all of them,
+// `links`, `volumes_from` and `service:` namespaces to the first one, with a link alias set to the service name.
+// When `scale` differs from `deploy.replicas`, `deploy.replicas` is used and a warning is reported, as done by Load.
+// Services with a single replica, or none, are left unchanged. The original project is left unchanged
+func (p *Project) WithExpandedReplicas() (*Project, error) {
+	newProject := p.Clone()
+
+	existing := map[string]bool{}
+	for _, s := range newProject.AllServices() {
+		existing[s.Name] = true
+	}
+	replicas := map[string][]string{}
+	var services Services
+	for _, s := range newProject.Services {
+		count := s.Scale
+		if s.Deploy != nil && s.Deploy.Replicas != nil {
+			if s.Scale != int(*s.Deploy.Replicas) {
+				newProject.WarningMessages = append(newProject.WarningMessages,
+					fmt.Sprintf("service %q declares both `scale: %d` and `deploy.replicas: %d`, `deploy.replicas` is used", s.Name, s.Scale, *s.Deploy.Replicas))
+			}
+			count = int(*s.Deploy.Replicas)
+		}
+		if count <= 1 {
+			services = append(services, s)
+			continue
+		}
+		for i := 1; i <= count; i++ {
+			name := fmt.Sprintf("%s-%d", s.Name, i)
+			if existing[name] {
+				return nil, errors.Wrapf(errdefs.ErrInvalid, "replica %d of service %q conflicts with service %q", i, s.Name, name)
+			}
+			replica := deepCopy(reflect.ValueOf(s)).Interface().(ServiceConfig)
+			replica.Name = name
+			replica.ContainerName = ""
+			replica.Scale = 1
+			one := uint64(1)
+			if replica.Deploy != nil {
+				replica.Deploy.Replicas = &one
+			}
+			replicas[s.Name] = append(replicas[s.Name], name)
+			services = append(services, replica)
+		}
+	}
+	for i, s := range services {
+		services[i] = rewireReplicas(s, replicas)
+	}
+	for i, s := range newProject.DisabledServices {
+		newProject.DisabledServices[i] = rewireReplicas(s, replicas)
+	}
+	newProject.Services = services
+	return newProject, nil
+}
+
+// rewireReplicas updates the dependencies of s on services expanded into replicas
+func rewireReplicas(s ServiceConfig, replicas map[string][]string) ServiceConfig {
+	if len(replicas) == 0 {
+		return s
+	}
+	if s.DependsOn != nil {
+		dependsOn := DependsOnConfig{}
+		for name, dependency := range s.DependsOn {
+			names, ok := replicas[name]
+			if !ok {
+				dependsOn[name] = dependency
+				continue
+			}
+			for _, replica := range names {
+				dependsOn[replica] = dependency
+			}
+		}
+		s.DependsOn = dependsOn
+	}
+	for i, link := range s.Links {
+		name, alias, ok := strings.Cut(link, ":")
+		if names, expanded := replicas[name]; expanded {
+			if !ok {
+				alias = name
+			}
+			s.Links[i] = names[0] + ":" + alias
+		}
+	}
+	for _, namespace := range []*string{&s.NetworkMode, &s.Ipc, &s.Pid, &s.Uts, &s.Cgroup} {
+		if !strings.HasPrefix(*namespace, ServicePrefix) {
+			continue
+		}
+		if names, ok := replicas[(*namespace)[len(ServicePrefix):]]; ok {
+			*namespace = ServicePrefix + names[0]
+		}
+	}
+	for i, vol := range s.VolumesFrom {
+		if strings.HasPrefix(vol, ContainerPrefix) {
+			continue
+		}
+		name, mode, ok := strings.Cut(vol, ":")
+		if names, expanded := replicas[name]; expanded {
+			s.VolumesFrom[i] = names[0]
+			if ok {
+				s.VolumesFrom[i] += ":" + mode
+			}
+		}
+	}
+	return s
+}
@@ -0,0 +1,110 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+
+	"github.com/compose-spec/compose-go/errdefs"
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+)
+
+func TestWithExpandedReplicas(t *testing.T) {
+	three := uint64(3)
+	two := uint64(2)
+	p := &Project{
+		Services: Services{
+			{
+				Name:          "db",
+				ContainerName: "database",
+				Scale:         2,
+				Deploy:        &DeployConfig{Replicas: &two},
+				Labels:        Labels{"tier": "data"},
+			},
+			{
+				Name:        "web",
+				Scale:       2,
+				Deploy:      &DeployConfig{Replicas: &three},
+				DependsOn:   DependsOnConfig{"db": {Condition: ServiceConditionHealthy}},
+				Links:       []string{"db"},
+				VolumesFrom: []string{"db:ro"},
+			},
+			{
+				Name:        "proxy",
+				Scale:       1,
+				NetworkMode: "service:db",
+			},
+		},
+	}
+	expanded, err := p.WithExpandedReplicas()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, expanded.ServiceNames(), []string{"db-1", "db-2", "proxy", "web-1", "web-2", "web-3"})
+	assert.DeepEqual(t, expanded.Warnings(), []string{
+		"service \"web\" declares both `scale: 2` and `deploy.replicas: 3`, `deploy.replicas` is used",
+	})
+
+	db := expanded.MustGetService("db-2")
+	assert.Equal(t, db.ContainerName, "")
+	assert.Equal(t, *db.Deploy.Replicas, uint64(1))
+	db.Labels["tier"] = "changed"
+	assert.Equal(t, expanded.MustGetService("db-1").Labels["tier"], "data")
+
+	web := expanded.MustGetService("web-1")
+	assert.DeepEqual(t, web.DependsOn, DependsOnConfig{
+		"db-1": {Condition: ServiceConditionHealthy},
+		"db-2": {Condition: ServiceConditionHealthy},
+	})
+	assert.DeepEqual(t, web.Links, []string{"db-1:db"})
+	assert.DeepEqual(t, web.VolumesFrom, []string{"db-1:ro"})
+	assert.Equal(t, expanded.MustGetService("proxy").NetworkMode, "service:db-1")
+	_, err = expanded.DependencyGraph()
+	assert.NilError(t, err)
+
+	// the original project is left unchanged
+	assert.DeepEqual(t, p.ServiceNames(), []string{"db", "proxy", "web"})
+	assert.Equal(t, p.MustGetService("db").ContainerName, "database")
+	assert.DeepEqual(t, p.MustGetService("web").Links, []string{"db"})
+	assert.Check(t, is.Len(p.Warnings(), 0))
+}
+
+func TestWithExpandedReplicasScaleZero(t *testing.T) {
+	two := uint64(2)
+	p := &Project{
+		Services: Services{
+			{Name: "worker", Scale: 0, Deploy: &DeployConfig{Replicas: &two}},
+		},
+	}
+	expanded, err := p.WithExpandedReplicas()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, expanded.ServiceNames(), []string{"worker-1", "worker-2"})
+	assert.DeepEqual(t, expanded.Warnings(), []string{
+		"service \"worker\" declares both `scale: 0` and `deploy.replicas: 2`, `deploy.replicas` is used",
+	})
+}
+
+func TestWithExpandedReplicasConflict(t *testing.T) {
+	p := &Project{
+		Services: Services{
+			{Name: "db", Scale: 2},
+			{Name: "db-2"},
+		},
+	}
+	_, err := p.WithExpandedReplicas()
+	assert.Check(t, errdefs.IsInvalidError(err))
+	assert.ErrorContains(t, err, `replica 2 of service "db" conflicts with service "db-2"`)
+}
@@ -0,0 +1,79 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package types
+
+import (
+	"strconv"
+)
+
+// ResourceSummary is the CPU and memory required by a project, summed over its services and their replicas
+type ResourceSummary struct {
+	LimitsCPUs         float64
+	LimitsMemory       UnitBytes
+	ReservationsCPUs   float64
+	ReservationsMemory UnitBytes
+	// Unlimited lists the services which don't limit CPU or memory, counted as zero in the limits totals
+	Unlimited []string
+	// Unreserved lists the services which don't reserve CPU or memory, counted as zero in the reservations totals
+	Unreserved []string
+}
+
+// ResourceTotals sums the `deploy.resources` limits and reservations of the services enabled by profiles,
+// multiplied by their `deploy.replicas`, which is 1 if not set
+func (p *Project) ResourceTotals(profiles []string) ResourceSummary {
+	var summary ResourceSummary
+	for _, s := range p.AllServices() {
+		if !s.HasProfile(profiles) {
+			continue
+		}
+		replicas := 1.0
+		var resources Resources
+		if s.Deploy != nil {
+			if s.Deploy.Replicas != nil {
+				replicas = float64(*s.Deploy.Replicas)
+			}
+			resources = s.Deploy.Resources
+		}
+
+		cpus, memory := resourceAmounts(resources.Limits)
+		if cpus == 0 || memory == 0 {
+			summary.Unlimited = append(summary.Unlimited, s.Name)
+		}
+		summary.LimitsCPUs += cpus * replicas
+		summary.LimitsMemory += UnitBytes(float64(memory) * replicas)
+
+		cpus, memory = resourceAmounts(resources.Reservations)
+		if cpus == 0 || memory == 0 {
+			summary.Unreserved = append(summary.Unreserved, s.Name)
+		}
+		summary.ReservationsCPUs += cpus * replicas
+		summary.ReservationsMemory += UnitBytes(float64(memory) * replicas)
+	}
+	return summary
+}
+
+// resourceAmounts returns the CPUs and memory of a resource, which are zero if not set or invalid
+func resourceAmounts(r *Resource) (float64, UnitBytes) {
+	if r == nil {
+		return 0, 0
+	}
+	cpus, err := strconv.ParseFloat(r.NanoCPUs, 64)
+	if err != nil {
+		cpus = 0
+	}
+	return cpus, r.MemoryBytes
+}
@@ -0,0 +1,75 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package types
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestResourceTotals(t *testing.T) {
+	replicas := uint64(3)
+	p := &Project{
+		Services: Services{
+			{
+				Name: "web",
+				Deploy: &DeployConfig{
+					Replicas: &replicas,
+					Resources: Resources{
+						Limits:       &Resource{NanoCPUs: "0.5", MemoryBytes: 256 * 1024 * 1024},
+						Reservations: &Resource{NanoCPUs: "0.25", MemoryBytes: 128 * 1024 * 1024},
+					},
+				},
+			},
+			{
+				Name: "db",
+				Deploy: &DeployConfig{
+					Resources: Resources{
+						Limits: &Resource{NanoCPUs: "1.5", MemoryBytes: 1024 * 1024 * 1024},
+					},
+				},
+			},
+			{Name: "cache"},
+		},
+		DisabledServices: Services{
+			{
+				Name:     "debug",
+				Profiles: []string{"debug"},
+				Deploy: &DeployConfig{
+					Resources: Resources{
+						Limits: &Resource{NanoCPUs: "2", MemoryBytes: 512 * 1024 * 1024},
+					},
+				},
+			},
+		},
+	}
+
+	assert.DeepEqual(t, p.ResourceTotals(nil), ResourceSummary{
+		LimitsCPUs:         3,
+		LimitsMemory:       (3*256 + 1024) * 1024 * 1024,
+		ReservationsCPUs:   0.75,
+		ReservationsMemory: 3 * 128 * 1024 * 1024,
+		Unlimited:          []string{"cache"},
+		Unreserved:         []string{"db", "cache"},
+	})
+
+	summary := p.ResourceTotals([]string{"debug"})
+	assert.Equal(t, summary.LimitsCPUs, 5.0)
+	assert.Equal(t, summary.LimitsMemory, UnitBytes((3*256+1024+512)*1024*1024))
+	assert.DeepEqual(t, summary.Unreserved, []string{"db", "cache", "debug"})
+}
@@ -17,13 +17,24 @@
 package types
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/fs"
+	"math"
+	"net"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/compose-spec/compose-go/dotenv"
+	"github.com/compose-spec/compose-go/utils"
+	"github.com/distribution/distribution/v3/reference"
 	"github.com/docker/go-connections/nat"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
 )
 
 // Duration is a thin wrapper around time.Duration with improved JSON marshalling
@@ -47,21 +58,69 @@ func (d Duration) MarshalJSON() ([]byte, error) {
 	return json.Marshal(d.String())
 }
 
-// MarshalYAML makes Duration implement yaml.Marshaler
+// MarshalYAML makes Duration implement yaml.Marshaler, using the canonical shortest form, like `1m30s` or `1h`
 func (d Duration) MarshalYAML() (interface{}, error) {
-	return d.String(), nil
+	return d.canonical(), nil
+}
+
+// canonical formats the duration without the zero components time.Duration.String() includes, like `1h0m0s`
+func (d Duration) canonical() string {
+	td := time.Duration(d)
+	if td == 0 {
+		return "0s"
+	}
+	if td > -time.Second && td < time.Second {
+		return strings.Replace(td.String(), "µs", "us", 1)
+	}
+	var b strings.Builder
+	if td < 0 {
+		b.WriteString("-")
+		td = -td
+	}
+	if h := td / time.Hour; h > 0 {
+		fmt.Fprintf(&b, "%dh", h)
+		td -= h * time.Hour
+	}
+	if m := td / time.Minute; m > 0 {
+		fmt.Fprintf(&b, "%dm", m)
+		td -= m * time.Minute
+	}
+	if td > 0 {
+		b.WriteString(strings.Replace(td.String(), "µs", "us", 1))
+	}
+	return b.String()
+}
+
+// UnmarshalYAML makes Duration implement yaml.Unmarshaler
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	parsed, err := ParseDuration(value.Value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
 }
 
 func (d *Duration) UnmarshalJSON(b []byte) error {
 	s := strings.Trim(string(b), "\"")
-	timeDuration, err := time.ParseDuration(s)
+	parsed, err := ParseDuration(s)
 	if err != nil {
 		return err
 	}
-	*d = Duration(timeDuration)
+	*d = parsed
 	return nil
 }
 
+// ParseDuration parses a compose duration, a sequence of numbers with optional fraction and a unit
+// among `us`, `ms`, `s`, `m` and `h`, like `1m30s` or `1.5h`
+func ParseDuration(s string) (Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.Errorf("invalid duration %q, expected a number with one of the us, ms, s, m or h units, like 1m30s", s)
+	}
+	return Duration(d), nil
+}
+
 // Services is a list of ServiceConfig
 type Services []ServiceConfig
 
@@ -88,6 +147,7 @@ type ServiceConfig struct {
 	Name     string   `yaml:"-" json:"-"`
 	Profiles []string `mapstructure:"profiles" yaml:"profiles,omitempty" json:"profiles,omitempty"`
 
+	Annotations  Labels       `yaml:",omitempty" json:"annotations,omitempty"`
 	Build        *BuildConfig `yaml:",omitempty" json:"build,omitempty"`
 	BlkioConfig  *BlkioConfig `mapstructure:"blkio_config" yaml:",omitempty" json:"blkio_config,omitempty"`
 	CapAdd       []string     `mapstructure:"cap_add" yaml:"cap_add,omitempty" json:"cap_add,omitempty"`
@@ -109,12 +169,15 @@ type ServiceConfig struct {
 	//
 	// Set to `[]` or an empty string to clear the command from the image.
 	Command ShellCommand `yaml:",omitempty" json:"command"` // NOTE: we can NOT omitempty for JSON! see ShellCommand type for details.
+	// CommandForm is the form Command was declared with, a string being split into words by the loader
+	CommandForm CommandForm `mapstructure:"-" yaml:"-" json:"-"`
 
 	Configs           []ServiceConfigObjConfig `yaml:",omitempty" json:"configs,omitempty"`
 	ContainerName     string                   `mapstructure:"container_name" yaml:"container_name,omitempty" json:"container_name,omitempty"`
 	CredentialSpec    *CredentialSpecConfig    `mapstructure:"credential_spec" yaml:"credential_spec,omitempty" json:"credential_spec,omitempty"`
 	DependsOn         DependsOnConfig          `mapstructure:"depends_on" yaml:"depends_on,omitempty" json:"depends_on,omitempty"`
 	Deploy            *DeployConfig            `yaml:",omitempty" json:"deploy,omitempty"`
+	Develop           *DevelopConfig           `yaml:",omitempty" json:"develop,omitempty"`
 	DeviceCgroupRules []string                 `mapstructure:"device_cgroup_rules" yaml:"device_cgroup_rules,omitempty" json:"device_cgroup_rules,omitempty"`
 	Devices           []string                 `yaml:",omitempty" json:"devices,omitempty"`
 	DNS               StringList               `yaml:",omitempty" json:"dns,omitempty"`
@@ -128,13 +191,16 @@ type ServiceConfig struct {
 	//
 	// Set to `[]` or an empty string to clear the entrypoint from the image.
 	Entrypoint ShellCommand `yaml:"entrypoint,omitempty" json:"entrypoint"` // NOTE: we can NOT omitempty for JSON! see ShellCommand type for details.
+	// EntrypointForm is the form Entrypoint was declared with, a string being split into words by the loader
+	EntrypointForm CommandForm `mapstructure:"-" yaml:"-" json:"-"`
 
 	Environment     MappingWithEquals                `yaml:",omitempty" json:"environment,omitempty"`
-	EnvFile         StringList                       `mapstructure:"env_file" yaml:"env_file,omitempty" json:"env_file,omitempty"`
+	EnvFile         []EnvFile                        `mapstructure:"env_file" yaml:"env_file,omitempty" json:"env_file,omitempty"`
 	Expose          StringOrNumberList               `yaml:",omitempty" json:"expose,omitempty"`
 	Extends         *ExtendsConfig                   `yaml:"extends,omitempty" json:"extends,omitempty"`
 	ExternalLinks   []string                         `mapstructure:"external_links" yaml:"external_links,omitempty" json:"external_links,omitempty"`
 	ExtraHosts      HostsList                        `mapstructure:"extra_hosts" yaml:"extra_hosts,omitempty" json:"extra_hosts,omitempty"`
+	Gpus            GpusConfig                       `yaml:",omitempty" json:"gpus,omitempty"`
 	GroupAdd        []string                         `mapstructure:"group_add" yaml:"group_add,omitempty" json:"group_add,omitempty"`
 	Hostname        string                           `yaml:",omitempty" json:"hostname,omitempty"`
 	HealthCheck     *HealthCheckConfig               `yaml:",omitempty" json:"healthcheck,omitempty"`
@@ -229,6 +295,60 @@ const (
 	PullPolicyBuild = "build"
 )
 
+// ParsePullPolicy validates a service `pull_policy` attribute, and returns its canonical value: `if_not_present`
+// is a synonym of `missing`. An empty policy is left unset
+func ParsePullPolicy(policy string) (string, error) {
+	switch policy {
+	case "", PullPolicyAlways, PullPolicyNever, PullPolicyMissing, PullPolicyBuild:
+		return policy, nil
+	case PullPolicyIfNotPresent:
+		return PullPolicyMissing, nil
+	default:
+		return "", fmt.Errorf("invalid pull policy %q, expected one of %s, %s, %s or %s", policy,
+			PullPolicyAlways, PullPolicyNever, PullPolicyMissing, PullPolicyBuild)
+	}
+}
+
+// signals are the names of the signals a container can be stopped with, without their `SIG` prefix
+var signals = map[string]bool{
+	"ABRT": true, "ALRM": true, "BUS": true, "CHLD": true, "CLD": true, "CONT": true, "FPE": true, "HUP": true,
+	"ILL": true, "INT": true, "IO": true, "IOT": true, "KILL": true, "PIPE": true, "POLL": true, "PROF": true,
+	"PWR": true, "QUIT": true, "SEGV": true, "STKFLT": true, "STOP": true, "SYS": true, "TERM": true, "TRAP": true,
+	"TSTP": true, "TTIN": true, "TTOU": true, "URG": true, "USR1": true, "USR2": true, "VTALRM": true,
+	"WINCH": true, "XCPU": true, "XFSZ": true, "RTMIN": true, "RTMAX": true,
+}
+
+// maxSignal is the highest signal number supported by Linux
+const maxSignal = 64
+
+var realtimeSignal = regexp.MustCompile(`^RT(MIN\+|MAX-)([0-9]+)$`)
+
+// ParseSignal validates a service `stop_signal` attribute, and returns its canonical value: signal names are
+// upper-cased and `SIG`-prefixed, like `SIGTERM` for `term`, signal numbers are kept as is. An empty signal is
+// left unset
+func ParseSignal(signal string) (string, error) {
+	if signal == "" {
+		return "", nil
+	}
+	if n, err := strconv.Atoi(signal); err == nil {
+		if n <= 0 || n > maxSignal {
+			return "", fmt.Errorf("invalid signal %q, signal number must be between 1 and %d", signal, maxSignal)
+		}
+		return strconv.Itoa(n), nil
+	}
+	name := strings.TrimPrefix(strings.ToUpper(signal), "SIG")
+	if !signals[name] {
+		m := realtimeSignal.FindStringSubmatch(name)
+		if m == nil {
+			return "", fmt.Errorf("invalid signal %q", signal)
+		}
+		if n, _ := strconv.Atoi(m[2]); n > maxSignal-34 {
+			return "", fmt.Errorf("invalid signal %q, real-time signal offset must be at most %d", signal, maxSignal-34)
+		}
+	}
+	return "SIG" + name, nil
+}
+
 const (
 	// RestartPolicyAlways always restart the container if it stops
 	RestartPolicyAlways = "always"
@@ -240,6 +360,94 @@ const (
 	RestartPolicyUnlessStopped = "unless-stopped"
 )
 
+// ServiceRestartPolicy is the parsed form of a service `restart` attribute, like `on-failure:3`
+type ServiceRestartPolicy struct {
+	Policy string
+	// MaxRetries is the maximum number of restarts attempted by the `on-failure` policy, unlimited when nil
+	MaxRetries *int
+}
+
+// maxCPU is the highest CPU number supported by Linux, which runs on up to 8192 CPUs
+const maxCPU = 8191
+
+// ParseCPUSet parses a service `cpuset` attribute, a comma-separated list of CPU numbers and inclusive ranges of
+// CPU numbers like `0-3,5`, and returns the sorted CPU numbers it selects
+func ParseCPUSet(cpuset string) ([]int, error) {
+	if cpuset == "" {
+		return nil, nil
+	}
+	selected := map[int]bool{}
+	for _, item := range strings.Split(cpuset, ",") {
+		first, last, isRange := strings.Cut(item, "-")
+		start, err := parseCPU(cpuset, first)
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if isRange {
+			if end, err = parseCPU(cpuset, last); err != nil {
+				return nil, err
+			}
+			if end < start {
+				return nil, fmt.Errorf("invalid cpuset %q, range %s must not be reversed", cpuset, item)
+			}
+		}
+		for cpu := start; cpu <= end; cpu++ {
+			selected[cpu] = true
+		}
+	}
+	cpus := make([]int, 0, len(selected))
+	for cpu := range selected {
+		cpus = append(cpus, cpu)
+	}
+	sort.Ints(cpus)
+	return cpus, nil
+}
+
+func parseCPU(cpuset, cpu string) (int, error) {
+	n, err := strconv.Atoi(cpu)
+	if err != nil || n < 0 || strings.HasPrefix(cpu, "+") {
+		return 0, fmt.Errorf("invalid cpuset %q, expected a list of CPU numbers or ranges like 0-3,5", cpuset)
+	}
+	if n > maxCPU {
+		return 0, fmt.Errorf("invalid cpuset %q, CPU %d exceeds the maximum of %d", cpuset, n, maxCPU)
+	}
+	return n, nil
+}
+
+// ParseRestartPolicy parses a service `restart` attribute. The policy must be one of `no`, `always`, `on-failure`
+// or `unless-stopped`, only `on-failure` accepts a maximum retry count
+func ParseRestartPolicy(restart string) (ServiceRestartPolicy, error) {
+	policy, retries, hasRetries := strings.Cut(restart, ":")
+	switch policy {
+	case RestartPolicyNo, RestartPolicyAlways, RestartPolicyOnFailure, RestartPolicyUnlessStopped:
+	default:
+		return ServiceRestartPolicy{}, fmt.Errorf("invalid restart policy %q, expected one of %s, %s, %s or %s", restart,
+			RestartPolicyNo, RestartPolicyAlways, RestartPolicyOnFailure, RestartPolicyUnlessStopped)
+	}
+	p := ServiceRestartPolicy{Policy: policy}
+	if !hasRetries {
+		return p, nil
+	}
+	if policy != RestartPolicyOnFailure {
+		return ServiceRestartPolicy{}, fmt.Errorf("invalid restart policy %q, maximum retry count is only supported by %s", restart, RestartPolicyOnFailure)
+	}
+	n, err := strconv.Atoi(retries)
+	if err != nil || n < 0 {
+		return ServiceRestartPolicy{}, fmt.Errorf("invalid restart policy %q, maximum retry count must be a positive integer", restart)
+	}
+	p.MaxRetries = &n
+	return p, nil
+}
+
+// String returns the `restart` attribute value for the policy
+func (p ServiceRestartPolicy) String() string {
+	if p.MaxRetries == nil {
+		return p.Policy
+	}
+	return fmt.Sprintf("%s:%d", p.Policy, *p.MaxRetries)
+}
+
 const (
 	// ServicePrefix is the prefix for references pointing to a service
 	ServicePrefix = "service:"
@@ -254,6 +462,94 @@ const (
 	NetworkModeContainerPrefix = ContainerPrefix
 )
 
+const (
+	// NetworkModeDefault is the kind of a service attached to networks, which is the case when `network_mode` is
+	// not set, or set to a network driver like `bridge`
+	NetworkModeDefault = "default"
+	// NetworkModeHost is the kind of a service using the host's network stack
+	NetworkModeHost = "host"
+	// NetworkModeNone is the kind of a service with networking disabled
+	NetworkModeNone = "none"
+	// NetworkModeService is the kind of a service sharing the network stack of another service of the project
+	NetworkModeService = "service"
+	// NetworkModeContainer is the kind of a service sharing the network stack of a container, which isn't managed
+	// by compose
+	NetworkModeContainer = "container"
+)
+
+// NetworkModeKind parses the service `network_mode` attribute into its kind, one of NetworkModeDefault,
+// NetworkModeHost, NetworkModeNone, NetworkModeService or NetworkModeContainer, and the service or container it
+// refers to. For the default kind, target is the raw `network_mode` value, if any
+func (s ServiceConfig) NetworkModeKind() (kind string, target string) {
+	switch {
+	case s.NetworkMode == NetworkModeHost:
+		return NetworkModeHost, ""
+	case s.NetworkMode == NetworkModeNone:
+		return NetworkModeNone, ""
+	case strings.HasPrefix(s.NetworkMode, ServicePrefix):
+		return NetworkModeService, s.NetworkMode[len(ServicePrefix):]
+	case strings.HasPrefix(s.NetworkMode, ContainerPrefix):
+		return NetworkModeContainer, s.NetworkMode[len(ContainerPrefix):]
+	default:
+		return NetworkModeDefault, s.NetworkMode
+	}
+}
+
+// ResolvedEnvironment computes the effective service environment: env_file entries are loaded in order, later files
+// overriding earlier ones, then environment overrides them. Variables declared without a value are resolved from hostEnv.
+// A missing env_file is reported as an error, unless it is declared with `required: false`
+func (s ServiceConfig) ResolvedEnvironment(hostEnv Mapping) (MappingWithEquals, error) {
+	return s.resolveEnvironment(nil, hostEnv)
+}
+
+func (s ServiceConfig) resolveEnvironment(fsys fs.FS, hostEnv Mapping) (MappingWithEquals, error) {
+	environment := MappingWithEquals{}
+	// resolve variables based on other files we already parsed, + host environment
+	var resolve dotenv.LookupFn = func(s string) (string, bool) {
+		v, ok := environment[s]
+		if ok && v != nil {
+			return *v, ok
+		}
+		return hostEnv.Resolve(s)
+	}
+
+	for _, envFile := range s.EnvFile {
+		b, err := utils.ReadFile(fsys, envFile.Path)
+		if err != nil {
+			if !envFile.Required && errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, errors.Wrapf(err, "Failed to load %s", envFile.Path)
+		}
+
+		fileVars, err := dotenv.ParseWithLookup(bytes.NewBuffer(b), resolve)
+		if err != nil {
+			return nil, err
+		}
+		environment.OverrideBy(Mapping(fileVars).ToMappingWithEquals())
+	}
+
+	declared := MappingWithEquals{}
+	for k, v := range s.Environment {
+		declared[k] = v
+	}
+	return environment.OverrideBy(declared.Resolve(hostEnv.Resolve)), nil
+}
+
+// GetImageName returns the fully qualified name of the image used by the service, like `docker.io/library/nginx:latest`.
+// Without an explicit `image`, this is the `projectName-serviceName` image Docker Compose builds
+func (s ServiceConfig) GetImageName(projectName string) string {
+	name := s.Image
+	if name == "" {
+		name = projectName + "-" + s.Name
+	}
+	named, err := reference.ParseDockerRef(name)
+	if err != nil {
+		return name
+	}
+	return named.String()
+}
+
 // GetDependencies retrieves all services this service depends on
 func (s ServiceConfig) GetDependencies() []string {
 	var dependencies []string
@@ -401,6 +697,31 @@ type StringList []string
 // numbers
 type StringOrNumberList []string
 
+// EnvFile is a file to load service environment variables from
+type EnvFile struct {
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+	// Required is false when the file is allowed to be missing
+	Required bool `yaml:"required" json:"required"`
+}
+
+// MarshalYAML makes EnvFile implement yaml.Marshaller, using the short syntax for required files
+func (e EnvFile) MarshalYAML() (interface{}, error) {
+	if e.Required {
+		return e.Path, nil
+	}
+	type envFile EnvFile
+	return envFile(e), nil
+}
+
+// MarshalJSON makes EnvFile implement json.Marshaller, using the short syntax for required files
+func (e EnvFile) MarshalJSON() ([]byte, error) {
+	if e.Required {
+		return json.Marshal(e.Path)
+	}
+	type envFile EnvFile
+	return json.Marshal(envFile(e))
+}
+
 // MappingWithEquals is a mapping type that can be converted from a list of
 // key[=value] strings.
 // For the key with an empty value (`key=`), the mapped value is set to a pointer to `""`.
@@ -536,28 +857,72 @@ func (s SSHKey) MarshalJSON() ([]byte, error) {
 // 'key: value' strings
 type MappingWithColon map[string]string
 
-// HostsList is a list of colon-separated host-ip mappings
-type HostsList map[string]string
+// HostsList is a list of colon-separated host-ip mappings. A host can be mapped to multiple IPs
+type HostsList map[string][]string
 
-// AsList return host-ip mappings as a list of colon-separated strings
+// HostGateway is the special IP an extra host can be mapped to, resolved by the container runtime to the host's IP
+const HostGateway = "host-gateway"
+
+// NewHostsList parses a list of `host:ip` mappings, a host which is listed multiple times gets mapped to all of
+// its IPs, in order
+func NewHostsList(hosts []string) (HostsList, error) {
+	h := HostsList{}
+	for _, entry := range hosts {
+		host, ip, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid extra host %q, expected host:ip", entry)
+		}
+		if err := h.Add(host, ip); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// Add maps host to ip, unless it's already mapped to it. ip must be an IPv4 or IPv6 address, optionally
+// enclosed in square brackets, or HostGateway
+func (h HostsList) Add(host, ip string) error {
+	if host == "" {
+		return fmt.Errorf("invalid extra host %q, host name must not be empty", host+":"+ip)
+	}
+	if strings.HasPrefix(ip, "[") && strings.HasSuffix(ip, "]") {
+		ip = ip[1 : len(ip)-1]
+	}
+	if ip != HostGateway && net.ParseIP(ip) == nil {
+		return fmt.Errorf("invalid IP address %q for extra host %q", ip, host)
+	}
+	for _, existing := range h[host] {
+		if existing == ip {
+			return nil
+		}
+	}
+	h[host] = append(h[host], ip)
+	return nil
+}
+
+// AsList return host-ip mappings as a list of colon-separated strings, sorted by host. A host mapped to multiple
+// IPs is listed once per IP
 func (h HostsList) AsList() []string {
-	l := make([]string, 0, len(h))
-	for k, v := range h {
-		l = append(l, fmt.Sprintf("%s:%s", k, v))
+	hosts := make([]string, 0, len(h))
+	for host := range h {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	var l []string
+	for _, host := range hosts {
+		for _, ip := range h[host] {
+			l = append(l, fmt.Sprintf("%s:%s", host, ip))
+		}
 	}
 	return l
 }
 
 func (h HostsList) MarshalYAML() (interface{}, error) {
-	list := h.AsList()
-	sort.Strings(list)
-	return list, nil
+	return h.AsList(), nil
 }
 
 func (h HostsList) MarshalJSON() ([]byte, error) {
-	list := h.AsList()
-	sort.Strings(list)
-	return json.Marshal(list)
+	return json.Marshal(h.AsList())
 }
 
 // LoggingConfig the logging configuration for a service
@@ -583,6 +948,35 @@ type DeployConfig struct {
 	Extensions Extensions `mapstructure:"#extensions" yaml:",inline" json:"-"`
 }
 
+// DevelopConfig defines the development workflow of a service, as used by Compose Watch
+type DevelopConfig struct {
+	Watch []WatchConfig `yaml:",omitempty" json:"watch,omitempty"`
+
+	Extensions Extensions `mapstructure:"#extensions" yaml:",inline" json:"-"`
+}
+
+// WatchAction is the action taken when a watched path changes
+type WatchAction string
+
+const (
+	// WatchActionSync copies changed files into the service containers
+	WatchActionSync WatchAction = "sync"
+	// WatchActionRebuild rebuilds the service image and recreates the service containers
+	WatchActionRebuild WatchAction = "rebuild"
+	// WatchActionSyncRestart copies changed files into the service containers, then restarts them
+	WatchActionSyncRestart WatchAction = "sync+restart"
+)
+
+// WatchConfig is a rule of the `develop.watch` section
+type WatchConfig struct {
+	Path   string      `yaml:",omitempty" json:"path,omitempty"`
+	Action WatchAction `yaml:",omitempty" json:"action,omitempty"`
+	Target string      `yaml:",omitempty" json:"target,omitempty"`
+	Ignore []string    `yaml:",omitempty" json:"ignore,omitempty"`
+
+	Extensions Extensions `mapstructure:"#extensions" yaml:",inline" json:"-"`
+}
+
 // HealthCheckConfig the healthcheck configuration for a service
 type HealthCheckConfig struct {
 	Test        HealthCheckTest `yaml:",omitempty" json:"test,omitempty"`
@@ -630,13 +1024,21 @@ type Resource struct {
 	Extensions Extensions `mapstructure:"#extensions" yaml:",inline" json:"-"`
 }
 
+// DeviceRequest is a request for devices, like GPUs, to be made available to a service
+// Count is -1 when all devices are requested
 type DeviceRequest struct {
 	Capabilities []string `mapstructure:"capabilities" yaml:"capabilities,omitempty" json:"capabilities,omitempty"`
 	Driver       string   `mapstructure:"driver" yaml:"driver,omitempty" json:"driver,omitempty"`
 	Count        int64    `mapstructure:"count" yaml:"count,omitempty" json:"count,omitempty"`
 	IDs          []string `mapstructure:"device_ids" yaml:"device_ids,omitempty" json:"device_ids,omitempty"`
+	Options      Mapping  `mapstructure:"options" yaml:"options,omitempty" json:"options,omitempty"`
+
+	Extensions Extensions `mapstructure:"#extensions" yaml:",inline" json:"-"`
 }
 
+// GpusConfig is the list of GPU device requests set by a service `gpus` attribute
+type GpusConfig []DeviceRequest
+
 // GenericResource represents a "user defined" resource which can
 // only be an integer (e.g: SSD=3) for a service
 type GenericResource struct {
@@ -659,6 +1061,80 @@ type DiscreteGenericResource struct {
 // UnitBytes is the bytes type
 type UnitBytes int64
 
+// unitBytesSuffixes maps the supported size suffixes, which are case-insensitive, to their multiplier. As in
+// Docker, kilobytes and other units without an `i` are powers of 1024. Binary units may omit the trailing `b`, like
+// Kubernetes quantities such as `300Mi`
+var unitBytesSuffixes = map[string]int64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"ki":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mi":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gi":  1 << 30,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1 << 40,
+	"ti":  1 << 40,
+	"tib": 1 << 40,
+	"p":   1 << 50,
+	"pb":  1 << 50,
+	"pi":  1 << 50,
+	"pib": 1 << 50,
+}
+
+var unitBytesPattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*([a-zA-Z]*)$`)
+
+// ParseUnitBytes parses a size, like `512`, `1.5g` or `1024kb`. Suffixes are binary units, and a size
+// which isn't a whole number of bytes, like `1.5b`, is rejected
+func ParseUnitBytes(size string) (UnitBytes, error) {
+	matches := unitBytesPattern.FindStringSubmatch(strings.TrimSpace(size))
+	if matches == nil {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	multiplier, ok := unitBytesSuffixes[strings.ToLower(matches[2])]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q", size, matches[2])
+	}
+	value, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", size, err)
+	}
+	n := value * float64(multiplier)
+	if n != math.Trunc(n) {
+		return 0, fmt.Errorf("invalid size %q: not a whole number of bytes", size)
+	}
+	if n > math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q: too large", size)
+	}
+	return UnitBytes(n), nil
+}
+
+// UnmarshalYAML makes UnitBytes implement yaml.Unmarshaler, accepting a number of bytes or a size with a unit
+func (u *UnitBytes) UnmarshalYAML(value *yaml.Node) error {
+	var n int64
+	if err := value.Decode(&n); err == nil {
+		*u = UnitBytes(n)
+		return nil
+	}
+	var size string
+	if err := value.Decode(&size); err != nil {
+		return err
+	}
+	parsed, err := ParseUnitBytes(size)
+	if err != nil {
+		return err
+	}
+	*u = parsed
+	return nil
+}
+
 // MarshalYAML makes UnitBytes implement yaml.Marshaller
 func (u UnitBytes) MarshalYAML() (interface{}, error) {
 	return fmt.Sprintf("%d", u), nil
@@ -708,11 +1184,13 @@ type ServiceNetworkConfig struct {
 
 // ServicePortConfig is the port configuration for a service
 type ServicePortConfig struct {
-	Mode      string `yaml:",omitempty" json:"mode,omitempty"`
-	HostIP    string `mapstructure:"host_ip" yaml:"host_ip,omitempty" json:"host_ip,omitempty"`
-	Target    uint32 `yaml:",omitempty" json:"target,omitempty"`
-	Published string `yaml:",omitempty" json:"published,omitempty"`
-	Protocol  string `yaml:",omitempty" json:"protocol,omitempty"`
+	Name        string `yaml:",omitempty" json:"name,omitempty"`
+	Mode        string `yaml:",omitempty" json:"mode,omitempty"`
+	HostIP      string `mapstructure:"host_ip" yaml:"host_ip,omitempty" json:"host_ip,omitempty"`
+	Target      uint32 `yaml:",omitempty" json:"target,omitempty"`
+	Published   string `yaml:",omitempty" json:"published,omitempty"`
+	Protocol    string `yaml:",omitempty" json:"protocol,omitempty"`
+	AppProtocol string `mapstructure:"app_protocol" yaml:"app_protocol,omitempty" json:"app_protocol,omitempty"`
 
 	Extensions Extensions `mapstructure:"#extensions" yaml:",inline" json:"-"`
 }
@@ -756,6 +1234,62 @@ func convertPortToPortConfig(port nat.Port, portBindings map[nat.Port][]nat.Port
 	return portConfigs, nil
 }
 
+// PortBinding is a host port a service publishes, bound to a container port
+type PortBinding struct {
+	HostIP    string
+	Published int
+	Target    uint32
+	Protocol  string
+}
+
+// PublishedPorts lists the host ports published by the service, in declaration order. A range of published ports,
+// like `8000-8010:80`, is flattened into a binding for each host port, though only one of them gets bound by the
+// container runtime. Ports with no published port, or an invalid one, are ignored. The protocol defaults to tcp
+func (s ServiceConfig) PublishedPorts() []PortBinding {
+	var bindings []PortBinding
+	for _, port := range s.Ports {
+		if port.Published == "" {
+			continue
+		}
+		start, end, isRange := strings.Cut(port.Published, "-")
+		if !isRange {
+			end = start
+		}
+		first, err := strconv.ParseUint(start, 10, 16)
+		if err != nil {
+			continue
+		}
+		last, err := strconv.ParseUint(end, 10, 16)
+		if err != nil {
+			continue
+		}
+		protocol := strings.ToLower(port.Protocol)
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		for p := first; p <= last; p++ {
+			bindings = append(bindings, PortBinding{
+				HostIP:    port.HostIP,
+				Published: int(p),
+				Target:    port.Target,
+				Protocol:  protocol,
+			})
+		}
+	}
+	return bindings
+}
+
+// PublishesPort tells if the service publishes a host port for protocol, like tcp or udp. An empty protocol matches
+// any protocol
+func (s ServiceConfig) PublishesPort(host int, protocol string) bool {
+	for _, binding := range s.PublishedPorts() {
+		if binding.Published == host && (protocol == "" || strings.EqualFold(binding.Protocol, protocol)) {
+			return true
+		}
+	}
+	return false
+}
+
 // ServiceVolumeConfig are references to a volume used by a service
 type ServiceVolumeConfig struct {
 	Type        string               `yaml:",omitempty" json:"type,omitempty"`
@@ -786,6 +1320,9 @@ func (s ServiceVolumeConfig) String() string {
 	if s.Volume != nil && s.Volume.NoCopy {
 		options = append(options, "nocopy")
 	}
+	if s.Consistency != "" {
+		options = append(options, s.Consistency)
+	}
 	return fmt.Sprintf("%s:%s:%s", s.Source, s.Target, strings.Join(options, ","))
 }
 
@@ -822,6 +1359,16 @@ const (
 	SELinuxPrivate string = "Z"
 )
 
+// Consistency represents the consistency requirements of a mount, as supported by Docker Desktop.
+const (
+	// ConsistencyConsistent option requires the host and container views of the mount to always be identical
+	ConsistencyConsistent string = "consistent"
+	// ConsistencyCached option allows the container view of the mount to lag behind the host's
+	ConsistencyCached string = "cached"
+	// ConsistencyDelegated option allows the host view of the mount to lag behind the container's
+	ConsistencyDelegated string = "delegated"
+)
+
 // Propagation represents the propagation of a mount.
 const (
 	// PropagationRPrivate RPRIVATE
@@ -854,6 +1401,141 @@ type ServiceVolumeTmpfs struct {
 	Extensions Extensions `mapstructure:"#extensions" yaml:",inline" json:"-"`
 }
 
+// TmpfsMount is the parsed form of a service `tmpfs` entry, like `/run:size=64m,mode=1777`
+type TmpfsMount struct {
+	Target string
+	// Size is the size limit of the mount in bytes, the runtime default when 0
+	Size UnitBytes
+	// Mode is the file mode of the mount root, the runtime default when 0
+	Mode uint32
+	// Options are the other mount options, like `noexec` or `uid=1000`, in declaration order
+	Options []string
+}
+
+// ParseTmpfs parses a service `tmpfs` entry: an absolute path, optionally followed by a colon and comma-separated
+// mount options. The `size` option accepts a unit, like `64m`, and `mode` is an octal file mode
+func ParseTmpfs(entry string) (TmpfsMount, error) {
+	target, options, _ := strings.Cut(entry, ":")
+	if !strings.HasPrefix(target, "/") {
+		return TmpfsMount{}, fmt.Errorf("invalid tmpfs %q, target must be an absolute path", entry)
+	}
+	mount := TmpfsMount{Target: target}
+	if options == "" {
+		return mount, nil
+	}
+	for _, option := range strings.Split(options, ",") {
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "size":
+			size, err := ParseUnitBytes(value)
+			if err != nil || size < 0 {
+				return TmpfsMount{}, fmt.Errorf("invalid tmpfs %q, size must be a number of bytes, like 64m", entry)
+			}
+			mount.Size = size
+		case "mode":
+			mode, err := strconv.ParseUint(value, 8, 32)
+			if err != nil {
+				return TmpfsMount{}, fmt.Errorf("invalid tmpfs %q, mode must be an octal file mode, like 1777", entry)
+			}
+			mount.Mode = uint32(mode)
+		case "":
+			return TmpfsMount{}, fmt.Errorf("invalid tmpfs %q, options must not be empty", entry)
+		default:
+			mount.Options = append(mount.Options, option)
+		}
+	}
+	return mount, nil
+}
+
+// String returns the `tmpfs` entry for the mount, with the size in bytes
+func (t TmpfsMount) String() string {
+	var options []string
+	if t.Size != 0 {
+		options = append(options, fmt.Sprintf("size=%d", t.Size))
+	}
+	if t.Mode != 0 {
+		options = append(options, "mode="+strconv.FormatUint(uint64(t.Mode), 8))
+	}
+	options = append(options, t.Options...)
+	if len(options) == 0 {
+		return t.Target
+	}
+	return t.Target + ":" + strings.Join(options, ",")
+}
+
+// TmpfsExtension is the service extension declaring `tmpfs` entries with the long syntax, as a list of mappings
+// with `target`, `size` and `mode` attributes, which the compose-spec `tmpfs` attribute doesn't support
+const TmpfsExtension = "x-tmpfs"
+
+// TmpfsMounts parses the service `tmpfs` entries, followed by the ones declared by TmpfsExtension
+func (s ServiceConfig) TmpfsMounts() ([]TmpfsMount, error) {
+	var mounts []TmpfsMount
+	for _, entry := range s.Tmpfs {
+		mount, err := ParseTmpfs(entry)
+		if err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, mount)
+	}
+	extension, ok := s.Extensions[TmpfsExtension]
+	if !ok {
+		return mounts, nil
+	}
+	entries, ok := extension.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid %s, must be a list of mounts", TmpfsExtension)
+	}
+	for _, entry := range entries {
+		mount, err := parseTmpfsMapping(entry)
+		if err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, mount)
+	}
+	return mounts, nil
+}
+
+// parseTmpfsMapping parses a tmpfs entry with the long syntax
+func parseTmpfsMapping(entry interface{}) (TmpfsMount, error) {
+	m, ok := entry.(map[string]interface{})
+	if !ok {
+		return TmpfsMount{}, fmt.Errorf("invalid %s entry %v, must be a mapping with a target", TmpfsExtension, entry)
+	}
+	target, _ := m["target"].(string)
+	if !strings.HasPrefix(target, "/") {
+		return TmpfsMount{}, fmt.Errorf("invalid %s entry, target must be an absolute path", TmpfsExtension)
+	}
+	mount := TmpfsMount{Target: target}
+	switch size := m["size"].(type) {
+	case nil:
+	case int:
+		mount.Size = UnitBytes(size)
+	case float64:
+		mount.Size = UnitBytes(size)
+	case string:
+		parsed, err := ParseUnitBytes(size)
+		if err != nil {
+			return TmpfsMount{}, fmt.Errorf("tmpfs %s: %w", target, err)
+		}
+		mount.Size = parsed
+	default:
+		return TmpfsMount{}, fmt.Errorf("tmpfs %s: invalid size %v", target, size)
+	}
+	if mount.Size < 0 {
+		return TmpfsMount{}, fmt.Errorf("tmpfs %s: invalid size %d", target, mount.Size)
+	}
+	switch mode := m["mode"].(type) {
+	case nil:
+	case int:
+		mount.Mode = uint32(mode)
+	case float64:
+		mount.Mode = uint32(mode)
+	default:
+		return TmpfsMount{}, fmt.Errorf("tmpfs %s: invalid mode %v", target, mode)
+	}
+	return mount, nil
+}
+
 // FileReferenceConfig for a reference to a swarm file object
 type FileReferenceConfig struct {
 	Source string  `yaml:",omitempty" json:"source,omitempty"`
@@ -886,11 +1568,13 @@ func (u *UlimitsConfig) MarshalYAML() (interface{}, error) {
 		return u.Single, nil
 	}
 	return struct {
-		Soft int
-		Hard int
+		Soft       int        `yaml:"soft"`
+		Hard       int        `yaml:"hard"`
+		Extensions Extensions `yaml:",inline"`
 	}{
-		Soft: u.Soft,
-		Hard: u.Hard,
+		Soft:       u.Soft,
+		Hard:       u.Hard,
+		Extensions: u.Extensions,
 	}, nil
 }
 
@@ -987,6 +1671,8 @@ type FileObjectConfig struct {
 	DriverOpts     map[string]string `mapstructure:"driver_opts" yaml:"driver_opts,omitempty" json:"driver_opts,omitempty"`
 	TemplateDriver string            `mapstructure:"template_driver" yaml:"template_driver,omitempty" json:"template_driver,omitempty"`
 	Extensions     Extensions        `mapstructure:"#extensions" yaml:",inline" json:"-"`
+	// Content is the value of the Environment variable, resolved by the loader. It's never serialized, not to leak secrets
+	Content string `mapstructure:"-" yaml:"-" json:"-"`
 }
 
 const (
@@ -1003,16 +1689,31 @@ const (
 type DependsOnConfig map[string]ServiceDependency
 
 type ServiceDependency struct {
-	Condition  string     `yaml:",omitempty" json:"condition,omitempty"`
-	Restart    bool       `yaml:",omitempty" json:"restart,omitempty"`
+	Condition string `yaml:",omitempty" json:"condition,omitempty"`
+	Restart   bool   `yaml:",omitempty" json:"restart,omitempty"`
+	// Required is set to false for a dependency which only influences the start order: the service can be started
+	// even if the dependency isn't defined. Dependencies are required when not set, see IsRequired
+	Required   *bool      `yaml:",omitempty" json:"required,omitempty"`
 	Extensions Extensions `mapstructure:"#extensions" yaml:",inline" json:"-"`
 }
 
+// IsRequired tells if the dependency must be defined by the project
+func (d ServiceDependency) IsRequired() bool {
+	return d.Required == nil || *d.Required
+}
+
 type ExtendsConfig struct {
 	File    string `yaml:",omitempty" json:"file,omitempty"`
 	Service string `yaml:",omitempty" json:"service,omitempty"`
 }
 
+// IncludeConfig is a compose application loaded as a sub-project and imported into the project
+type IncludeConfig struct {
+	Path             StringList `yaml:"path,omitempty" json:"path,omitempty"`
+	ProjectDirectory string     `mapstructure:"project_directory" yaml:"project_directory,omitempty" json:"project_directory,omitempty"`
+	EnvFile          StringList `mapstructure:"env_file" yaml:"env_file,omitempty" json:"env_file,omitempty"`
+}
+
 // SecretConfig for a secret
 type SecretConfig FileObjectConfig
 
@@ -183,6 +183,49 @@ func TestParsePortConfig(t *testing.T) {
 				},
 			},
 		},
+		{
+			value: "127.0.0.1:8080-8090:80/tcp",
+			expected: []ServicePortConfig{
+				{
+					HostIP:    "127.0.0.1",
+					Protocol:  "tcp",
+					Target:    80,
+					Published: "8080-8090",
+					Mode:      "ingress",
+				},
+			},
+		},
+		{
+			value: "[::1]:8080:80",
+			expected: []ServicePortConfig{
+				{
+					HostIP:    "::1",
+					Protocol:  "tcp",
+					Target:    80,
+					Published: "8080",
+					Mode:      "ingress",
+				},
+			},
+		},
+		{
+			value: "[2001:db8::1]:8080-8081:80-81/udp",
+			expected: []ServicePortConfig{
+				{
+					HostIP:    "2001:db8::1",
+					Protocol:  "udp",
+					Target:    80,
+					Published: "8080",
+					Mode:      "ingress",
+				},
+				{
+					HostIP:    "2001:db8::1",
+					Protocol:  "udp",
+					Target:    81,
+					Published: "8081",
+					Mode:      "ingress",
+				},
+			},
+		},
 	}
 	for _, tc := range testCases {
 		ports, err := ParsePortConfig(tc.value)
@@ -278,6 +321,73 @@ func TestNetworksByPriority(t *testing.T) {
 	assert.DeepEqual(t, s.NetworksByPriority(), []string{"qix", "zot", "bar", "foo"})
 }
 
+func TestDurationYAML(t *testing.T) {
+	tests := []struct {
+		input     string
+		canonical string
+	}{
+		{input: "0", canonical: "0s"},
+		{input: "0s", canonical: "0s"},
+		{input: "1.5s", canonical: "1.5s"},
+		{input: "0.5h", canonical: "30m"},
+		{input: "250ms", canonical: "250ms"},
+		{input: "100us", canonical: "100us"},
+		{input: "90s", canonical: "1m30s"},
+		{input: "1h0m0s", canonical: "1h"},
+		{input: "1h5s", canonical: "1h5s"},
+		{input: "1m30.5s", canonical: "1m30.5s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var d Duration
+			assert.NilError(t, yaml.Unmarshal([]byte(tt.input), &d))
+			out, err := yaml.Marshal(d)
+			assert.NilError(t, err)
+			assert.Equal(t, strings.TrimSpace(string(out)), tt.canonical)
+		})
+	}
+}
+
+func TestDurationInvalidUnit(t *testing.T) {
+	var d Duration
+	err := yaml.Unmarshal([]byte("1d"), &d)
+	assert.Error(t, err, `invalid duration "1d", expected a number with one of the us, ms, s, m or h units, like 1m30s`)
+}
+
+func TestGetImageName(t *testing.T) {
+	tests := []struct {
+		name     string
+		service  ServiceConfig
+		expected string
+	}{
+		{
+			name:     "build only",
+			service:  ServiceConfig{Name: "web", Build: &BuildConfig{Context: "."}},
+			expected: "docker.io/library/myproject-web:latest",
+		},
+		{
+			name:     "image only",
+			service:  ServiceConfig{Name: "web", Image: "nginx"},
+			expected: "docker.io/library/nginx:latest",
+		},
+		{
+			name:     "build and image",
+			service:  ServiceConfig{Name: "web", Image: "registry.example.com:5000/team/web:1.2", Build: &BuildConfig{Context: "."}},
+			expected: "registry.example.com:5000/team/web:1.2",
+		},
+		{
+			name:     "invalid image",
+			service:  ServiceConfig{Name: "web", Image: "Not A Reference"},
+			expected: "Not A Reference",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.service.GetImageName("myproject"), tt.expected)
+		})
+	}
+}
+
 func TestMarshalServiceEntrypoint(t *testing.T) {
 	t.Parallel()
 
@@ -368,3 +478,282 @@ func equalTrimSpace(x interface{}, y interface{}) is.Comparison {
 	}
 	return is.DeepEqual(trim(x), trim(y))
 }
+
+func TestParseUnitBytes(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected UnitBytes
+		err      string
+	}{
+		{value: "512", expected: 512},
+		{value: "512b", expected: 512},
+		{value: "2k", expected: 2 * 1024},
+		{value: "2KB", expected: 2 * 1024},
+		{value: "1024kb", expected: 1024 * 1024},
+		{value: "300m", expected: 300 * 1024 * 1024},
+		{value: "300Mi", expected: 300 * 1024 * 1024},
+		{value: "512Ki", expected: 512 * 1024},
+		{value: "1Gi", expected: 1 << 30},
+		{value: "2Ti", expected: 2 << 40},
+		{value: "1g", expected: 1 << 30},
+		{value: "1G", expected: 1 << 30},
+		{value: "1gb", expected: 1 << 30},
+		{value: "1GiB", expected: 1 << 30},
+		{value: "1.5g", expected: 3 << 29},
+		{value: "1 g", expected: 1 << 30},
+		{value: "2t", expected: 2 << 40},
+		{value: "1.5b", err: `invalid size "1.5b": not a whole number of bytes`},
+		{value: "-1g", err: `invalid size "-1g"`},
+		{value: "g", err: `invalid size "g"`},
+		{value: "1x", err: `invalid size "1x": unknown unit "x"`},
+		{value: "", err: `invalid size ""`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			size, err := ParseUnitBytes(tc.value)
+			if tc.err != "" {
+				assert.Error(t, err, tc.err)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, size, tc.expected)
+
+			var decoded UnitBytes
+			assert.NilError(t, yaml.Unmarshal([]byte(fmt.Sprintf("%q", tc.value)), &decoded))
+			assert.Equal(t, decoded, tc.expected)
+
+			marshalled, err := yaml.Marshal(decoded)
+			assert.NilError(t, err)
+			assert.NilError(t, yaml.Unmarshal(marshalled, &decoded))
+			assert.Equal(t, decoded, tc.expected)
+		})
+	}
+}
+
+func TestParseRestartPolicy(t *testing.T) {
+	three := 3
+	zero := 0
+	testCases := []struct {
+		value    string
+		expected ServiceRestartPolicy
+		err      string
+	}{
+		{value: "no", expected: ServiceRestartPolicy{Policy: RestartPolicyNo}},
+		{value: "always", expected: ServiceRestartPolicy{Policy: RestartPolicyAlways}},
+		{value: "unless-stopped", expected: ServiceRestartPolicy{Policy: RestartPolicyUnlessStopped}},
+		{value: "on-failure", expected: ServiceRestartPolicy{Policy: RestartPolicyOnFailure}},
+		{value: "on-failure:3", expected: ServiceRestartPolicy{Policy: RestartPolicyOnFailure, MaxRetries: &three}},
+		{value: "on-failure:0", expected: ServiceRestartPolicy{Policy: RestartPolicyOnFailure, MaxRetries: &zero}},
+		{value: "on-failure:abc", err: `invalid restart policy "on-failure:abc", maximum retry count must be a positive integer`},
+		{value: "on-failure:-1", err: `invalid restart policy "on-failure:-1", maximum retry count must be a positive integer`},
+		{value: "always:3", err: `invalid restart policy "always:3", maximum retry count is only supported by on-failure`},
+		{value: "sometimes", err: `invalid restart policy "sometimes", expected one of no, always, on-failure or unless-stopped`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			policy, err := ParseRestartPolicy(tc.value)
+			if tc.err != "" {
+				assert.Error(t, err, tc.err)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, policy, tc.expected)
+			assert.Equal(t, policy.String(), tc.value)
+		})
+	}
+}
+
+func TestParsePullPolicy(t *testing.T) {
+	for value, expected := range map[string]string{
+		"":               "",
+		"always":         PullPolicyAlways,
+		"never":          PullPolicyNever,
+		"missing":        PullPolicyMissing,
+		"if_not_present": PullPolicyMissing,
+		"build":          PullPolicyBuild,
+	} {
+		policy, err := ParsePullPolicy(value)
+		assert.NilError(t, err)
+		assert.Equal(t, policy, expected)
+	}
+	_, err := ParsePullPolicy("if-not-present")
+	assert.Error(t, err, `invalid pull policy "if-not-present", expected one of always, never, missing or build`)
+}
+
+func TestParseSignal(t *testing.T) {
+	for value, expected := range map[string]string{
+		"":            "",
+		"SIGTERM":     "SIGTERM",
+		"term":        "SIGTERM",
+		"SigKill":     "SIGKILL",
+		"15":          "15",
+		"09":          "9",
+		"RTMIN+1":     "SIGRTMIN+1",
+		"sigrtmax-2":  "SIGRTMAX-2",
+		"SIGRTMAX-30": "SIGRTMAX-30",
+	} {
+		signal, err := ParseSignal(value)
+		assert.NilError(t, err, value)
+		assert.Equal(t, signal, expected)
+	}
+	for value, expected := range map[string]string{
+		"SIGFOO":      `invalid signal "SIGFOO"`,
+		"0":           `invalid signal "0", signal number must be between 1 and 64`,
+		"65":          `invalid signal "65", signal number must be between 1 and 64`,
+		"SIGRTMIN+31": `invalid signal "SIGRTMIN+31", real-time signal offset must be at most 30`,
+	} {
+		_, err := ParseSignal(value)
+		assert.Error(t, err, expected)
+	}
+}
+
+func TestNewHostsList(t *testing.T) {
+	hosts, err := NewHostsList([]string{"alpha:10.0.0.1", "alpha:10.0.0.2", "beta:::1", "alpha:10.0.0.1"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, hosts, HostsList{
+		"alpha": []string{"10.0.0.1", "10.0.0.2"},
+		"beta":  []string{"::1"},
+	})
+	assert.DeepEqual(t, hosts.AsList(), []string{"alpha:10.0.0.1", "alpha:10.0.0.2", "beta:::1"})
+
+	_, err = NewHostsList([]string{"alpha"})
+	assert.Error(t, err, `invalid extra host "alpha", expected host:ip`)
+	_, err = NewHostsList([]string{":10.0.0.1"})
+	assert.Error(t, err, `invalid extra host ":10.0.0.1", host name must not be empty`)
+	_, err = NewHostsList([]string{"alpha:localhost"})
+	assert.Error(t, err, `invalid IP address "localhost" for extra host "alpha"`)
+}
+
+func TestNetworkModeKind(t *testing.T) {
+	for networkMode, expected := range map[string][2]string{
+		"":                  {NetworkModeDefault, ""},
+		"bridge":            {NetworkModeDefault, "bridge"},
+		"host":              {NetworkModeHost, ""},
+		"none":              {NetworkModeNone, ""},
+		"service:db":        {NetworkModeService, "db"},
+		"container:proxy_1": {NetworkModeContainer, "proxy_1"},
+	} {
+		kind, target := ServiceConfig{Name: "web", NetworkMode: networkMode}.NetworkModeKind()
+		assert.DeepEqual(t, [2]string{kind, target}, expected)
+	}
+}
+
+func TestParseCPUSet(t *testing.T) {
+	for cpuset, expected := range map[string][]int{
+		"":          nil,
+		"0":         {0},
+		"0-3,5":     {0, 1, 2, 3, 5},
+		"5,0-1,1-2": {0, 1, 2, 5},
+		"7-7":       {7},
+	} {
+		cpus, err := ParseCPUSet(cpuset)
+		assert.NilError(t, err, cpuset)
+		assert.DeepEqual(t, cpus, expected)
+	}
+	for cpuset, expected := range map[string]string{
+		"0-":     `invalid cpuset "0-", expected a list of CPU numbers or ranges like 0-3,5`,
+		"1,,2":   `invalid cpuset "1,,2", expected a list of CPU numbers or ranges like 0-3,5`,
+		"a-b":    `invalid cpuset "a-b", expected a list of CPU numbers or ranges like 0-3,5`,
+		"-1":     `invalid cpuset "-1", expected a list of CPU numbers or ranges like 0-3,5`,
+		"+1":     `invalid cpuset "+1", expected a list of CPU numbers or ranges like 0-3,5`,
+		"0 - 3":  `invalid cpuset "0 - 3", expected a list of CPU numbers or ranges like 0-3,5`,
+		"3-1":    `invalid cpuset "3-1", range 3-1 must not be reversed`,
+		"0-9999": `invalid cpuset "0-9999", CPU 9999 exceeds the maximum of 8191`,
+	} {
+		_, err := ParseCPUSet(cpuset)
+		assert.Error(t, err, expected)
+	}
+}
+
+func TestParseTmpfs(t *testing.T) {
+	for entry, expected := range map[string]TmpfsMount{
+		"/run":                               {Target: "/run"},
+		"/run:size=64m":                      {Target: "/run", Size: 64 * 1024 * 1024},
+		"/tmp:size=1024,mode=1777":           {Target: "/tmp", Size: 1024, Mode: 0o1777},
+		"/cache:noexec,size=1.5k,uid=1000":   {Target: "/cache", Size: 1536, Options: []string{"noexec", "uid=1000"}},
+		"/data:mode=0755,nosuid,size=1g,dev": {Target: "/data", Size: 1 << 30, Mode: 0o755, Options: []string{"nosuid", "dev"}},
+	} {
+		mount, err := ParseTmpfs(entry)
+		assert.NilError(t, err, entry)
+		assert.DeepEqual(t, mount, expected)
+		reparsed, err := ParseTmpfs(mount.String())
+		assert.NilError(t, err)
+		assert.DeepEqual(t, reparsed, mount)
+	}
+	mount, err := ParseTmpfs("/cache:noexec,size=1.5k,mode=700")
+	assert.NilError(t, err)
+	assert.Equal(t, mount.String(), "/cache:size=1536,mode=700,noexec")
+
+	for entry, expected := range map[string]string{
+		"run":           `invalid tmpfs "run", target must be an absolute path`,
+		"/run:size=big": `invalid tmpfs "/run:size=big", size must be a number of bytes, like 64m`,
+		"/run:mode=999": `invalid tmpfs "/run:mode=999", mode must be an octal file mode, like 1777`,
+		"/run:size=1m,": `invalid tmpfs "/run:size=1m,", options must not be empty`,
+	} {
+		_, err := ParseTmpfs(entry)
+		assert.Error(t, err, expected)
+	}
+}
+
+func TestTmpfsMounts(t *testing.T) {
+	s := ServiceConfig{
+		Tmpfs: StringList{"/tmp"},
+		Extensions: Extensions{TmpfsExtension: []interface{}{
+			map[string]interface{}{"target": "/run", "size": "64m", "mode": 0o1777},
+			map[string]interface{}{"target": "/cache", "size": float64(1024)},
+		}},
+	}
+	mounts, err := s.TmpfsMounts()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, mounts, []TmpfsMount{
+		{Target: "/tmp"},
+		{Target: "/run", Size: 64 * 1024 * 1024, Mode: 0o1777},
+		{Target: "/cache", Size: 1024},
+	})
+
+	for _, tc := range []struct {
+		extension interface{}
+		err       string
+	}{
+		{extension: "/run", err: "invalid x-tmpfs, must be a list of mounts"},
+		{extension: []interface{}{"/run"}, err: "invalid x-tmpfs entry /run, must be a mapping with a target"},
+		{extension: []interface{}{map[string]interface{}{"size": 1}}, err: "invalid x-tmpfs entry, target must be an absolute path"},
+		{extension: []interface{}{map[string]interface{}{"target": "/run", "size": -1}}, err: "tmpfs /run: invalid size -1"},
+		{extension: []interface{}{map[string]interface{}{"target": "/run", "mode": "1777"}}, err: "tmpfs /run: invalid mode 1777"},
+	} {
+		_, err := ServiceConfig{Extensions: Extensions{TmpfsExtension: tc.extension}}.TmpfsMounts()
+		assert.Error(t, err, tc.err)
+	}
+}
+
+func TestPublishedPorts(t *testing.T) {
+	var ports []ServicePortConfig
+	for _, spec := range []string{"8080:80", "127.0.0.1:9000-9001:9000-9001/udp", "3000-3002:3000", "5000"} {
+		p, err := ParsePortConfig(spec)
+		assert.NilError(t, err)
+		ports = append(ports, p...)
+	}
+	ports = append(ports, ServicePortConfig{Target: 443, Published: "8443", Protocol: "TCP"})
+	s := ServiceConfig{Name: "web", Ports: ports}
+
+	assert.DeepEqual(t, s.PublishedPorts(), []PortBinding{
+		{Published: 8080, Target: 80, Protocol: "tcp"},
+		{HostIP: "127.0.0.1", Published: 9000, Target: 9000, Protocol: "udp"},
+		{HostIP: "127.0.0.1", Published: 9001, Target: 9001, Protocol: "udp"},
+		{Published: 3000, Target: 3000, Protocol: "tcp"},
+		{Published: 3001, Target: 3000, Protocol: "tcp"},
+		{Published: 3002, Target: 3000, Protocol: "tcp"},
+		{Published: 8443, Target: 443, Protocol: "tcp"},
+	})
+
+	assert.Check(t, s.PublishesPort(8080, "tcp"))
+	assert.Check(t, s.PublishesPort(8080, ""))
+	assert.Check(t, !s.PublishesPort(8080, "udp"))
+	assert.Check(t, s.PublishesPort(9001, "udp"))
+	assert.Check(t, !s.PublishesPort(9001, "tcp"))
+	assert.Check(t, s.PublishesPort(3001, "tcp"))
+	assert.Check(t, s.PublishesPort(8443, "TCP"))
+	// target ports without a published port are not reachable from the host
+	assert.Check(t, !s.PublishesPort(5000, ""))
+	assert.Check(t, !s.PublishesPort(80, ""))
+}
@@ -0,0 +1,50 @@
+/*
+   Copyright 2020 The Compose Specification Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package utils
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FSPath converts a file path into a valid fs.FS path. Absolute paths are considered relative to the fs.FS root
+func FSPath(name string) string {
+	p := strings.TrimPrefix(path.Clean(filepath.ToSlash(name)), "/")
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+// ReadFile reads the named file from fsys, or from the local filesystem if fsys is nil
+func ReadFile(fsys fs.FS, name string) ([]byte, error) {
+	if fsys == nil {
+		return os.ReadFile(name)
+	}
+	return fs.ReadFile(fsys, FSPath(name))
+}
+
+// Stat returns a FileInfo describing the named file from fsys, or from the local filesystem if fsys is nil
+func Stat(fsys fs.FS, name string) (fs.FileInfo, error) {
+	if fsys == nil {
+		return os.Stat(name)
+	}
+	return fs.Stat(fsys, FSPath(name))
+}